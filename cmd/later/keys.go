@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/manmolecular/go-later/internal/pkg/storage"
+	"github.com/manmolecular/go-later/internal/pkg/tui"
+)
+
+// passphraseHint defines how to pass the secret when it can not be typed into the terminal
+const passphraseHint = "pass the key file with -key-file or the passphrase with $LATER_PASSPHRASE"
+
+// errNoKeyCache means that keys are not cached, as there is no user runtime directory to keep them in
+var errNoKeyCache = errors.New("key cache is not available without $XDG_RUNTIME_DIR")
+
+// defaultKeyCache defines the time the key of the encrypted database is cached for unless it is configured
+const defaultKeyCache = 15 * time.Minute
+
+// keyring obtains the key of the encrypted database from the session cache, the key file, $LATER_PASSPHRASE
+// or the passphrase typed into the terminal; keys are cached in the user runtime directory, like an agent would
+// keep them, until they are not used for the cache time, and are not cached at all without that directory
+type keyring struct {
+	dbPath   string
+	keyFile  string
+	cacheTTL time.Duration
+}
+
+// unlock returns the key matching the encryption parameters of the database
+func (k *keyring) unlock(params storage.EncryptionParams) ([]byte, error) {
+	if key, ok := k.cached(); ok && storage.VerifyKey(key, params) == nil {
+		_ = k.remember(key)
+		return key, nil
+	}
+
+	secret, err := k.secret("passphrase: ", false)
+	if err != nil {
+		return nil, err
+	}
+
+	key := storage.DeriveKey(secret, params)
+	if err = storage.VerifyKey(key, params); err != nil {
+		return nil, err
+	}
+
+	_ = k.remember(key)
+
+	return key, nil
+}
+
+// secret returns the content of the key file, $LATER_PASSPHRASE or the passphrase typed into the terminal,
+// a new passphrase is typed twice
+func (k *keyring) secret(prompt string, confirm bool) ([]byte, error) {
+	if k.keyFile != "" {
+		data, err := os.ReadFile(k.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("key file can not be read, error: %w", err)
+		}
+		if data = bytes.TrimRight(data, "\r\n"); len(data) == 0 {
+			return nil, errors.New("key file is empty")
+		}
+		return data, nil
+	}
+
+	if passphrase := os.Getenv("LATER_PASSPHRASE"); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+
+	if !isTerminal(os.Stdin) {
+		return nil, errors.New(passphraseHint)
+	}
+
+	passphrase, err := tui.ReadPassword(os.Stdin, os.Stderr, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("passphrase can not be read, %s, error: %w", passphraseHint, err)
+	}
+
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase is empty")
+	}
+
+	if confirm {
+		repeated, err := tui.ReadPassword(os.Stdin, os.Stderr, "repeat "+prompt)
+		if err != nil {
+			return nil, fmt.Errorf("passphrase can not be read, error: %w", err)
+		}
+		if !bytes.Equal(passphrase, repeated) {
+			return nil, errors.New("passphrases do not match")
+		}
+	}
+
+	return passphrase, nil
+}
+
+// cached returns the key from the session cache unless it has expired
+func (k *keyring) cached() ([]byte, bool) {
+	path, err := k.cachePath()
+	if err != nil {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	expiry, encoded, ok := strings.Cut(strings.TrimSpace(string(data)), " ")
+	seconds, err := strconv.ParseInt(expiry, 10, 64)
+	if !ok || err != nil || time.Now().After(time.Unix(seconds, 0)) {
+		_ = os.Remove(path)
+		return nil, false
+	}
+
+	key, err := hex.DecodeString(encoded)
+	if err != nil || len(key) != storage.KeySize {
+		return nil, false
+	}
+
+	return key, true
+}
+
+// remember caches the key for the cache time since now
+func (k *keyring) remember(key []byte) error {
+	if k.cacheTTL <= 0 {
+		return nil
+	}
+
+	path, err := k.cachePath()
+	if errors.Is(err, errNoKeyCache) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	data := fmt.Sprintf("%d %s\n", time.Now().Add(k.cacheTTL).Unix(), hex.EncodeToString(key))
+	temporary := path + ".tmp"
+	if err = os.WriteFile(temporary, []byte(data), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(temporary, path)
+}
+
+// forget deletes the cached key
+func (k *keyring) forget() error {
+	path, err := k.cachePath()
+	if errors.Is(err, errNoKeyCache) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// cachePath returns the cache file of the database key in $XDG_RUNTIME_DIR, which is kept in memory, private
+// to the user and cleared on logout; keys are not cached without it, as other directories may keep them on disk
+// across reboots. The directory must be owned by the user and accessible by the user only
+func (k *keyring) cachePath() (string, error) {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		return "", errNoKeyCache
+	}
+
+	dir := filepath.Join(runtimeDir, "later")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+
+	if !info.IsDir() || !ownedByUser(info) || info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("key cache directory %s is not private to the user", dir)
+	}
+
+	sum := sha256.Sum256([]byte(k.dbPath))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".key"), nil
+}
@@ -1,145 +1,1371 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"os/exec"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/manmolecular/go-later/internal/pkg/config"
+	"github.com/manmolecular/go-later/internal/pkg/dateparse"
+	"github.com/manmolecular/go-later/internal/pkg/recurrence"
+	"github.com/manmolecular/go-later/internal/pkg/server"
 	"github.com/manmolecular/go-later/internal/pkg/storage"
+	"github.com/manmolecular/go-later/internal/pkg/transfer"
+	"github.com/manmolecular/go-later/internal/pkg/tui"
 )
 
 const (
-	cmdPush   = "push"
-	cmdPop    = "pop"
-	cmdShow   = "show"
-	cmdList   = "list"
-	cmdCount  = "count"
-	cmdDelete = "delete"
-	cmdClean  = "clean"
+	cmdPush    = "push"
+	cmdPop     = "pop"
+	cmdShow    = "show"
+	cmdList    = "list"
+	cmdCount   = "count"
+	cmdDelete  = "delete"
+	cmdDone    = "done"
+	cmdUndone  = "undone"
+	cmdDue     = "due"
+	cmdPrio    = "prio"
+	cmdTags    = "tags"
+	cmdTag     = "tag"
+	cmdUntag   = "untag"
+	cmdSearch  = "search"
+	cmdEdit    = "edit"
+	cmdUndo    = "undo"
+	cmdRedo    = "redo"
+	cmdClean   = "clean"
+	cmdExport  = "export"
+	cmdImport  = "import"
+	cmdSync    = "sync-todotxt"
+	cmdLists   = "lists"
+	cmdMove    = "move"
+	cmdTUI     = "tui"
+	cmdServe   = "serve"
+	cmdDb      = "db"
+	cmdBackup  = "backup"
+	cmdEncrypt = "encrypt"
+	cmdDecrypt = "decrypt"
+	cmdLock    = "lock"
 )
 
+// sortToOrder maps values of the --sort flag to records order
+var sortToOrder = map[string]storage.Order{
+	"priority": storage.OrderPriority,
+	"created":  storage.OrderNewest,
+	"due":      storage.OrderDue,
+}
+
+// priorityToMarker maps priority levels to markers printed before records content
+var priorityToMarker = map[storage.Priority]string{
+	storage.PriorityHigh:   "!!! ",
+	storage.PriorityMedium: "!! ",
+	storage.PriorityLow:    "! ",
+}
+
+// defaultTimeLayout defines the format of timestamps printed for records unless it is configured
+const defaultTimeLayout = "2006-01-02 15:04:05"
+
+// defaultSort defines the order of listed records unless it is configured
+const defaultSort = "priority"
+
+// defaultServeAddr defines the address the API server listens on unless it is passed with --addr
+const defaultServeAddr = "127.0.0.1:7070"
+
+// maxBulkIDs limits the number of IDs selected by a single command
+const maxBulkIDs = 10000
+
 var cmdToDesc = map[string]string{
-	cmdPush:   "add new task",
-	cmdPop:    "delete the latest task",
-	cmdShow:   "show the exact task by its ID",
-	cmdList:   "list all tasks",
-	cmdCount:  "count tasks",
-	cmdDelete: "delete the exact task by its ID",
-	cmdClean:  "clean the database",
+	cmdPush:    "add new task (--due to set a due date, e.g.: tomorrow, \"fri 17:00\", +3d, 2026-11-02; -p high|medium|low to set a priority; +tag tokens or --tag to label it; --every to repeat it, e.g.: day, weekdays, monday, \"3 days\", 1st, RRULE; --under to add it as a subtask of the task by its ID)",
+	cmdPop:     "delete the latest task with its subtasks",
+	cmdShow:    "show the exact task by its ID",
+	cmdList:    "list pending tasks (--all to include completed, --done for completed only, --sort priority|created|due, --tag to filter by tag, -l to filter by list)",
+	cmdCount:   "count pending tasks (--all to include completed, --done for completed only, -l to count in a list, --lists to count per list)",
+	cmdDelete:  "delete tasks by their IDs and ranges, e.g.: 3,5,7-12, or by filters (--tag, --older-than 30d, --done) with their subtasks, --dry-run to list them first",
+	cmdDone:    "mark the exact task by its ID as completed",
+	cmdUndone:  "mark the exact task by its ID as not completed",
+	cmdDue:     "show pending tasks which are overdue, due today and due this week",
+	cmdPrio:    "set priority of the exact task by its ID: high, medium, low or none",
+	cmdTags:    "list tags with the number of tasks labeled by each of them",
+	cmdTag:     "label the exact task by its ID with a tag",
+	cmdUntag:   "remove a tag from the exact task by its ID",
+	cmdEdit:    "replace content of the exact task by its ID, opens $EDITOR if no content is given",
+	cmdSearch:  "full-text search across tasks, supports \"exact phrases\" and prefix* matches",
+	cmdClean:   "clean the database (it is moved into the trash and can be restored with undo)",
+	cmdUndo:    "revert the latest change of tasks",
+	cmdRedo:    "apply again the latest change reverted with undo",
+	cmdExport:  "export all tasks (--format json|csv|md|todotxt, --file to write into a file instead of stdout)",
+	cmdImport:  "import tasks from a file or stdin (-), skipping duplicates (--format json|csv|md|todotxt, --replace to delete existing tasks first)",
+	cmdSync:    "synchronize tasks with a todo.txt file both ways, the latest change wins",
+	cmdLists:   "list lists (projects) with the number of pending tasks in each of them",
+	cmdMove:    "move the exact task by its ID into a list, the list is created if it does not exist (\"\" to remove from its list)",
+	cmdServe:   "serve the REST API over the tasks on a local address until interrupted (--addr, 127.0.0.1:7070 by default)",
+	cmdDb:      "manage the database schema: migrate to apply pending migrations, status to list them, rollback [--to version] to revert the latest ones (a backup is made first)",
+	cmdBackup:  "list backups of the database made before destructive changes and on schedule with list, replace the database with one of them with restore <name>",
+	cmdEncrypt: "encrypt content, tags and lists of tasks with a passphrase or the key file (-key-file), the undo history, the trash and backups holding plain copies are deleted",
+	cmdDecrypt: "decrypt the encrypted database back into plain text",
+	cmdLock:    "forget the cached key of the encrypted database, the passphrase is asked again on the next command",
+	cmdTUI:     "open the interactive full-screen interface to browse, add, edit, complete and delete tasks (? for keys)",
+}
+
+// exit codes of failed commands, so that scripts can tell a missing task from a mistyped command
+const (
+	exitFailure  = 1 // storage, file system or other failures
+	exitInvalid  = 2 // invalid arguments or input
+	exitNotFound = 3 // the task or another requested object does not exist
+	exitEmpty    = 4 // there are no tasks to work with
+)
+
+// usageError defines invalid arguments of a command, it matches storage.ErrInvalidInput
+type usageError struct {
+	message string
+}
+
+func (e *usageError) Error() string {
+	return e.message
 }
 
+func (e *usageError) Is(target error) bool {
+	return target == storage.ErrInvalidInput
+}
+
+// invalidf returns an error about invalid arguments of a command with the formatted message
+func invalidf(format string, args ...interface{}) error {
+	return &usageError{message: fmt.Sprintf(format, args...)}
+}
+
+// errEncryptionUnsupported is returned by encrypt and decrypt for storages other than the sqlite database
+var errEncryptionUnsupported = errors.New("encryption is supported by the sqlite database only")
+
 // Command implements command handler and router
 type Command struct {
-	storage storage.Storage
+	storage    storage.Storage
+	local      *storage.LocalStorage // database under the storage, it is converted by encrypt and decrypt
+	keys       *keyring
+	activeList string // list new records are added to and records are selected from, empty for all lists
+	sortBy     string // default sort order of listed records
+	view       view
 }
 
-// NewCommand creates new Command object
-func NewCommand(s storage.Storage) *Command {
-	return &Command{storage: s}
+// NewCommand creates new Command object working with the list and printing records with the view
+func NewCommand(s storage.Storage, list, sortBy string, v view) *Command {
+	return &Command{storage: s, activeList: list, sortBy: sortBy, view: v}
 }
 
 // handle handles commands passed from the CLI
-func (c *Command) handle(args []string) error {
-	switch strings.ToLower(args[0]) {
-	case cmdPush: // content
+func (c *Command) handle(args []string) (result, error) {
+	command := strings.ToLower(args[0])
+	switch command {
+	case cmdPush: // [flags] content
 		if len(args) < 2 {
-			return errors.New("content is not provided")
-		}
-		record := strings.Join(args[1:], " ")
-		if record == "" {
-			return errors.New("no content to add")
-		}
-		if err := c.storage.CreateRecord(record); err != nil {
-			return fmt.Errorf("record can not be added to the database, error: %s", err)
+			return nil, invalidf("content is not provided")
 		}
+		return c.push(args[1:])
 	case cmdPop:
 		if err := c.storage.DeleteLastRecord(); err != nil {
-			return fmt.Errorf("last record can not be deleted, error: %s", err)
+			return nil, fmt.Errorf("last record can not be deleted, error: %w", err)
 		}
+		return statusResult{Action: command}, nil
 	case cmdShow: // by ID
 		if len(args) < 2 {
-			return errors.New("ID is not provided")
+			return nil, invalidf("ID is not provided")
 		}
 		id, err := strconv.Atoi(args[1])
 		if err != nil {
-			return fmt.Errorf("ID has invalid type, error: %s", err)
+			return nil, invalidf("ID has invalid type, error: %s", err)
 		}
-		content, err := c.storage.GetRecordByID(uint(id))
+		record, err := c.storage.GetRecordByID(uint(id))
 		if err != nil {
-			return fmt.Errorf("record can not be shown, error: %s", err)
+			return nil, fmt.Errorf("record can not be shown, error: %w", err)
 		}
-		fmt.Println(content)
+		return recordResult(record), nil
 	case cmdList:
-		records, err := c.storage.GetRecords()
+		return c.list(args[1:])
+	case cmdCount:
+		fs := flag.NewFlagSet(cmdCount, flag.ContinueOnError)
+		statusFlags := addStatusFlags(fs)
+		list := fs.String("l", c.activeList, "count only tasks of the list")
+		perList := fs.Bool("lists", false, "count tasks per list")
+		if err := fs.Parse(args[1:]); err != nil {
+			return nil, invalidf("flags can not be parsed, error: %s", err)
+		}
+		status, err := statusFlags.status()
 		if err != nil {
-			return fmt.Errorf("records can not be displayed, error: %s", err)
+			return nil, err
 		}
-		for _, rowRecord := range records {
-			fmt.Printf("%d. %s (created at: %s)\n", rowRecord.ID, rowRecord.Content, rowRecord.CreatedAt.Format("2006-01-02 15:04:05"))
+		if *perList {
+			lists, err := c.storage.GetLists(storage.Filter{Status: status})
+			if err != nil {
+				return nil, fmt.Errorf("records can not be counted, error: %w", err)
+			}
+			return listsResult(lists), nil
 		}
-	case cmdCount:
-		count, err := c.storage.CountRecords()
+		count, err := c.storage.CountRecords(storage.Filter{Status: status, List: *list})
+		if err != nil {
+			return nil, fmt.Errorf("records can not be counted, error: %w", err)
+		}
+		return countResult(count), nil
+	case cmdDelete: // by IDs and filters
+		return c.delete(args[1:])
+	case cmdDone, cmdUndone: // by ID
+		if len(args) < 2 {
+			return nil, invalidf("ID is not provided")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return nil, invalidf("ID has invalid type, error: %s", err)
+		}
+		if err = c.storage.MarkRecordDone(uint(id), command == cmdDone); err != nil {
+			return nil, fmt.Errorf("record status can not be changed, error: %w", err)
+		}
+		return statusResult{Action: command, ID: uint(id)}, nil
+	case cmdPrio: // by ID and level
+		if len(args) < 3 {
+			return nil, invalidf("ID and priority are not provided")
+		}
+		id, err := strconv.Atoi(args[1])
 		if err != nil {
-			return fmt.Errorf("records can not be counted, error: %s", err)
+			return nil, invalidf("ID has invalid type, error: %s", err)
+		}
+		priority, err := storage.ParsePriority(args[2])
+		if err != nil {
+			return nil, err
+		}
+		if err = c.storage.SetRecordPriority(uint(id), priority); err != nil {
+			return nil, fmt.Errorf("record priority can not be changed, error: %w", err)
+		}
+		return statusResult{Action: command, ID: uint(id)}, nil
+	case cmdTags:
+		tags, err := c.storage.GetTags()
+		if err != nil {
+			return nil, fmt.Errorf("tags can not be displayed, error: %w", err)
+		}
+		return tagsResult(tags), nil
+	case cmdLists:
+		lists, err := c.storage.GetLists(storage.Filter{Status: storage.StatusPending})
+		if err != nil {
+			return nil, fmt.Errorf("lists can not be displayed, error: %w", err)
+		}
+		return listsResult(lists), nil
+	case cmdMove: // by ID and list
+		if len(args) < 3 {
+			return nil, invalidf("ID and list are not provided")
 		}
-		fmt.Println(count)
-	case cmdDelete: // by ID
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return nil, invalidf("ID has invalid type, error: %s", err)
+		}
+		if err = c.storage.MoveRecord(uint(id), args[2]); err != nil {
+			return nil, fmt.Errorf("record can not be moved, error: %w", err)
+		}
+		return statusResult{Action: command, ID: uint(id)}, nil
+	case cmdTag, cmdUntag: // by ID and tag
+		if len(args) < 3 {
+			return nil, invalidf("ID and tag are not provided")
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return nil, invalidf("ID has invalid type, error: %s", err)
+		}
+		if command == cmdTag {
+			err = c.storage.TagRecord(uint(id), args[2])
+		} else {
+			err = c.storage.UntagRecord(uint(id), args[2])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("record tags can not be changed, error: %w", err)
+		}
+		return statusResult{Action: command, ID: uint(id)}, nil
+	case cmdEdit: // by ID and optional content
 		if len(args) < 2 {
-			return errors.New("ID is not provided")
+			return nil, invalidf("ID is not provided")
 		}
 		id, err := strconv.Atoi(args[1])
 		if err != nil {
-			return fmt.Errorf("ID has invalid type, error: %s", err)
+			return nil, invalidf("ID has invalid type, error: %s", err)
+		}
+		return c.edit(uint(id), strings.Join(args[2:], " "))
+	case cmdSearch: // query
+		if len(args) < 2 {
+			return nil, invalidf("search query is not provided")
+		}
+		return c.search(strings.Join(args[1:], " "))
+	case cmdDue:
+		return c.due()
+	case cmdExport:
+		return c.export(args[1:])
+	case cmdImport: // [flags] file
+		return c.importFile(args[1:])
+	case cmdSync: // file
+		if len(args) < 2 {
+			return nil, invalidf("todo.txt file is not provided")
+		}
+		report, err := transfer.SyncTodoTxt(c.storage, args[1])
+		if err != nil {
+			return nil, fmt.Errorf("todo.txt file can not be synchronized, error: %w", err)
+		}
+		return syncResult(report), nil
+	case cmdUndo:
+		description, err := c.storage.Undo()
+		if err != nil {
+			return nil, fmt.Errorf("change can not be undone, error: %w", err)
+		}
+		return statusResult{Action: command, Message: "undone: " + description}, nil
+	case cmdRedo:
+		description, err := c.storage.Redo()
+		if err != nil {
+			return nil, fmt.Errorf("change can not be redone, error: %w", err)
 		}
-		if err = c.storage.DeleteRecordByID(uint(id)); err != nil {
-			return fmt.Errorf("record can not be deleted, error: %s", err)
+		return statusResult{Action: command, Message: "redone: " + description}, nil
+	case cmdTUI:
+		return c.tui()
+	case cmdServe:
+		return c.serve(args[1:])
+	case cmdDb: // migrate, status or rollback
+		return c.db(args[1:])
+	case cmdBackup: // list or restore by name
+		return c.backup(args[1:])
+	case cmdEncrypt:
+		return c.encrypt()
+	case cmdDecrypt:
+		return c.decrypt()
+	case cmdLock:
+		if err := c.keys.forget(); err != nil {
+			return nil, fmt.Errorf("cached key can not be forgotten, error: %w", err)
 		}
+		return statusResult{Action: command, Message: "cached key is forgotten"}, nil
 	case cmdClean:
 		if err := c.storage.CleanUp(); err != nil {
-			return fmt.Errorf("storage can not be cleaned up, error: %s", err)
+			return nil, fmt.Errorf("storage can not be cleaned up, error: %w", err)
 		}
-	default:
-		return fmt.Errorf("command '%s' is unknown", args[0])
+		return statusResult{Action: command}, nil
 	}
 
-	return nil
+	return nil, invalidf("command '%s' is unknown", args[0])
 }
 
-func main() {
-	s, err := storage.NewLocalStorage()
+// push adds a new record with optional attributes passed as flags
+func (c *Command) push(args []string) (result, error) {
+	fs := flag.NewFlagSet(cmdPush, flag.ContinueOnError)
+	due := fs.String("due", "", "due date, e.g.: tomorrow, \"fri 17:00\", +3d, 2026-11-02")
+	priority := fs.String("p", "none", "priority: high, medium, low or none")
+	var tags stringsFlag
+	fs.Var(&tags, "tag", "tag to label the task with, can be repeated")
+	under := fs.Uint("under", 0, "ID of the parent task to add the task as its subtask")
+	every := fs.String("every", "", "recurrence, e.g.: day, weekdays, monday, \"3 days\", 1st, FREQ=WEEKLY;BYDAY=MO")
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidf("flags can not be parsed, error: %s", err)
+	}
+
+	level, err := storage.ParsePriority(*priority)
 	if err != nil {
-		fmt.Printf("storage can not be accessed or created, error: %s\n", err)
-		os.Exit(1)
+		return nil, err
 	}
 
-	defer func() {
-		if err := s.Close(); err != nil {
-			fmt.Printf("storage can not be closed, error: %s\n", err)
+	var words []string
+	for _, word := range fs.Args() {
+		if len(word) > 1 && strings.HasPrefix(word, "+") {
+			tags = append(tags, word)
+			continue
+		}
+		words = append(words, word)
+	}
+
+	record := storage.Record{Content: strings.Join(words, " "), Priority: level}
+	if record.Content == "" {
+		return nil, invalidf("no content to add")
+	}
+
+	if c.activeList != "" {
+		record.List = &storage.List{Name: c.activeList}
+	}
+
+	if *under != 0 {
+		parent, err := c.storage.GetRecordByID(*under)
+		if err != nil {
+			return nil, fmt.Errorf("parent task %d can not be found, error: %w", *under, err)
+		}
+		record.ParentID = &parent.ID
+		if record.List == nil {
+			record.List = parent.List // subtasks stay in the list of their parent unless another list is active
+		}
+	}
+
+	for _, tag := range tags {
+		record.Tags = append(record.Tags, storage.Tag{Name: tag})
+	}
+
+	if *due != "" {
+		dueAt, err := dateparse.Parse(*due, time.Now())
+		if err != nil {
+			return nil, invalidf("due date can not be parsed, error: %s", err)
+		}
+		record.DueAt = &dueAt
+	}
+
+	if *every != "" {
+		rule, err := recurrence.Parse(*every)
+		if err != nil {
+			return nil, invalidf("recurrence can not be parsed, error: %s", err)
+		}
+		record.Recurrence = rule.String()
+
+		if record.DueAt == nil {
+			dueAt := rule.First(dateparse.EndOfDay(time.Now()))
+			record.DueAt = &dueAt
 		}
+	}
+
+	if err = c.storage.CreateRecord(&record); err != nil {
+		return nil, fmt.Errorf("record can not be added to the database, error: %w", err)
+	}
+
+	return statusResult{Action: cmdPush, ID: record.ID}, nil
+}
+
+// list returns records selected by flags
+func (c *Command) list(args []string) (result, error) {
+	fs := flag.NewFlagSet(cmdList, flag.ContinueOnError)
+	statusFlags := addStatusFlags(fs)
+	sortBy := fs.String("sort", c.sortBy, "sort order: priority, created or due")
+	tag := fs.String("tag", "", "show only tasks labeled by the tag")
+	list := fs.String("l", c.activeList, "show only tasks of the list")
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidf("flags can not be parsed, error: %s", err)
+	}
+
+	status, err := statusFlags.status()
+	if err != nil {
+		return nil, err
+	}
+
+	order, ok := sortToOrder[*sortBy]
+	if !ok {
+		return nil, invalidf("sort order '%s' is unknown", *sortBy)
+	}
+
+	records, err := c.storage.GetRecords(storage.Filter{Status: status, Tag: *tag, List: *list, Order: order})
+	if err != nil {
+		return nil, fmt.Errorf("records can not be displayed, error: %w", err)
+	}
+
+	ids := make([]uint, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+
+	progress, err := c.storage.GetProgress(ids)
+	if err != nil {
+		return nil, fmt.Errorf("records can not be displayed, error: %w", err)
+	}
+
+	return recordsResult{records: records, progress: progress, view: c.view}, nil
+}
+
+// delete deletes records of the active list selected by IDs, ranges of IDs and filters together with their subtasks,
+// both IDs and filters must match when they are combined
+func (c *Command) delete(args []string) (result, error) {
+	fs := flag.NewFlagSet(cmdDelete, flag.ContinueOnError)
+	tag := fs.String("tag", "", "delete only tasks labeled by the tag")
+	olderThan := fs.String("older-than", "", "delete only tasks created earlier than the age, e.g.: 30d, 2w, 12h")
+	done := fs.Bool("done", false, "delete only completed tasks")
+	dryRun := fs.Bool("dry-run", false, "list the tasks which would be deleted without deleting them")
+
+	// IDs and flags may be mixed, e.g.: delete 3,5 --dry-run
+	var specs []string
+	for rest := args; ; rest = fs.Args()[1:] {
+		if err := fs.Parse(rest); err != nil {
+			return nil, invalidf("flags can not be parsed, error: %s", err)
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		specs = append(specs, fs.Arg(0))
+	}
+
+	ids, err := parseIDs(specs)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := storage.Filter{Status: storage.StatusAny, IDs: ids, Tag: *tag, List: c.activeList, Order: storage.OrderOldest}
+	if *done {
+		filter.Status = storage.StatusDone
+	}
+	if *olderThan != "" {
+		if filter.CreatedBefore, err = dateparse.ParseAge(*olderThan, time.Now()); err != nil {
+			return nil, invalidf("age can not be parsed, error: %s", err)
+		}
+	}
+
+	filtered := filter.Tag != "" || filter.Status != storage.StatusAny || !filter.CreatedBefore.IsZero()
+	if len(ids) == 0 && !filtered {
+		return nil, invalidf("IDs or filters are not provided")
+	}
+
+	if *dryRun {
+		return c.deletePreview(filter)
+	}
+
+	if len(ids) == 1 && !filtered && filter.List == "" {
+		if err = c.storage.DeleteRecordByID(ids[0]); err != nil {
+			return nil, fmt.Errorf("record can not be deleted, error: %w", err)
+		}
+		return statusResult{Action: cmdDelete, ID: ids[0]}, nil
+	}
+
+	deleted, err := c.storage.DeleteRecords(filter)
+	if err != nil {
+		return nil, fmt.Errorf("records can not be deleted, error: %w", err)
+	}
+	if deleted == 0 {
+		return nil, fmt.Errorf("no tasks match the IDs and filters, error: %w", storage.ErrNotFound)
+	}
+
+	message := fmt.Sprintf("%d tasks deleted", deleted)
+	if deleted == 1 {
+		message = "1 task deleted"
+	}
+
+	return statusResult{Action: cmdDelete, Message: message}, nil
+}
+
+// deletePreview returns records which delete would remove with the filter, including subtasks of the matched ones
+func (c *Command) deletePreview(filter storage.Filter) (result, error) {
+	matched, err := c.storage.GetRecords(filter)
+	if err != nil {
+		return nil, fmt.Errorf("records can not be displayed, error: %w", err)
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no tasks match the IDs and filters, error: %w", storage.ErrNotFound)
+	}
+
+	all, err := c.storage.GetRecords(storage.Filter{Status: storage.StatusAny, Order: storage.OrderOldest})
+	if err != nil {
+		return nil, fmt.Errorf("records can not be displayed, error: %w", err)
+	}
+
+	selected := make(map[uint]bool, len(matched))
+	for _, record := range matched {
+		selected[record.ID] = true
+	}
+
+	for found := true; found; {
+		found = false
+		for _, record := range all {
+			if !selected[record.ID] && record.ParentID != nil && selected[*record.ParentID] {
+				selected[record.ID], found = true, true
+			}
+		}
+	}
+
+	var records []storage.Record
+	for _, record := range all {
+		if selected[record.ID] {
+			records = append(records, record)
+		}
+	}
+
+	return recordsResult{records: records, view: c.view}, nil
+}
+
+// tui runs the interactive interface over the records of the active list until it is closed
+func (c *Command) tui() (result, error) {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return nil, errors.New("interactive interface requires a terminal")
+	}
+
+	order, ok := sortToOrder[c.sortBy]
+	if !ok {
+		return nil, invalidf("sort order '%s' is unknown", c.sortBy)
+	}
+
+	if err := tui.Run(c.storage, os.Stdin, os.Stdout, tui.Options{List: c.activeList, Order: order}); err != nil {
+		return nil, fmt.Errorf("interactive interface failed, error: %w", err)
+	}
+
+	return statusResult{Action: cmdTUI}, nil
+}
+
+// serve runs the REST API server until the process is interrupted
+func (c *Command) serve(args []string) (result, error) {
+	fs := flag.NewFlagSet(cmdServe, flag.ContinueOnError)
+	addr := fs.String("addr", defaultServeAddr, "address to listen on, keep it on the loopback interface unless the network is trusted")
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidf("flags can not be parsed, error: %s", err)
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return nil, fmt.Errorf("address can not be listened on, error: %w", err)
+	}
+
+	srv := &http.Server{Handler: server.NewHandler(c.storage, *addr), ReadHeaderTimeout: 10 * time.Second}
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(listener)
 	}()
 
-	flag.Usage = func() {
-		for cmd, desc := range cmdToDesc {
-			fmt.Printf("- %s: %s\n", cmd, desc)
+	fmt.Fprintf(os.Stderr, "serving the API on http://%s, press Ctrl+C to stop\n", listener.Addr())
+
+	interrupted, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err = <-served:
+		return nil, fmt.Errorf("server has failed, error: %w", err)
+	case <-interrupted.Done():
+	}
+
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = srv.Shutdown(shutdown); err != nil {
+		return nil, fmt.Errorf("server can not be stopped, error: %w", err)
+	}
+
+	return statusResult{Action: cmdServe, Message: "server is stopped"}, nil
+}
+
+// db inspects and changes the schema of the database with migrate, status and rollback [--to version] subcommands
+func (c *Command) db(args []string) (result, error) {
+	if len(args) == 0 {
+		return nil, invalidf("db subcommand is not provided, expected one of: migrate, status, rollback")
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "status":
+		migrations, err := c.storage.Migrations()
+		if err != nil {
+			return nil, fmt.Errorf("migrations can not be displayed, error: %w", err)
+		}
+		return migrationsResult{migrations: migrations, view: c.view}, nil
+	case "migrate":
+		applied, backup, err := c.storage.Migrate()
+		if err != nil {
+			return nil, fmt.Errorf("schema can not be migrated, error: %w", err)
 		}
+		return statusResult{Action: cmdDb, Message: describeMigrations("applied", applied, backup)}, nil
+	case "rollback":
+		fs := flag.NewFlagSet(cmdDb+" rollback", flag.ContinueOnError)
+		to := fs.Int("to", -1, "version to roll back to, only the latest applied migration is reverted by default")
+		if err := fs.Parse(args[1:]); err != nil {
+			return nil, invalidf("flags can not be parsed, error: %s", err)
+		}
+		version := *to
+		if version < 0 {
+			migrations, err := c.storage.Migrations()
+			if err != nil {
+				return nil, fmt.Errorf("migrations can not be displayed, error: %w", err)
+			}
+			for _, migration := range migrations {
+				if migration.AppliedAt != nil {
+					version = int(migration.Version) - 1
+				}
+			}
+		}
+		if version < 0 {
+			return statusResult{Action: cmdDb, Message: "no migrations are applied"}, nil
+		}
+		reverted, backup, err := c.storage.RollbackMigrations(uint(version))
+		if err != nil {
+			return nil, fmt.Errorf("schema can not be rolled back, error: %w", err)
+		}
+		return statusResult{Action: cmdDb, Message: describeMigrations("rolled back", reverted, backup)}, nil
+	}
+
+	return nil, invalidf("db subcommand '%s' is unknown, expected one of: migrate, status, rollback", args[0])
+}
+
+// backup lists backups of the database with the list subcommand and restores one of them with restore <name>
+func (c *Command) backup(args []string) (result, error) {
+	if len(args) == 0 {
+		return nil, invalidf("backup subcommand is not provided, expected one of: list, restore")
 	}
 
+	switch strings.ToLower(args[0]) {
+	case "list":
+		backups, err := c.storage.Backups()
+		if err != nil {
+			return nil, fmt.Errorf("backups can not be displayed, error: %w", err)
+		}
+		return backupsResult{backups: backups, view: c.view}, nil
+	case "restore":
+		if len(args) < 2 {
+			return nil, invalidf("backup name is not provided")
+		}
+		previous, err := c.storage.RestoreBackup(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("backup can not be restored, error: %w", err)
+		}
+		return statusResult{Action: cmdBackup, Message: fmt.Sprintf("restored %s, the replaced database is saved as %s", args[1], previous.Name)}, nil
+	}
+
+	return nil, invalidf("backup subcommand '%s' is unknown, expected one of: list, restore", args[0])
+}
+
+// encrypt encrypts the plain database with the key derived from a new passphrase or the key file
+func (c *Command) encrypt() (result, error) {
+	if c.local == nil {
+		return nil, errEncryptionUnsupported
+	}
+
+	params, err := c.local.Encryption()
+	if err != nil {
+		return nil, err
+	}
+	if params != nil {
+		return nil, errors.New("database is already encrypted")
+	}
+
+	secret, err := c.keys.secret("new passphrase: ", true)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := storage.NewEncryptionParams()
+	if err != nil {
+		return nil, err
+	}
+
+	key := storage.DeriveKey(secret, created)
+	if _, err = c.local.EncryptData(key, created); err != nil {
+		return nil, fmt.Errorf("database can not be encrypted, error: %w", err)
+	}
+	_ = c.keys.remember(key)
+
+	return statusResult{Action: cmdEncrypt, Message: "database is encrypted, plain copies in the undo history, the trash and backups are deleted"}, nil
+}
+
+// decrypt decrypts the encrypted database back into plain text
+func (c *Command) decrypt() (result, error) {
+	if c.local == nil {
+		return nil, errEncryptionUnsupported
+	}
+
+	params, err := c.local.Encryption()
+	if err != nil {
+		return nil, err
+	}
+	if params == nil {
+		return nil, errors.New("database is not encrypted")
+	}
+
+	key, err := c.keys.unlock(*params)
+	if err != nil {
+		return nil, fmt.Errorf("database can not be unlocked, error: %w", err)
+	}
+
+	if err = c.local.DecryptData(key); err != nil {
+		return nil, fmt.Errorf("database can not be decrypted, error: %w", err)
+	}
+	_ = c.keys.forget()
+
+	return statusResult{Action: cmdDecrypt, Message: "database is decrypted"}, nil
+}
+
+// describeMigrations returns the message listing versions of applied or reverted migrations and the backup path
+func describeMigrations(action string, migrations []storage.Migration, backup string) string {
+	if len(migrations) == 0 {
+		return "schema is up to date, no migrations are " + action
+	}
+
+	versions := make([]string, 0, len(migrations))
+	for _, migration := range migrations {
+		versions = append(versions, strconv.Itoa(int(migration.Version)))
+	}
+
+	message := fmt.Sprintf("%s migrations: %s", action, strings.Join(versions, ", "))
+	if backup != "" {
+		message += ", backup: " + backup
+	}
+
+	return message
+}
+
+// due returns pending records grouped by their due date: overdue, due today and due this week
+func (c *Command) due() (result, error) {
+	now := c.view.now
+	records, err := c.storage.GetRecords(storage.Filter{
+		Status:    storage.StatusPending,
+		DueBefore: dateparse.EndOfWeek(now).Add(time.Second),
+		List:      c.activeList,
+		Order:     storage.OrderDue,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("records can not be displayed, error: %w", err)
+	}
+
+	groups := []struct {
+		title string
+		until time.Time
+	}{
+		{title: "overdue", until: now},
+		{title: "today", until: dateparse.EndOfDay(now)},
+		{title: "this week", until: dateparse.EndOfWeek(now)},
+	}
+
+	entries := make([]dueEntry, 0, len(records))
+	for _, record := range records {
+		for _, group := range groups {
+			if !record.DueAt.After(group.until) {
+				entries = append(entries, dueEntry{Group: group.title, Record: record})
+				break
+			}
+		}
+	}
+
+	return dueResult{entries: entries, view: c.view}, nil
+}
+
+// edit replaces record content, asking for it in the text editor when the content is empty
+func (c *Command) edit(id uint, content string) (result, error) {
+	record, err := c.storage.GetRecordByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("record can not be edited, error: %w", err)
+	}
+
+	if content == "" {
+		if content, err = editInEditor(record.Content); err != nil {
+			return nil, fmt.Errorf("content can not be edited, error: %w", err)
+		}
+	}
+
+	if content == "" {
+		return nil, invalidf("no content to save")
+	}
+
+	if content != record.Content {
+		record.Content = content
+		if err = c.storage.UpdateRecord(&record); err != nil {
+			return nil, fmt.Errorf("record can not be updated, error: %w", err)
+		}
+	}
+
+	return statusResult{Action: cmdEdit, ID: id}, nil
+}
+
+// search returns records matching the full-text query
+func (c *Command) search(query string) (result, error) {
+	results, err := c.storage.SearchRecords(query)
+	if err != nil {
+		return nil, fmt.Errorf("records can not be searched, error: %w", err)
+	}
+
+	return searchResult{results: results, view: c.view}, nil
+}
+
+// export returns all records encoded in the format or writes them into a file
+func (c *Command) export(args []string) (result, error) {
+	fs := flag.NewFlagSet(cmdExport, flag.ContinueOnError)
+	format := fs.String("format", "", "export format: json, csv, md or todotxt, detected by the file extension by default")
+	file := fs.String("file", "", "file to write into instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidf("flags can not be parsed, error: %s", err)
+	}
+
+	if *format == "" {
+		*format = transfer.FormatJSON
+		if *file != "" {
+			detected, err := transfer.FormatByPath(*file)
+			if err != nil {
+				return nil, err
+			}
+			*format = detected
+		}
+	}
+
+	records, err := c.storage.GetRecords(storage.Filter{Order: storage.OrderOldest})
+	if err != nil {
+		return nil, fmt.Errorf("records can not be exported, error: %w", err)
+	}
+
+	var buffer bytes.Buffer
+	if err = transfer.Encode(&buffer, strings.ToLower(*format), records); err != nil {
+		return nil, fmt.Errorf("records can not be encoded, error: %w", err)
+	}
+
+	if *file == "" {
+		return rawResult(buffer.Bytes()), nil
+	}
+
+	if err = os.WriteFile(*file, buffer.Bytes(), 0600); err != nil {
+		return nil, fmt.Errorf("records can not be written, error: %w", err)
+	}
+
+	return statusResult{Action: cmdExport, Message: fmt.Sprintf("exported %d records to %s", len(records), *file)}, nil
+}
+
+// importFile adds records read from a file or stdin, either merging them with the existing ones or replacing them
+func (c *Command) importFile(args []string) (result, error) {
+	fs := flag.NewFlagSet(cmdImport, flag.ContinueOnError)
+	format := fs.String("format", "", "import format: json, csv, md or todotxt, detected by the file extension by default")
+	replace := fs.Bool("replace", false, "delete all the existing tasks before import")
+	if err := fs.Parse(args); err != nil {
+		return nil, invalidf("flags can not be parsed, error: %s", err)
+	}
+
+	if fs.NArg() < 1 {
+		return nil, invalidf("file is not provided, use - to read from stdin")
+	}
+
+	path := fs.Arg(0)
+	if *format == "" {
+		*format = transfer.FormatJSON
+		if path != "-" {
+			detected, err := transfer.FormatByPath(path)
+			if err != nil {
+				return nil, err
+			}
+			*format = detected
+		}
+	}
+
+	input := os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("file can not be opened, error: %w", err)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	records, err := transfer.Decode(input, strings.ToLower(*format))
+	if err != nil {
+		return nil, fmt.Errorf("records can not be decoded, error: %w", err)
+	}
+
+	imported, err := c.storage.ImportRecords(records, *replace)
+	if err != nil {
+		return nil, fmt.Errorf("records can not be imported, error: %w", err)
+	}
+
+	message := fmt.Sprintf("imported %d records, skipped %d duplicates", imported, uint(len(records))-imported)
+
+	return statusResult{Action: cmdImport, Message: message}, nil
+}
+
+// stringsFlag defines a flag which can be passed multiple times
+type stringsFlag []string
+
+// String returns all the flag values joined by comma
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+// Set appends the value to the flag values
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// parseIDs parses record IDs and inclusive ranges of them separated by commas, e.g.: 3,5,7-12
+func parseIDs(specs []string) ([]uint, error) {
+	var ids []uint
+	for _, spec := range specs {
+		for _, part := range strings.Split(spec, ",") {
+			first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+			if !isRange {
+				last = first
+			}
+
+			from, err := strconv.ParseUint(first, 10, 32)
+			if err != nil || from == 0 {
+				return nil, invalidf("ID '%s' is invalid, expected a positive number or a range, e.g.: 7-12", part)
+			}
+
+			to, err := strconv.ParseUint(last, 10, 32)
+			if err != nil || to < from {
+				return nil, invalidf("ID range '%s' is invalid, expected e.g.: 7-12", part)
+			}
+
+			if uint64(len(ids))+to-from >= maxBulkIDs {
+				return nil, invalidf("too many IDs are selected, at most %d are allowed at once", maxBulkIDs)
+			}
+
+			for id := from; id <= to; id++ {
+				ids = append(ids, uint(id))
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+// statusFlags defines flags which select records by their completion status
+type statusFlags struct {
+	all  *bool
+	done *bool
+}
+
+// addStatusFlags registers completion status flags in the flag set
+func addStatusFlags(fs *flag.FlagSet) statusFlags {
+	return statusFlags{
+		all:  fs.Bool("all", false, "include completed tasks"),
+		done: fs.Bool("done", false, "show completed tasks only"),
+	}
+}
+
+// status returns completion status selected by parsed flags
+func (f statusFlags) status() (storage.Status, error) {
+	switch {
+	case *f.all && *f.done:
+		return storage.StatusAny, invalidf("flags --all and --done are mutually exclusive")
+	case *f.all:
+		return storage.StatusAny, nil
+	case *f.done:
+		return storage.StatusDone, nil
+	}
+
+	return storage.StatusPending, nil
+}
+
+// editInEditor opens the content in the user's editor ($VISUAL, $EDITOR or vi) and returns the edited text
+func editInEditor(content string) (string, error) {
+	file, err := os.CreateTemp("", "later-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("temporary file can not be created, error: %w", err)
+	}
+
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+
+	if _, err = file.WriteString(content + "\n"); err != nil {
+		_ = file.Close()
+		return "", fmt.Errorf("temporary file can not be written, error: %w", err)
+	}
+
+	if err = file.Close(); err != nil {
+		return "", fmt.Errorf("temporary file can not be closed, error: %w", err)
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	editorArgs := append(strings.Fields(editor), file.Name())
+	cmd := exec.Command(editorArgs[0], editorArgs[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err = cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor '%s' failed, error: %w", editor, err)
+	}
+
+	edited, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", fmt.Errorf("temporary file can not be read, error: %w", err)
+	}
+
+	return strings.Join(strings.Fields(string(edited)), " "), nil
+}
+
+// isTerminal reports whether the file is a character device, i.e. an interactive terminal
+func isTerminal(file *os.File) bool {
+	stat, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// usage prints supported subcommands and global flags
+func usage() {
+	for cmd, desc := range cmdToDesc {
+		fmt.Printf("- %s: %s\n", cmd, desc)
+	}
+
+	fmt.Println("global flags (passed before the subcommand):")
+	flag.PrintDefaults()
+
+	if path, err := config.Path(); err == nil {
+		fmt.Printf("settings and command aliases are read from %s\n", path)
+	}
+}
+
+// run executes the command passed from the CLI and returns the process exit code
+func run() int {
+	cfg, cfgErr := config.Load()
+
+	defaultList := os.Getenv("LATER_LIST")
+	if defaultList == "" {
+		defaultList = cfg.DefaultList
+	}
+
+	output := flag.String("output", outputTable, "output format: table, json, jsonl or tsv")
+	list := flag.String("l", defaultList, "list (project) to add tasks to and show tasks from, $LATER_LIST or default_list from the config by default")
+	dbPath := flag.String("db", "", "path to the database file or the storage URI, e.g. file:///tasks.json, $LATER_DB by default")
+	profile := flag.String("profile", "", "profile with a separate database file in ~/.later, $LATER_PROFILE by default")
+	keyFile := flag.String("key-file", "", "key file of the encrypted database, $LATER_KEY_FILE or key_file from the config by default")
+	flag.CommandLine.SetOutput(os.Stdout)
+	flag.Usage = usage
 	flag.Parse()
 	args := flag.Args()
 
+	format := strings.ToLower(*output)
+	if !outputFormats[format] {
+		fmt.Printf("output format '%s' is unknown\n", *output)
+		flag.Usage()
+		return 1
+	}
+
+	if cfgErr != nil {
+		return fail(format, cfgErr)
+	}
+
+	v := view{now: time.Now(), layout: defaultTimeLayout, theme: themes["none"]}
+	if cfg.DateFormat != "" {
+		v.layout = cfg.DateFormat
+	}
+
+	themeName := cfg.Theme
+	if themeName == "" {
+		themeName = "default"
+	}
+
+	theme, ok := themes[themeName]
+	if !ok {
+		return fail(format, fmt.Errorf("color theme '%s' is unknown, expected one of: default, bright, none", themeName))
+	}
+
+	if isTerminal(os.Stdout) && format == outputTable {
+		v.theme = theme
+	}
+
+	sortBy := defaultSort
+	if cfg.Sort != "" {
+		sortBy = cfg.Sort
+	}
+
+	var backupKeep int
+	if cfg.BackupKeep != "" {
+		keep, err := strconv.Atoi(cfg.BackupKeep)
+		if err != nil || keep < 1 {
+			return fail(format, fmt.Errorf("number of kept backups '%s' is invalid, expected a positive number", cfg.BackupKeep))
+		}
+		backupKeep = keep
+	}
+
+	var backupEvery time.Duration
+	if cfg.BackupEvery != "" {
+		every, err := time.ParseDuration(cfg.BackupEvery)
+		if err != nil || every <= 0 {
+			return fail(format, fmt.Errorf("backup interval '%s' is invalid, expected a positive duration, e.g.: 24h", cfg.BackupEvery))
+		}
+		backupEvery = every
+	}
+
+	keyCache := defaultKeyCache
+	if cfg.KeyCache != "" {
+		cache, err := time.ParseDuration(cfg.KeyCache)
+		if err != nil || cache < 0 {
+			return fail(format, fmt.Errorf("key cache time '%s' is invalid, expected a duration, e.g.: 15m", cfg.KeyCache))
+		}
+		keyCache = cache
+	}
+
+	if len(args) > 0 {
+		args = expandAlias(args, cfg.Aliases)
+	}
+
 	if len(args) == 0 {
+		if format != outputTable {
+			return fail(format, errors.New("no subcommands provided"))
+		}
 		fmt.Println("no subcommands provided, list of supported subcommands:")
 		flag.Usage()
-		os.Exit(1)
+		return 1
 	}
 
-	command := NewCommand(s)
-	if err := command.handle(args); err != nil {
-		fmt.Printf("command error: %s\n", err)
-		flag.Usage()
-		os.Exit(1)
+	// the db command inspects and changes the schema itself, so it is not migrated on open
+	options := storage.Options{SkipMigrations: strings.ToLower(args[0]) == cmdDb, BackupLimit: backupKeep}
+
+	s, err := openStorage(*dbPath, *profile, cfg.DB, options)
+	if err != nil {
+		return fail(format, fmt.Errorf("storage can not be accessed or created, error: %w", err))
 	}
+
+	defer func() {
+		if err := s.Close(); err != nil {
+			fmt.Printf("storage can not be closed, error: %s\n", err)
+		}
+	}()
+
+	// encryption and scheduled backups are features of the sqlite database, other backends are used as they are
+	local, _ := s.(*storage.LocalStorage)
+	keys := &keyring{keyFile: firstNonEmpty(*keyFile, os.Getenv("LATER_KEY_FILE"), cfg.KeyFile), cacheTTL: keyCache}
+	if local != nil {
+		keys.dbPath = local.Path()
+	}
+
+	// commands working with the database as a whole do not need the key
+	active := s
+	switch strings.ToLower(args[0]) {
+	case cmdDb, cmdLock, cmdEncrypt, cmdDecrypt:
+	default:
+		if local == nil {
+			break
+		}
+		params, err := local.Encryption()
+		if err != nil {
+			return fail(format, err)
+		}
+		if params != nil {
+			key, err := keys.unlock(*params)
+			if err != nil {
+				return fail(format, fmt.Errorf("database can not be unlocked, error: %w", err))
+			}
+			if active, err = storage.NewEncryptedStorage(local, key, *params); err != nil {
+				return fail(format, fmt.Errorf("database can not be unlocked, error: %w", err))
+			}
+		}
+	}
+
+	if backupEvery > 0 && local != nil {
+		if _, err = local.BackupIfDue(backupEvery); err != nil {
+			return fail(format, fmt.Errorf("scheduled backup can not be made, error: %w", err))
+		}
+	}
+
+	command := NewCommand(active, *list, sortBy, v)
+	command.local, command.keys = local, keys
+	res, err := command.handle(args)
+	if err != nil {
+		// the list of commands helps with mistyped commands only, not with missing tasks
+		code := fail(format, err)
+		if format == outputTable && (code == exitInvalid || code == exitFailure) {
+			flag.Usage()
+		}
+		return code
+	}
+
+	if err = render(os.Stdout, format, res); err != nil {
+		fmt.Printf("output can not be written, error: %s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// expandAlias replaces the configured alias of a command with the command and its arguments,
+// built-in commands can not be overridden by aliases
+func expandAlias(args []string, aliases map[string]string) []string {
+	alias, ok := aliases[args[0]]
+	if _, builtin := cmdToDesc[strings.ToLower(args[0])]; !ok || builtin {
+		return args
+	}
+
+	return append(splitArgs(alias), args[1:]...)
+}
+
+// splitArgs splits the command line into arguments by spaces, keeping single or double quoted parts together
+func splitArgs(line string) []string {
+	var args []string
+	var current strings.Builder
+	quote, started := rune(0), false
+	for _, char := range line {
+		switch {
+		case quote != 0 && char == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(char)
+		case char == '"' || char == '\'':
+			quote, started = char, true
+		case char == ' ' || char == '\t':
+			if started {
+				args = append(args, current.String())
+				current.Reset()
+				started = false
+			}
+		default:
+			current.WriteRune(char)
+			started = true
+		}
+	}
+
+	if started {
+		args = append(args, current.String())
+	}
+
+	return args
+}
+
+// firstNonEmpty returns the first of the values which is not empty
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// openStorage opens the storage by the database path or the profile name passed as flags,
+// falling back to the environment variables, then to the configured path and then to the default storage
+func openStorage(dbPath, profile, configured string, options storage.Options) (storage.Storage, error) {
+	if dbPath != "" && profile != "" {
+		return nil, errors.New("database path and profile can not be used together")
+	}
+
+	switch {
+	case dbPath != "":
+		return openDatabase(dbPath, options)
+	case profile != "":
+		return storage.NewProfileLocalStorage(profile, options)
+	case os.Getenv("LATER_DB") != "":
+		return openDatabase(os.Getenv("LATER_DB"), options)
+	case os.Getenv("LATER_PROFILE") == "" && configured != "":
+		return openDatabase(configured, options)
+	}
+
+	return storage.NewProfileLocalStorage(os.Getenv("LATER_PROFILE"), options)
+}
+
+// openDatabase opens the storage by its URI, e.g. memory:// or file:///tasks.json, or the sqlite database by its path
+func openDatabase(location string, options storage.Options) (storage.Storage, error) {
+	if strings.Contains(location, "://") {
+		return storage.Open(location, options)
+	}
+
+	return storage.NewFileLocalStorage(location, options)
+}
+
+// fail writes the error in the output format and returns the process exit code
+func fail(format string, err error) int {
+	failure := errorResult{Message: err.Error(), Code: exitCode(err)}
+	_ = render(os.Stdout, format, failure)
+
+	return failure.Code
+}
+
+// exitCode returns the process exit code matching the kind of the error
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrInvalidInput):
+		return exitInvalid
+	case errors.Is(err, storage.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, storage.ErrEmpty):
+		return exitEmpty
+	}
+
+	return exitFailure
+}
+
+func main() {
+	os.Exit(run())
 }
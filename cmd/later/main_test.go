@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/manmolecular/go-later/internal/pkg/storage"
+)
+
+// newTestCommand returns the command working with a new memory storage holding the records and the active list
+func newTestCommand(t *testing.T, list string, records ...storage.Record) *Command {
+	t.Helper()
+
+	s, err := storage.NewMemoryStorage()
+	if err != nil {
+		t.Fatalf("memory storage can not be created, unexpected error: %s", err)
+	}
+
+	for i := range records {
+		if err := s.CreateRecord(&records[i]); err != nil {
+			t.Fatalf("record can not be created, unexpected error: %s", err)
+		}
+	}
+
+	return NewCommand(s, list, "priority", view{})
+}
+
+// remainingIDs returns IDs of all the records left in the storage of the command, the oldest first
+func remainingIDs(t *testing.T, c *Command) []uint {
+	t.Helper()
+
+	records, err := c.storage.GetRecords(storage.Filter{Status: storage.StatusAny, Order: storage.OrderOldest})
+	if err != nil {
+		t.Fatalf("records can not be retrieved, unexpected error: %s", err)
+	}
+
+	ids := make([]uint, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+
+	return ids
+}
+
+// TestParseIDs checks parsing of IDs and ranges of them and rejection of invalid and oversized selections
+func TestParseIDs(t *testing.T) {
+	cases := []struct {
+		specs    []string
+		expected []uint
+	}{
+		{specs: []string{"3,5,7-12"}, expected: []uint{3, 5, 7, 8, 9, 10, 11, 12}},
+		{specs: []string{"1", " 2 ,4-4"}, expected: []uint{1, 2, 4}},
+		{specs: []string{"4294967295"}, expected: []uint{4294967295}},
+	}
+
+	for _, c := range cases {
+		ids, err := parseIDs(c.specs)
+		if err != nil {
+			t.Errorf("IDs %q can not be parsed, unexpected error: %s", c.specs, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(ids, c.expected) {
+			t.Errorf("IDs %q expected to be parsed as %v, got: %v", c.specs, c.expected, ids)
+		}
+	}
+
+	if ids, err := parseIDs([]string{"1-10000"}); err != nil || len(ids) != maxBulkIDs {
+		t.Errorf("%d IDs expected to be allowed at once, got %d, error: %v", maxBulkIDs, len(ids), err)
+	}
+
+	invalid := [][]string{
+		{"0"}, {"0-3"}, {"5-3"}, {"-3"}, {"3-"}, {"a"}, {"3,,5"}, {"1-2-3"},
+		{"4294967296"}, {"1-4294967296"}, {"18446744073709551616"},
+		{"1-10001"}, {"1-5000", "6000-11000"}, {"1-4294967295"},
+	}
+	for _, specs := range invalid {
+		if ids, err := parseIDs(specs); !errors.Is(err, storage.ErrInvalidInput) {
+			t.Errorf("IDs %q expected to be rejected as invalid input, got: %v, error: %v", specs, ids, err)
+		}
+	}
+}
+
+// TestDeleteArguments checks that IDs and flags of delete may be mixed in any order and that the active list
+// limits the deleted records
+func TestDeleteArguments(t *testing.T) {
+	home := []storage.Tag{{Name: "home"}}
+	records := []storage.Record{
+		{Content: "first", Tags: home},
+		{Content: "second"},
+		{Content: "third", Tags: home},
+		{Content: "fourth", Tags: home, List: &storage.List{Name: "work"}},
+	}
+
+	c := newTestCommand(t, "", records...)
+	preview, err := c.handle([]string{cmdDelete, "1,2", "--dry-run", "3"})
+	if err != nil {
+		t.Fatalf("deletion can not be previewed, unexpected error: %s", err)
+	}
+
+	if previewed := preview.(recordsResult).records; len(previewed) != 3 || len(remainingIDs(t, c)) != 4 {
+		t.Errorf("3 records expected to be previewed and none deleted, got: %v, left: %v", previewed, remainingIDs(t, c))
+	}
+
+	if _, err = c.handle([]string{cmdDelete, "1", "--tag", "home", "2-3"}); err != nil {
+		t.Fatalf("records can not be deleted, unexpected error: %s", err)
+	}
+
+	if left := remainingIDs(t, c); !reflect.DeepEqual(left, []uint{2, 4}) {
+		t.Errorf("only the tagged records among the IDs expected to be deleted, left: %v", left)
+	}
+
+	if _, err = c.handle([]string{cmdDelete, "--tag"}); !errors.Is(err, storage.ErrInvalidInput) {
+		t.Errorf("flag without a value expected to be rejected as invalid input, got: %v", err)
+	}
+
+	c = newTestCommand(t, "work", records...)
+	if _, err = c.handle([]string{cmdDelete, "--tag", "home"}); err != nil {
+		t.Fatalf("records can not be deleted, unexpected error: %s", err)
+	}
+
+	if left := remainingIDs(t, c); !reflect.DeepEqual(left, []uint{1, 2, 3}) {
+		t.Errorf("only the tagged record of the active list expected to be deleted, left: %v", left)
+	}
+
+	if _, err = c.handle([]string{cmdDelete, "1"}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("record out of the active list expected not to be found, got: %v", err)
+	}
+
+	if left := remainingIDs(t, c); !reflect.DeepEqual(left, []uint{1, 2, 3}) {
+		t.Errorf("records out of the active list expected to be kept, left: %v", left)
+	}
+}
+
+// TestExitCodes checks that failed commands exit with the code telling what went wrong
+func TestExitCodes(t *testing.T) {
+	cases := []struct {
+		args []string
+		code int
+	}{
+		{args: []string{cmdShow, "7"}, code: exitNotFound},
+		{args: []string{cmdDone, "7"}, code: exitNotFound},
+		{args: []string{cmdDelete, "7"}, code: exitNotFound},
+		{args: []string{cmdPop}, code: exitEmpty},
+		{args: []string{cmdShow, "abc"}, code: exitInvalid},
+		{args: []string{cmdDone}, code: exitInvalid},
+		{args: []string{cmdPrio, "1", "urgent"}, code: exitInvalid},
+		{args: []string{cmdDelete, "0"}, code: exitInvalid},
+		{args: []string{"unknown"}, code: exitInvalid},
+	}
+
+	for _, c := range cases {
+		_, err := newTestCommand(t, "").handle(c.args)
+		if err == nil {
+			t.Errorf("command %q expected to fail", c.args)
+			continue
+		}
+
+		if code := exitCode(err); code != c.code {
+			t.Errorf("command %q expected to exit with %d, got: %d, error: %s", c.args, c.code, code, err)
+		}
+	}
+
+	if code := exitCode(errors.New("disk is full")); code != exitFailure {
+		t.Errorf("other failures expected to exit with %d, got: %d", exitFailure, code)
+	}
+}
+
+// TestKeyCache checks that keys are cached only in the private user runtime directory
+func TestKeyCache(t *testing.T) {
+	keys := &keyring{dbPath: "later.db", cacheTTL: time.Minute}
+	key := bytes.Repeat([]byte{7}, storage.KeySize)
+
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	t.Setenv("TMPDIR", t.TempDir())
+	if err := keys.remember(key); err != nil {
+		t.Fatalf("key expected not to be cached without error, got: %s", err)
+	}
+
+	if _, ok := keys.cached(); ok {
+		t.Errorf("key expected not to be cached without the runtime directory")
+	}
+
+	if written, _ := filepath.Glob(filepath.Join(os.TempDir(), "*")); len(written) != 0 {
+		t.Errorf("key expected not to be written into the temporary directory, got: %v", written)
+	}
+
+	if err := keys.forget(); err != nil {
+		t.Errorf("key expected to be forgotten without the runtime directory, got: %s", err)
+	}
+
+	runtimeDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	if err := keys.remember(key); err != nil {
+		t.Fatalf("key can not be cached, unexpected error: %s", err)
+	}
+
+	if cached, ok := keys.cached(); !ok || !bytes.Equal(cached, key) {
+		t.Errorf("key expected to be cached in the runtime directory, got: %x", cached)
+	}
+
+	if err := os.Chmod(filepath.Join(runtimeDir, "later"), 0755); err != nil {
+		t.Fatalf("cache directory permissions can not be changed, unexpected error: %s", err)
+	}
+
+	if _, ok := keys.cached(); ok {
+		t.Errorf("key expected not to be read from the cache directory accessible by other users")
+	}
+}
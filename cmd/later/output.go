@@ -0,0 +1,595 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/manmolecular/go-later/internal/pkg/dateparse"
+	"github.com/manmolecular/go-later/internal/pkg/recurrence"
+	"github.com/manmolecular/go-later/internal/pkg/storage"
+	"github.com/manmolecular/go-later/internal/pkg/transfer"
+)
+
+const (
+	outputTable = "table" // human-readable output
+	outputJSON  = "json"  // a single JSON document
+	outputJSONL = "jsonl" // one JSON document per line, e.g. per record
+	outputTSV   = "tsv"   // tab-separated values with a header
+)
+
+var outputFormats = map[string]bool{
+	outputTable: true,
+	outputJSON:  true,
+	outputJSONL: true,
+	outputTSV:   true,
+}
+
+// theme defines terminal colors of the human-readable output, empty colors are not applied
+type theme struct {
+	highlight string // matched terms of search results
+	overdue   string // marker of overdue records
+	done      string // completed records
+}
+
+// colorReset resets terminal colors
+const colorReset = "\033[0m"
+
+// themes maps names of color themes to their colors
+var themes = map[string]theme{
+	"default": {highlight: "\033[1;33m"},
+	"bright":  {highlight: "\033[1;30;103m", overdue: "\033[1;91m", done: "\033[2m"},
+	"none":    {},
+}
+
+// view defines how records are printed in the human-readable form
+type view struct {
+	now    time.Time // moment overdue records are detected at
+	layout string    // layout of printed timestamps
+	theme  theme
+}
+
+// paint returns the text in the color, the text is kept as is if the color is empty
+func paint(text, color string) string {
+	if color == "" || text == "" {
+		return text
+	}
+
+	return color + text + colorReset
+}
+
+// treeIndent defines indentation of subtasks per level of the hierarchy
+const treeIndent = "    "
+
+// recordHeader defines columns of records in tsv output
+var recordHeader = []string{"id", "created_at", "content", "done", "priority", "due_at", "completed_at", "updated_at", "tags", "list", "recurrence", "parent_id"}
+
+// result defines an outcome of a command which can be rendered in any of the output formats
+type result interface {
+	// table writes the result in a human-readable form
+	table(w io.Writer)
+	// value returns the data encoded in json formats, slices are written element by element in jsonl
+	value() interface{}
+	// rows returns the header and the rows written in tsv format
+	rows() ([]string, [][]string)
+}
+
+// render writes the result in the output format
+func render(w io.Writer, format string, res result) error {
+	if raw, ok := res.(rawResult); ok {
+		_, err := w.Write(raw)
+		return err
+	}
+
+	switch format {
+	case outputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(res.value())
+	case outputJSONL:
+		encoder := json.NewEncoder(w)
+		value := reflect.ValueOf(res.value())
+		if value.Kind() != reflect.Slice {
+			return encoder.Encode(res.value())
+		}
+		for i := 0; i < value.Len(); i++ {
+			if err := encoder.Encode(value.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case outputTSV:
+		header, rows := res.rows()
+		spaces := strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+		for _, row := range append([][]string{header}, rows...) {
+			fields := make([]string, 0, len(row))
+			for _, field := range row {
+				fields = append(fields, spaces.Replace(field))
+			}
+			if _, err := fmt.Fprintln(w, strings.Join(fields, "\t")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	res.table(w)
+
+	return nil
+}
+
+// rawResult defines data already encoded by a command in its own format, it is written as is in every output format
+type rawResult []byte
+
+func (r rawResult) table(w io.Writer) {
+	_, _ = w.Write(r)
+}
+
+func (r rawResult) value() interface{} {
+	return string(r)
+}
+
+func (r rawResult) rows() ([]string, [][]string) {
+	return []string{"data"}, [][]string{{string(r)}}
+}
+
+// errorResult defines a command failure in the machine-readable output formats
+type errorResult struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+func (r errorResult) table(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "command error: %s\n", r.Message)
+}
+
+func (r errorResult) value() interface{} {
+	return map[string]errorResult{"error": r}
+}
+
+func (r errorResult) rows() ([]string, [][]string) {
+	return []string{"error", "code"}, [][]string{{r.Message, strconv.Itoa(r.Code)}}
+}
+
+// statusResult defines an outcome of a command changing records
+type statusResult struct {
+	Action  string `json:"action"`
+	ID      uint   `json:"id,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (r statusResult) table(w io.Writer) {
+	if r.Message != "" {
+		_, _ = fmt.Fprintln(w, r.Message)
+	}
+}
+
+func (r statusResult) value() interface{} {
+	return r
+}
+
+func (r statusResult) rows() ([]string, [][]string) {
+	id := ""
+	if r.ID != 0 {
+		id = strconv.Itoa(int(r.ID))
+	}
+
+	return []string{"action", "id", "message"}, [][]string{{r.Action, id, r.Message}}
+}
+
+// recordResult defines a single record, its content is printed in the human-readable form
+type recordResult storage.Record
+
+func (r recordResult) table(w io.Writer) {
+	_, _ = fmt.Fprintln(w, r.Content)
+}
+
+func (r recordResult) value() interface{} {
+	return storage.Record(r)
+}
+
+func (r recordResult) rows() ([]string, [][]string) {
+	return recordHeader, [][]string{recordRow(storage.Record(r))}
+}
+
+// recordsResult defines a list of records, subtasks are printed under their parents with progress counters
+type recordsResult struct {
+	records  []storage.Record
+	progress map[uint]storage.Progress
+	view     view
+}
+
+func (r recordsResult) table(w io.Writer) {
+	listed := make(map[uint]bool, len(r.records))
+	for _, record := range r.records {
+		listed[record.ID] = true
+	}
+
+	var roots []storage.Record
+	subtasks := make(map[uint][]storage.Record)
+	for _, record := range r.records {
+		if record.ParentID != nil && listed[*record.ParentID] {
+			subtasks[*record.ParentID] = append(subtasks[*record.ParentID], record)
+			continue
+		}
+		roots = append(roots, record) // subtasks of parents which are not listed are printed at the top level
+	}
+
+	var printTree func(records []storage.Record, depth int)
+	printTree = func(records []storage.Record, depth int) {
+		for _, record := range records {
+			content := record.Content
+			if progress, ok := r.progress[record.ID]; ok {
+				content += fmt.Sprintf(" [%d/%d]", progress.Done, progress.Total)
+			}
+			_, _ = fmt.Fprintln(w, strings.Repeat(treeIndent, depth)+formatRecord(record, content, r.view))
+			printTree(subtasks[record.ID], depth+1)
+		}
+	}
+	printTree(roots, 0)
+}
+
+func (r recordsResult) value() interface{} {
+	if r.records == nil {
+		return []storage.Record{}
+	}
+
+	return r.records
+}
+
+func (r recordsResult) rows() ([]string, [][]string) {
+	rows := make([][]string, 0, len(r.records))
+	for _, record := range r.records {
+		rows = append(rows, recordRow(record))
+	}
+
+	return recordHeader, rows
+}
+
+// listsResult defines lists with the number of their records
+type listsResult []storage.ListCount
+
+func (r listsResult) table(w io.Writer) {
+	for _, list := range r {
+		name := list.Name
+		if name == "" {
+			name = "(no list)"
+		}
+		_, _ = fmt.Fprintf(w, "%s (%d)\n", name, list.Count)
+	}
+}
+
+func (r listsResult) value() interface{} {
+	if r == nil {
+		return []storage.ListCount{}
+	}
+
+	return []storage.ListCount(r)
+}
+
+func (r listsResult) rows() ([]string, [][]string) {
+	rows := make([][]string, 0, len(r))
+	for _, list := range r {
+		rows = append(rows, []string{list.Name, strconv.Itoa(int(list.Count))})
+	}
+
+	return []string{"name", "count"}, rows
+}
+
+// countResult defines the number of records
+type countResult uint
+
+func (r countResult) table(w io.Writer) {
+	_, _ = fmt.Fprintln(w, uint(r))
+}
+
+func (r countResult) value() interface{} {
+	return map[string]uint{"count": uint(r)}
+}
+
+func (r countResult) rows() ([]string, [][]string) {
+	return []string{"count"}, [][]string{{strconv.Itoa(int(r))}}
+}
+
+// tagsResult defines tags with the number of records labeled by them
+type tagsResult []storage.TagCount
+
+func (r tagsResult) table(w io.Writer) {
+	for _, tag := range r {
+		_, _ = fmt.Fprintf(w, "+%s (%d)\n", tag.Name, tag.Count)
+	}
+}
+
+func (r tagsResult) value() interface{} {
+	if r == nil {
+		return []storage.TagCount{}
+	}
+
+	return []storage.TagCount(r)
+}
+
+func (r tagsResult) rows() ([]string, [][]string) {
+	rows := make([][]string, 0, len(r))
+	for _, tag := range r {
+		rows = append(rows, []string{tag.Name, strconv.Itoa(int(tag.Count))})
+	}
+
+	return []string{"name", "count"}, rows
+}
+
+// migrationsResult defines schema migrations with the time they have been applied at
+type migrationsResult struct {
+	migrations []storage.Migration
+	view       view
+}
+
+func (r migrationsResult) table(w io.Writer) {
+	for _, migration := range r.migrations {
+		state := "pending"
+		if migration.AppliedAt != nil {
+			state = "applied at " + migration.AppliedAt.Format(r.view.layout)
+		}
+		_, _ = fmt.Fprintf(w, "%d. %s (%s)\n", migration.Version, migration.Description, state)
+	}
+}
+
+func (r migrationsResult) value() interface{} {
+	if r.migrations == nil {
+		return []storage.Migration{}
+	}
+
+	return r.migrations
+}
+
+func (r migrationsResult) rows() ([]string, [][]string) {
+	rows := make([][]string, 0, len(r.migrations))
+	for _, migration := range r.migrations {
+		rows = append(rows, []string{strconv.Itoa(int(migration.Version)), migration.Description, formatOptionalTime(migration.AppliedAt)})
+	}
+
+	return []string{"version", "description", "applied_at"}, rows
+}
+
+// backupsResult defines backups of the database, the latest first
+type backupsResult struct {
+	backups []storage.Backup
+	view    view
+}
+
+func (r backupsResult) table(w io.Writer) {
+	for _, backup := range r.backups {
+		_, _ = fmt.Fprintf(w, "%s (%s, %s, %d KB)\n", backup.Name, backup.Reason, backup.CreatedAt.Format(r.view.layout), (backup.Size+1023)/1024)
+	}
+}
+
+func (r backupsResult) value() interface{} {
+	if r.backups == nil {
+		return []storage.Backup{}
+	}
+
+	return r.backups
+}
+
+func (r backupsResult) rows() ([]string, [][]string) {
+	rows := make([][]string, 0, len(r.backups))
+	for _, backup := range r.backups {
+		rows = append(rows, []string{backup.Name, backup.Reason, formatOptionalTime(&backup.CreatedAt), strconv.FormatInt(backup.Size, 10), backup.Path})
+	}
+
+	return []string{"name", "reason", "created_at", "size", "path"}, rows
+}
+
+// searchResult defines records matching a search query, matched terms are highlighted
+// with the theme colors in the human-readable form and with "**" in the other formats
+type searchResult struct {
+	results []storage.SearchResult
+	view    view
+}
+
+func (r searchResult) table(w io.Writer) {
+	start, end := "", ""
+	if r.view.theme.highlight != "" {
+		start, end = r.view.theme.highlight, colorReset
+	}
+	markers := strings.NewReplacer(storage.HighlightStart, start, storage.HighlightEnd, end)
+
+	for _, result := range r.results {
+		_, _ = fmt.Fprintln(w, formatRecord(result.Record, markers.Replace(result.Snippet), r.view))
+	}
+}
+
+func (r searchResult) value() interface{} {
+	markers := strings.NewReplacer(storage.HighlightStart, "**", storage.HighlightEnd, "**")
+
+	results := make([]storage.SearchResult, 0, len(r.results))
+	for _, result := range r.results {
+		result.Snippet = markers.Replace(result.Snippet)
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func (r searchResult) rows() ([]string, [][]string) {
+	markers := strings.NewReplacer(storage.HighlightStart, "**", storage.HighlightEnd, "**")
+
+	rows := make([][]string, 0, len(r.results))
+	for _, result := range r.results {
+		rows = append(rows, append(recordRow(result.Record), markers.Replace(result.Snippet)))
+	}
+
+	return append(recordHeader[:len(recordHeader):len(recordHeader)], "snippet"), rows
+}
+
+// syncResult defines changes made by a todo.txt synchronization
+type syncResult transfer.SyncReport
+
+func (r syncResult) table(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "created: %d, updated: %d, deleted: %d, written to the file: %d\n", r.Created, r.Updated, r.Deleted, r.Written)
+}
+
+func (r syncResult) value() interface{} {
+	return transfer.SyncReport(r)
+}
+
+func (r syncResult) rows() ([]string, [][]string) {
+	return []string{"created", "updated", "deleted", "written"}, [][]string{{
+		strconv.Itoa(int(r.Created)), strconv.Itoa(int(r.Updated)), strconv.Itoa(int(r.Deleted)), strconv.Itoa(int(r.Written)),
+	}}
+}
+
+// dueEntry defines a record with the due date group it belongs to
+type dueEntry struct {
+	Group  string         `json:"group"`
+	Record storage.Record `json:"record"`
+}
+
+// dueResult defines pending records grouped by their due date
+type dueResult struct {
+	entries []dueEntry
+	view    view
+}
+
+func (r dueResult) table(w io.Writer) {
+	if len(r.entries) == 0 {
+		_, _ = fmt.Fprintln(w, "nothing is due this week")
+		return
+	}
+
+	group := ""
+	for _, entry := range r.entries {
+		if entry.Group != group {
+			group = entry.Group
+			_, _ = fmt.Fprintf(w, "%s:\n", group)
+		}
+		_, _ = fmt.Fprintln(w, formatRecord(entry.Record, entry.Record.Content, r.view))
+	}
+}
+
+func (r dueResult) value() interface{} {
+	if r.entries == nil {
+		return []dueEntry{}
+	}
+
+	return r.entries
+}
+
+func (r dueResult) rows() ([]string, [][]string) {
+	rows := make([][]string, 0, len(r.entries))
+	for _, entry := range r.entries {
+		rows = append(rows, append([]string{entry.Group}, recordRow(entry.Record)...))
+	}
+
+	return append([]string{"group"}, recordHeader...), rows
+}
+
+// formatRecord returns a single record line in a human-readable format with the content given separately
+func formatRecord(record storage.Record, content string, v view) string {
+	marker := ""
+	details := []string{"created at: " + record.CreatedAt.Format(v.layout)}
+
+	if record.DueAt != nil {
+		details = append(details, "due: "+dateparse.Format(*record.DueAt))
+		if !record.Done && record.DueAt.Before(v.now) {
+			marker = paint("[overdue]", v.theme.overdue) + " "
+		}
+	}
+
+	if record.UpdatedAt != nil {
+		details = append(details, "edited at: "+record.UpdatedAt.Format(v.layout))
+	}
+
+	if record.List != nil {
+		details = append(details, "list: "+record.List.Name)
+	}
+
+	if record.Recurrence != "" {
+		details = append(details, "repeats: "+describeRecurrence(record.Recurrence))
+	}
+
+	if record.Done {
+		marker = "[x] "
+		if record.CompletedAt != nil {
+			details = append(details, "completed at: "+record.CompletedAt.Format(v.layout))
+		}
+	}
+
+	for _, tag := range record.Tags {
+		if strings.HasPrefix(tag.Name, "@") {
+			content += " " + tag.Name // todo.txt context
+			continue
+		}
+		content += " +" + tag.Name
+	}
+
+	line := fmt.Sprintf("%d. %s%s%s (%s)", record.ID, marker, priorityToMarker[record.Priority], content, strings.Join(details, ", "))
+	if record.Done {
+		return paint(line, v.theme.done)
+	}
+
+	return line
+}
+
+// recordRow returns record fields in the order of recordHeader
+func recordRow(record storage.Record) []string {
+	tags := make([]string, 0, len(record.Tags))
+	for _, tag := range record.Tags {
+		tags = append(tags, tag.Name)
+	}
+
+	return []string{
+		strconv.Itoa(int(record.ID)),
+		record.CreatedAt.Format(time.RFC3339),
+		record.Content,
+		strconv.FormatBool(record.Done),
+		record.Priority.String(),
+		formatOptionalTime(record.DueAt),
+		formatOptionalTime(record.CompletedAt),
+		formatOptionalTime(record.UpdatedAt),
+		strings.Join(tags, ","),
+		listName(record),
+		record.Recurrence,
+		formatOptionalID(record.ParentID),
+	}
+}
+
+// describeRecurrence returns the human-readable recurrence or the raw rule if it can not be parsed
+func describeRecurrence(value string) string {
+	rule, err := recurrence.Parse(value)
+	if err != nil {
+		return value
+	}
+
+	return rule.Describe()
+}
+
+// listName returns the name of the record list or an empty string if the record does not belong to any list
+func listName(record storage.Record) string {
+	if record.List == nil {
+		return ""
+	}
+
+	return record.List.Name
+}
+
+// formatOptionalTime returns the time in RFC 3339 format or an empty string if the time is not set
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+// formatOptionalID returns the ID or an empty string if the ID is not set
+func formatOptionalID(id *uint) string {
+	if id == nil {
+		return ""
+	}
+
+	return strconv.Itoa(int(*id))
+}
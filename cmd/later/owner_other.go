@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package main
+
+import "os"
+
+// ownedByUser returns false, as file owners are not known on the platform, so that keys are never cached there
+func ownedByUser(os.FileInfo) bool {
+	return false
+}
@@ -3,6 +3,7 @@ module github.com/manmolecular/go-later
 go 1.20
 
 require (
+	github.com/mattn/go-sqlite3 v1.14.17
 	gorm.io/driver/sqlite v1.5.3
 	gorm.io/gorm v1.25.4
 )
@@ -10,5 +11,4 @@ require (
 require (
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
-	github.com/mattn/go-sqlite3 v1.14.17 // indirect
 )
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	configDir  = "later"
+	configFile = "config"
+)
+
+const sectionAliases = "aliases"
+
+// Config defines user settings, empty values mean that defaults are used
+type Config struct {
+	DB          string            // path to the database file, "~/" is expanded to the home directory
+	DateFormat  string            // layout of timestamps printed by list, in Go time format, e.g. "02 Jan 15:04"
+	Sort        string            // default sort order of list
+	DefaultList string            // list used when no list is passed with -l or $LATER_LIST
+	Theme       string            // color theme of the terminal output
+	BackupEvery string            // interval of scheduled backups in Go duration format, e.g. "24h", off when empty
+	BackupKeep  string            // number of the latest backups kept
+	KeyFile     string            // path to the key file of the encrypted database, "~/" is expanded to the home directory
+	KeyCache    string            // time the key of the encrypted database is cached for in Go duration format, "0s" to disable
+	Aliases     map[string]string // command aliases expanded into the command with arguments, e.g. "ls" = "list --all"
+}
+
+// Path returns the location of the config file: $XDG_CONFIG_HOME/later/config or ~/.config/later/config
+func Path() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, configDir, configFile), nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("can not locate home directory, error: %s", err)
+	}
+
+	return filepath.Join(homeDir, ".config", configDir, configFile), nil
+}
+
+// Load reads the config file, a missing file results in the empty config
+func Load() (Config, error) {
+	path, err := Path()
+	if err != nil {
+		return Config{}, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Config{}, nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("config file can not be opened, error: %s", err)
+	}
+	defer file.Close()
+
+	config, err := Parse(file)
+	if err != nil {
+		return config, fmt.Errorf("config file %s is invalid, error: %s", path, err)
+	}
+
+	return config, nil
+}
+
+// Parse reads the config in a subset of TOML: "key = value" pairs with quoted string values,
+// "#" comments and the [aliases] table
+func Parse(r io.Reader) (Config, error) {
+	config := Config{Aliases: map[string]string{}}
+	settings := map[string]*string{
+		"db":           &config.DB,
+		"date_format":  &config.DateFormat,
+		"sort":         &config.Sort,
+		"default_list": &config.DefaultList,
+		"theme":        &config.Theme,
+		"backup_every": &config.BackupEvery,
+		"backup_keep":  &config.BackupKeep,
+		"key_file":     &config.KeyFile,
+		"key_cache":    &config.KeyCache,
+	}
+
+	section := ""
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") {
+			end := strings.Index(text, "]")
+			if end < 0 || strings.TrimSpace(text[end+1:]) != "" && !strings.HasPrefix(strings.TrimSpace(text[end+1:]), "#") {
+				return config, fmt.Errorf("line %d: table header is invalid", line)
+			}
+			section = strings.TrimSpace(text[1:end])
+			if section != sectionAliases {
+				return config, fmt.Errorf("line %d: table '%s' is unknown", line, section)
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return config, fmt.Errorf("line %d: expected key = value", line)
+		}
+
+		key = unquoteKey(strings.TrimSpace(key))
+		parsed, err := parseString(strings.TrimSpace(value))
+		if err != nil {
+			return config, fmt.Errorf("line %d: value of '%s' is invalid, error: %s", line, key, err)
+		}
+
+		if section == sectionAliases {
+			config.Aliases[key] = parsed
+			continue
+		}
+
+		setting, ok := settings[key]
+		if !ok {
+			return config, fmt.Errorf("line %d: setting '%s' is unknown", line, key)
+		}
+		*setting = parsed
+	}
+
+	if err := scanner.Err(); err != nil {
+		return config, fmt.Errorf("can not read config, error: %s", err)
+	}
+
+	config.DB = expandHome(config.DB)
+	config.KeyFile = expandHome(config.KeyFile)
+
+	return config, nil
+}
+
+// parseString returns a basic ("...") or literal ('...') TOML string followed by an optional comment
+func parseString(value string) (string, error) {
+	if value == "" {
+		return "", errors.New("value is empty")
+	}
+
+	var parsed, rest string
+	switch value[0] {
+	case '\'':
+		end := strings.Index(value[1:], "'")
+		if end < 0 {
+			return "", errors.New("literal string is not closed")
+		}
+		parsed, rest = value[1:end+1], value[end+2:]
+	case '"':
+		end := 1
+		for ; end < len(value); end++ {
+			if value[end] == '\\' {
+				end++
+				continue
+			}
+			if value[end] == '"' {
+				break
+			}
+		}
+		if end >= len(value) {
+			return "", errors.New("string is not closed")
+		}
+
+		unquoted, err := strconv.Unquote(value[:end+1])
+		if err != nil {
+			return "", fmt.Errorf("string has invalid escape sequences, error: %s", err)
+		}
+		parsed, rest = unquoted, value[end+1:]
+	default:
+		return "", errors.New("only quoted strings are supported")
+	}
+
+	if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", fmt.Errorf("unexpected '%s' after the value", rest)
+	}
+
+	return parsed, nil
+}
+
+// unquoteKey returns the key without quotes, keys of aliases may be quoted
+func unquoteKey(key string) string {
+	if len(key) >= 2 && (key[0] == '"' || key[0] == '\'') && key[len(key)-1] == key[0] {
+		return key[1 : len(key)-1]
+	}
+
+	return key
+}
+
+// expandHome replaces the leading "~/" with the home directory
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(homeDir, path[2:])
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestParse checks that settings, aliases and comments of the config are parsed
+func TestParse(t *testing.T) {
+	t.Setenv("HOME", "/home/test")
+
+	data := `# later config
+db = "~/tasks/later.db"
+date_format = '02 Jan 15:04' # literal string
+sort = "due"
+default_list = "work"
+theme = "none"
+backup_every = "24h"
+backup_keep = "5"
+key_file = "~/.later.key"
+
+[aliases]
+ls = "list --all"
+"tw" = "list -l \"work\""
+`
+	config, err := Parse(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("config can not be parsed, unexpected error: %s", err)
+	}
+
+	if config.DB != "/home/test/tasks/later.db" || config.DateFormat != "02 Jan 15:04" || config.Sort != "due" {
+		t.Errorf("expected settings to be parsed, got: %v", config)
+	}
+
+	if config.DefaultList != "work" || config.Theme != "none" || config.BackupEvery != "24h" || config.BackupKeep != "5" || config.KeyFile != "/home/test/.later.key" {
+		t.Errorf("expected settings to be parsed, got: %v", config)
+	}
+
+	if config.Aliases["ls"] != "list --all" || config.Aliases["tw"] != `list -l "work"` {
+		t.Errorf("expected aliases to be parsed, got: %v", config.Aliases)
+	}
+
+	for _, invalid := range []string{
+		"sort = due",
+		"sort = \"due",
+		"colour = \"red\"",
+		"[colors]",
+		"sort",
+		"sort = \"due\" extra",
+	} {
+		if _, err = Parse(strings.NewReader(invalid)); err == nil {
+			t.Errorf("error expected for invalid config '%s'", invalid)
+		}
+	}
+}
+
+// TestLoad checks that the config is loaded from the XDG config directory and that it is optional
+func TestLoad(t *testing.T) {
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+
+	config, err := Load()
+	if err != nil || config.Sort != "" {
+		t.Fatalf("expected empty config without the file, got: %v, error: %v", config, err)
+	}
+
+	path := filepath.Join(configHome, configDir, configFile)
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatalf("config directory can not be created, unexpected error: %s", err)
+	}
+
+	if err = os.WriteFile(path, []byte("sort = \"created\"\n"), 0600); err != nil {
+		t.Fatalf("config file can not be written, unexpected error: %s", err)
+	}
+
+	if config, err = Load(); err != nil || config.Sort != "created" {
+		t.Errorf("expected config to be loaded from %s, got: %v, error: %v", path, config, err)
+	}
+}
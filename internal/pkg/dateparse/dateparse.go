@@ -0,0 +1,171 @@
+package dateparse
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dateLayout     = "2006-01-02"
+	clockLayout    = "15:04"
+	dateTimeLayout = dateLayout + " " + clockLayout
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// Parse converts a human-friendly date expression into an absolute time relative to now;
+// supported forms are "today", "tomorrow", weekday names ("fri"), offsets ("+3d", "+2w", "+4h"),
+// ISO dates ("2026-11-02") and any of the day forms followed by a clock time ("fri 17:00");
+// when no clock time is given, the end of the day is used; a bare clock time which has already passed
+// today means the next day
+func Parse(value string, now time.Time) (time.Time, error) {
+	fields := strings.Fields(strings.ToLower(value))
+	if len(fields) == 0 || len(fields) > 2 {
+		return time.Time{}, fmt.Errorf("date '%s' has unsupported format", value)
+	}
+
+	if strings.HasPrefix(fields[0], "+") {
+		if len(fields) != 1 {
+			return time.Time{}, fmt.Errorf("date offset '%s' can not be combined with a time", value)
+		}
+		return parseOffset(fields[0], now)
+	}
+
+	if len(fields) == 1 {
+		if clock, err := time.ParseInLocation(clockLayout, fields[0], now.Location()); err == nil {
+			if due := atClock(now, clock); due.After(now) {
+				return due, nil
+			}
+			return atClock(now.AddDate(0, 0, 1), clock), nil
+		}
+	}
+
+	day, err := parseDay(fields[0], now)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if len(fields) == 1 {
+		return EndOfDay(day), nil
+	}
+
+	clock, err := time.ParseInLocation(clockLayout, fields[1], now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("time '%s' has unsupported format, expected HH:MM", fields[1])
+	}
+
+	return atClock(day, clock), nil
+}
+
+// ParseAge converts an age like "30d", "2w" or "12h" into the moment that long before now
+func ParseAge(value string, now time.Time) (time.Time, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if len(value) < 2 {
+		return time.Time{}, fmt.Errorf("age '%s' has unsupported format, expected e.g. 30d", value)
+	}
+
+	amount, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || value[0] < '0' || value[0] > '9' {
+		return time.Time{}, fmt.Errorf("age '%s' has invalid amount", value)
+	}
+
+	switch value[len(value)-1] {
+	case 'h':
+		return now.Add(-time.Duration(amount) * time.Hour), nil
+	case 'd':
+		return now.AddDate(0, 0, -amount), nil
+	case 'w':
+		return now.AddDate(0, 0, -7*amount), nil
+	}
+
+	return time.Time{}, errors.New("age unit is unknown, expected one of: h, d, w")
+}
+
+// Format returns a short representation of a due time, omitting the clock for end of day values
+func Format(t time.Time) string {
+	if t.Equal(EndOfDay(t)) {
+		return t.Format(dateLayout)
+	}
+
+	return t.Format(dateTimeLayout)
+}
+
+// StartOfDay returns midnight of the given day
+func StartOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// EndOfDay returns the last second of the given day
+func EndOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 23, 59, 59, 0, t.Location())
+}
+
+// EndOfWeek returns the last second of the week (Monday to Sunday) the given day belongs to
+func EndOfWeek(t time.Time) time.Time {
+	daysLeft := (7 - int(t.Weekday())) % 7
+	return EndOfDay(t.AddDate(0, 0, daysLeft))
+}
+
+// parseDay resolves a day expression (keyword, weekday name or ISO date)
+func parseDay(value string, now time.Time) (time.Time, error) {
+	switch value {
+	case "today", "tonight":
+		return now, nil
+	case "tomorrow":
+		return now.AddDate(0, 0, 1), nil
+	}
+
+	if weekday, ok := weekdays[value]; ok {
+		daysAhead := (int(weekday) - int(now.Weekday()) + 7) % 7
+		return now.AddDate(0, 0, daysAhead), nil
+	}
+
+	day, err := time.ParseInLocation(dateLayout, value, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("date '%s' has unsupported format", value)
+	}
+
+	return day, nil
+}
+
+// parseOffset resolves relative offsets like "+3d"; day and week offsets point to the end of the day
+func parseOffset(value string, now time.Time) (time.Time, error) {
+	if len(value) < 3 {
+		return time.Time{}, fmt.Errorf("offset '%s' has unsupported format, expected e.g. +3d", value)
+	}
+
+	amount, err := strconv.Atoi(value[1 : len(value)-1])
+	if err != nil || amount < 0 {
+		return time.Time{}, fmt.Errorf("offset '%s' has invalid amount", value)
+	}
+
+	switch value[len(value)-1] {
+	case 'h':
+		return now.Add(time.Duration(amount) * time.Hour), nil
+	case 'd':
+		return EndOfDay(now.AddDate(0, 0, amount)), nil
+	case 'w':
+		return EndOfDay(now.AddDate(0, 0, 7*amount)), nil
+	}
+
+	return time.Time{}, errors.New("offset unit is unknown, expected one of: h, d, w")
+}
+
+// atClock combines the date of the day with the clock time
+func atClock(day, clock time.Time) time.Time {
+	year, month, date := day.Date()
+	return time.Date(year, month, date, clock.Hour(), clock.Minute(), 0, 0, day.Location())
+}
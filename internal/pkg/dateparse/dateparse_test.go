@@ -0,0 +1,91 @@
+package dateparse
+
+import (
+	"testing"
+	"time"
+)
+
+// TestParse checks that supported date expressions are resolved relative to a fixed point in time
+func TestParse(t *testing.T) {
+	now := time.Date(2026, time.October, 14, 10, 30, 0, 0, time.UTC) // Wednesday
+
+	cases := map[string]time.Time{
+		"today":            time.Date(2026, time.October, 14, 23, 59, 59, 0, time.UTC),
+		"tomorrow":         time.Date(2026, time.October, 15, 23, 59, 59, 0, time.UTC),
+		"Tomorrow 09:15":   time.Date(2026, time.October, 15, 9, 15, 0, 0, time.UTC),
+		"fri":              time.Date(2026, time.October, 16, 23, 59, 59, 0, time.UTC),
+		"fri 17:00":        time.Date(2026, time.October, 16, 17, 0, 0, 0, time.UTC),
+		"wednesday":        time.Date(2026, time.October, 14, 23, 59, 59, 0, time.UTC),
+		"mon":              time.Date(2026, time.October, 19, 23, 59, 59, 0, time.UTC),
+		"18:00":            time.Date(2026, time.October, 14, 18, 0, 0, 0, time.UTC),
+		"09:00":            time.Date(2026, time.October, 15, 9, 0, 0, 0, time.UTC),
+		"10:30":            time.Date(2026, time.October, 15, 10, 30, 0, 0, time.UTC),
+		"today 09:00":      time.Date(2026, time.October, 14, 9, 0, 0, 0, time.UTC),
+		"+3d":              time.Date(2026, time.October, 17, 23, 59, 59, 0, time.UTC),
+		"+2w":              time.Date(2026, time.October, 28, 23, 59, 59, 0, time.UTC),
+		"+4h":              time.Date(2026, time.October, 14, 14, 30, 0, 0, time.UTC),
+		"2026-11-02":       time.Date(2026, time.November, 2, 23, 59, 59, 0, time.UTC),
+		"2026-11-02 08:00": time.Date(2026, time.November, 2, 8, 0, 0, 0, time.UTC),
+	}
+
+	for value, expected := range cases {
+		parsed, err := Parse(value, now)
+		if err != nil {
+			t.Errorf("date '%s' can not be parsed, unexpected error: %s", value, err)
+			continue
+		}
+
+		if !parsed.Equal(expected) {
+			t.Errorf("date '%s' expected to be parsed as %s, got: %s", value, expected, parsed)
+		}
+	}
+
+	for _, value := range []string{"", "someday", "+3y", "+d", "fri 5pm", "+3d 10:00", "2026/11/02"} {
+		if _, err := Parse(value, now); err == nil {
+			t.Errorf("date '%s' expected to be rejected", value)
+		}
+	}
+}
+
+// TestParseAge checks that ages are converted into moments in the past
+func TestParseAge(t *testing.T) {
+	now := time.Date(2026, time.October, 14, 10, 30, 0, 0, time.UTC)
+
+	cases := map[string]time.Time{
+		"30d": time.Date(2026, time.September, 14, 10, 30, 0, 0, time.UTC),
+		"2W":  time.Date(2026, time.September, 30, 10, 30, 0, 0, time.UTC),
+		"12h": time.Date(2026, time.October, 13, 22, 30, 0, 0, time.UTC),
+		"0d":  now,
+	}
+
+	for value, expected := range cases {
+		parsed, err := ParseAge(value, now)
+		if err != nil {
+			t.Errorf("age '%s' can not be parsed, unexpected error: %s", value, err)
+			continue
+		}
+
+		if !parsed.Equal(expected) {
+			t.Errorf("age '%s' expected to be parsed as %s, got: %s", value, expected, parsed)
+		}
+	}
+
+	for _, value := range []string{"", "d", "30", "30y", "-3d", "+3d", "three d"} {
+		if _, err := ParseAge(value, now); err == nil {
+			t.Errorf("age '%s' expected to be rejected", value)
+		}
+	}
+}
+
+// TestFormat checks that end of day values are printed without the clock time
+func TestFormat(t *testing.T) {
+	day := time.Date(2026, time.November, 2, 23, 59, 59, 0, time.UTC)
+	if formatted := Format(day); formatted != "2026-11-02" {
+		t.Errorf("expected date only, got: %s", formatted)
+	}
+
+	moment := time.Date(2026, time.November, 2, 8, 0, 0, 0, time.UTC)
+	if formatted := Format(moment); formatted != "2026-11-02 08:00" {
+		t.Errorf("expected date and time, got: %s", formatted)
+	}
+}
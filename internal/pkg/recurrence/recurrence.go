@@ -0,0 +1,386 @@
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency defines the base period of a rule
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// frequencyToUnit maps frequencies to their unit names used in descriptions and human-friendly forms
+var frequencyToUnit = map[Frequency]string{
+	Daily:   "day",
+	Weekly:  "week",
+	Monthly: "month",
+	Yearly:  "year",
+}
+
+// weekdayToCode maps weekdays to their RRULE codes
+var weekdayToCode = map[time.Weekday]string{
+	time.Sunday:    "SU",
+	time.Monday:    "MO",
+	time.Tuesday:   "TU",
+	time.Wednesday: "WE",
+	time.Thursday:  "TH",
+	time.Friday:    "FR",
+	time.Saturday:  "SA",
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// maxPeriods limits the search of the next occurrence of monthly and yearly rules
+const maxPeriods = 1200
+
+// workdays defines days matched by the "weekdays" rule
+var workdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+
+// Rule defines a recurrence rule, a subset of RFC 5545 RRULE: FREQ, INTERVAL, BYDAY (weekdays without
+// ordinals, with WEEKLY frequency only) and BYMONTHDAY (a single day, with MONTHLY frequency only)
+type Rule struct {
+	Frequency  Frequency
+	Interval   int            // number of periods between occurrences, at least 1
+	ByDay      []time.Weekday // weekdays of occurrences, sorted from Sunday
+	ByMonthDay int            // day of the month of occurrences, 0 if not set
+}
+
+// Parse returns a rule from a human-friendly form or from an RRULE: "day", "daily", "weekdays", "week",
+// "month", "year", weekday names ("monday", "mon,thu"), intervals ("3 days", "3d", "2w", "2 months"),
+// days of the month ("1st", "15th") and RRULE strings ("FREQ=WEEKLY;INTERVAL=2;BYDAY=MO")
+func Parse(value string) (Rule, error) {
+	value = strings.TrimSpace(value)
+	upper := strings.ToUpper(value)
+	if strings.HasPrefix(upper, "RRULE:") || strings.HasPrefix(upper, "FREQ=") {
+		return parseRRule(strings.TrimPrefix(upper, "RRULE:"))
+	}
+
+	lower := strings.TrimPrefix(strings.ToLower(value), "every ")
+	switch lower {
+	case "day", "daily":
+		return Rule{Frequency: Daily, Interval: 1}, nil
+	case "weekday", "weekdays", "workday", "workdays":
+		return Rule{Frequency: Weekly, Interval: 1, ByDay: append([]time.Weekday(nil), workdays...)}, nil
+	case "week", "weekly":
+		return Rule{Frequency: Weekly, Interval: 1}, nil
+	case "month", "monthly":
+		return Rule{Frequency: Monthly, Interval: 1}, nil
+	case "year", "yearly", "annually":
+		return Rule{Frequency: Yearly, Interval: 1}, nil
+	}
+
+	if day, ok := parseOrdinal(lower); ok {
+		return Rule{Frequency: Monthly, Interval: 1, ByMonthDay: day}, nil
+	}
+
+	if rule, ok := parseInterval(lower); ok {
+		return rule, nil
+	}
+
+	var days []time.Weekday
+	for _, name := range strings.FieldsFunc(lower, func(r rune) bool { return r == ',' || r == ' ' }) {
+		weekday, ok := weekdays[name]
+		if !ok {
+			return Rule{}, fmt.Errorf("recurrence '%s' has unsupported format, expected e.g.: day, weekdays, monday, 3 days, 1st", value)
+		}
+		days = append(days, weekday)
+	}
+
+	if len(days) == 0 {
+		return Rule{}, errors.New("recurrence is empty")
+	}
+
+	return Rule{Frequency: Weekly, Interval: 1, ByDay: normalizeDays(days)}, nil
+}
+
+// String returns the rule in RRULE format, e.g. "FREQ=WEEKLY;BYDAY=MO,FR"
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Frequency)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+
+	if len(r.ByDay) > 0 {
+		codes := make([]string, 0, len(r.ByDay))
+		for _, day := range r.ByDay {
+			codes = append(codes, weekdayToCode[day])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+
+	if r.ByMonthDay > 0 {
+		parts = append(parts, "BYMONTHDAY="+strconv.Itoa(r.ByMonthDay))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// Describe returns a human-readable description of the rule, e.g. "every 2 weeks on mon, fri"
+func (r Rule) Describe() string {
+	description := "every " + frequencyToUnit[r.Frequency]
+	if r.Interval > 1 {
+		description = fmt.Sprintf("every %d %ss", r.Interval, frequencyToUnit[r.Frequency])
+	}
+
+	if len(r.ByDay) > 0 {
+		if r.Interval == 1 && sameDays(r.ByDay, workdays) {
+			return "every weekday"
+		}
+
+		names := make([]string, 0, len(r.ByDay))
+		for _, day := range r.ByDay {
+			names = append(names, strings.ToLower(day.String()[:3]))
+		}
+		if r.Interval == 1 {
+			return "every " + strings.Join(names, ", ")
+		}
+		description += " on " + strings.Join(names, ", ")
+	}
+
+	if r.ByMonthDay > 0 {
+		description += " on the " + ordinal(r.ByMonthDay)
+	}
+
+	return description
+}
+
+// First returns the first occurrence on the day of t or later, keeping the clock of t
+func (r Rule) First(t time.Time) time.Time {
+	if len(r.ByDay) == 0 && r.ByMonthDay == 0 {
+		return t
+	}
+
+	return r.Next(t.AddDate(0, 0, -1))
+}
+
+// Next returns the occurrence following t, keeping the clock of t; days missing in short months are skipped,
+// if there is no such day within maxPeriods, the occurrence is moved by the interval ignoring the day
+func (r Rule) Next(t time.Time) time.Time {
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+
+	switch r.Frequency {
+	case Daily:
+		return t.AddDate(0, 0, interval)
+	case Weekly:
+		if len(r.ByDay) == 0 {
+			return t.AddDate(0, 0, 7*interval)
+		}
+		weekStart := startOfWeek(t)
+		for days := 1; ; days++ {
+			candidate := t.AddDate(0, 0, days)
+			weeks := int(startOfWeek(candidate).Sub(weekStart).Hours()+12) / (24 * 7)
+			if weeks%interval == 0 && containsDay(r.ByDay, candidate.Weekday()) {
+				return candidate
+			}
+		}
+	case Monthly:
+		day := r.ByMonthDay
+		if day == 0 {
+			day = t.Day()
+		}
+		for months := 0; months < maxPeriods; months += interval {
+			candidate := time.Date(t.Year(), t.Month()+time.Month(months), day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+			if candidate.Day() == day && candidate.After(t) {
+				return candidate
+			}
+		}
+		return t.AddDate(0, interval, 0)
+	case Yearly:
+		for years := interval; years < maxPeriods; years += interval {
+			candidate := time.Date(t.Year()+years, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+			if candidate.Day() == t.Day() {
+				return candidate
+			}
+		}
+		return t.AddDate(interval, 0, 0)
+	}
+
+	return t.AddDate(0, 0, interval)
+}
+
+// parseRRule returns a rule from the supported subset of RRULE
+func parseRRule(value string) (Rule, error) {
+	rule := Rule{Interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		name, parameter, ok := strings.Cut(part, "=")
+		if !ok {
+			return rule, fmt.Errorf("RRULE part '%s' is invalid", part)
+		}
+
+		switch name {
+		case "FREQ":
+			rule.Frequency = Frequency(parameter)
+			if _, ok = frequencyToUnit[rule.Frequency]; !ok {
+				return rule, fmt.Errorf("RRULE frequency '%s' is not supported", parameter)
+			}
+		case "INTERVAL":
+			interval, err := strconv.Atoi(parameter)
+			if err != nil || interval < 1 {
+				return rule, fmt.Errorf("RRULE interval '%s' is invalid", parameter)
+			}
+			rule.Interval = interval
+		case "BYDAY":
+			var days []time.Weekday
+			for _, code := range strings.Split(parameter, ",") {
+				day, ok := codeToWeekday(code)
+				if !ok {
+					return rule, fmt.Errorf("RRULE weekday '%s' is not supported", code)
+				}
+				days = append(days, day)
+			}
+			rule.ByDay = normalizeDays(days)
+		case "BYMONTHDAY":
+			day, err := strconv.Atoi(parameter)
+			if err != nil || day < 1 || day > 31 {
+				return rule, fmt.Errorf("RRULE day of the month '%s' is not supported", parameter)
+			}
+			rule.ByMonthDay = day
+		default:
+			return rule, fmt.Errorf("RRULE part '%s' is not supported", name)
+		}
+	}
+
+	switch {
+	case rule.Frequency == "":
+		return rule, errors.New("RRULE frequency is not set")
+	case len(rule.ByDay) > 0 && rule.Frequency != Weekly:
+		return rule, errors.New("RRULE weekdays are supported with weekly frequency only")
+	case rule.ByMonthDay > 0 && rule.Frequency != Monthly:
+		return rule, errors.New("RRULE day of the month is supported with monthly frequency only")
+	}
+
+	return rule, nil
+}
+
+// parseInterval returns a rule from intervals like "3 days", "3d", "2w", "2 months" or "1y"
+func parseInterval(value string) (Rule, bool) {
+	amount, unit := value, ""
+	if fields := strings.Fields(value); len(fields) == 2 {
+		amount, unit = fields[0], strings.TrimSuffix(fields[1], "s")
+	} else if len(value) > 1 {
+		amount, unit = value[:len(value)-1], value[len(value)-1:]
+	}
+
+	interval, err := strconv.Atoi(amount)
+	if err != nil || interval < 1 {
+		return Rule{}, false
+	}
+
+	for frequency, name := range frequencyToUnit {
+		if unit == name || unit == name[:1] {
+			return Rule{Frequency: frequency, Interval: interval}, true
+		}
+	}
+
+	return Rule{}, false
+}
+
+// parseOrdinal returns the day of the month from ordinals like "1st", "22nd" or "15th"
+func parseOrdinal(value string) (int, bool) {
+	if len(value) < 3 {
+		return 0, false
+	}
+
+	day, err := strconv.Atoi(value[:len(value)-2])
+	if err != nil || day < 1 || day > 31 || ordinal(day) != value {
+		return 0, false
+	}
+
+	return day, true
+}
+
+// ordinal returns the day of the month as an ordinal, e.g. "1st"
+func ordinal(day int) string {
+	suffix := "th"
+	switch {
+	case day%100 >= 11 && day%100 <= 13:
+	case day%10 == 1:
+		suffix = "st"
+	case day%10 == 2:
+		suffix = "nd"
+	case day%10 == 3:
+		suffix = "rd"
+	}
+
+	return strconv.Itoa(day) + suffix
+}
+
+// codeToWeekday returns the weekday by its RRULE code
+func codeToWeekday(code string) (time.Weekday, bool) {
+	for day, dayCode := range weekdayToCode {
+		if code == dayCode {
+			return day, true
+		}
+	}
+
+	return time.Sunday, false
+}
+
+// normalizeDays returns unique weekdays sorted from Sunday
+func normalizeDays(days []time.Weekday) []time.Weekday {
+	unique := make([]time.Weekday, 0, len(days))
+	for _, day := range days {
+		if !containsDay(unique, day) {
+			unique = append(unique, day)
+		}
+	}
+
+	sort.Slice(unique, func(i, j int) bool { return unique[i] < unique[j] })
+
+	return unique
+}
+
+// containsDay reports whether the weekday is in the list
+func containsDay(days []time.Weekday, day time.Weekday) bool {
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sameDays reports whether both lists contain the same weekdays in the same order
+func sameDays(a, b []time.Weekday) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// startOfWeek returns midnight of Monday of the week the day belongs to
+func startOfWeek(t time.Time) time.Time {
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	year, month, day := t.AddDate(0, 0, -daysSinceMonday).Date()
+
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,117 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+)
+
+// TestParse checks that human-friendly forms and RRULE strings are parsed into rules
+func TestParse(t *testing.T) {
+	cases := map[string]string{
+		"day":                                   "FREQ=DAILY",
+		"every day":                             "FREQ=DAILY",
+		"3 days":                                "FREQ=DAILY;INTERVAL=3",
+		"3d":                                    "FREQ=DAILY;INTERVAL=3",
+		"2w":                                    "FREQ=WEEKLY;INTERVAL=2",
+		"2 months":                              "FREQ=MONTHLY;INTERVAL=2",
+		"weekdays":                              "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR",
+		"Monday":                                "FREQ=WEEKLY;BYDAY=MO",
+		"fri,mon":                               "FREQ=WEEKLY;BYDAY=MO,FR",
+		"1st":                                   "FREQ=MONTHLY;BYMONTHDAY=1",
+		"yearly":                                "FREQ=YEARLY",
+		"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=TU": "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU",
+		"freq=monthly;bymonthday=15":            "FREQ=MONTHLY;BYMONTHDAY=15",
+	}
+
+	for value, expected := range cases {
+		rule, err := Parse(value)
+		if err != nil {
+			t.Errorf("recurrence '%s' can not be parsed, unexpected error: %s", value, err)
+			continue
+		}
+
+		if rule.String() != expected {
+			t.Errorf("recurrence '%s' expected to be parsed as %s, got: %s", value, expected, rule)
+		}
+	}
+
+	for _, value := range []string{"", "someday", "0d", "2nd monday", "32nd", "FREQ=HOURLY", "FREQ=DAILY;BYDAY=MO", "FREQ=WEEKLY;COUNT=3"} {
+		if _, err := Parse(value); err == nil {
+			t.Errorf("error expected for unsupported recurrence '%s'", value)
+		}
+	}
+}
+
+// TestNext checks that occurrences follow each other according to the rules
+func TestNext(t *testing.T) {
+	from := time.Date(2026, time.October, 14, 23, 59, 59, 0, time.UTC) // Wednesday
+
+	cases := map[string]time.Time{
+		"day":                                   time.Date(2026, time.October, 15, 23, 59, 59, 0, time.UTC),
+		"3 days":                                time.Date(2026, time.October, 17, 23, 59, 59, 0, time.UTC),
+		"weekly":                                time.Date(2026, time.October, 21, 23, 59, 59, 0, time.UTC),
+		"monday":                                time.Date(2026, time.October, 19, 23, 59, 59, 0, time.UTC),
+		"wed,fri":                               time.Date(2026, time.October, 16, 23, 59, 59, 0, time.UTC),
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH":    time.Date(2026, time.October, 15, 23, 59, 59, 0, time.UTC),
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO":       time.Date(2026, time.October, 26, 23, 59, 59, 0, time.UTC),
+		"1st":                                   time.Date(2026, time.November, 1, 23, 59, 59, 0, time.UTC),
+		"monthly":                               time.Date(2026, time.November, 14, 23, 59, 59, 0, time.UTC),
+		"FREQ=MONTHLY;INTERVAL=3;BYMONTHDAY=31": time.Date(2026, time.October, 31, 23, 59, 59, 0, time.UTC),
+	}
+
+	for value, expected := range cases {
+		rule, err := Parse(value)
+		if err != nil {
+			t.Fatalf("recurrence '%s' can not be parsed, unexpected error: %s", value, err)
+		}
+
+		if next := rule.Next(from); !next.Equal(expected) {
+			t.Errorf("next occurrence of '%s' expected at %s, got: %s", value, expected, next)
+		}
+	}
+
+	quarterly, _ := Parse("FREQ=MONTHLY;INTERVAL=3;BYMONTHDAY=31")
+	expected := time.Date(2027, time.January, 31, 23, 59, 59, 0, time.UTC)
+	if next := quarterly.Next(cases["FREQ=MONTHLY;INTERVAL=3;BYMONTHDAY=31"]); !next.Equal(expected) {
+		t.Errorf("next quarterly occurrence expected at %s, got: %s", expected, next)
+	}
+
+	friday := time.Date(2026, time.October, 16, 9, 0, 0, 0, time.UTC)
+	weekdays, _ := Parse("weekdays")
+	if next := weekdays.Next(friday); next.Weekday() != time.Monday || next.Hour() != 9 {
+		t.Errorf("next weekday after friday expected on monday at 09:00, got: %s", next)
+	}
+
+	monday, _ := Parse("monday")
+	if first := monday.First(from); first.Weekday() != time.Monday {
+		t.Errorf("first occurrence of 'monday' expected on monday, got: %s", first)
+	}
+
+	if first := weekdays.First(from); !first.Equal(from) {
+		t.Errorf("first occurrence of 'weekdays' expected on the same wednesday, got: %s", first)
+	}
+}
+
+// TestDescribe checks human-readable descriptions of rules
+func TestDescribe(t *testing.T) {
+	cases := map[string]string{
+		"day":                                   "every day",
+		"3 days":                                "every 3 days",
+		"weekdays":                              "every weekday",
+		"mon,fri":                               "every mon, fri",
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO":       "every 2 weeks on mon",
+		"1st":                                   "every month on the 1st",
+		"FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=22": "every 2 months on the 22nd",
+	}
+
+	for value, expected := range cases {
+		rule, err := Parse(value)
+		if err != nil {
+			t.Fatalf("recurrence '%s' can not be parsed, unexpected error: %s", value, err)
+		}
+
+		if description := rule.Describe(); description != expected {
+			t.Errorf("recurrence '%s' expected to be described as '%s', got: '%s'", value, expected, description)
+		}
+	}
+}
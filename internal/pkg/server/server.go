@@ -0,0 +1,405 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/manmolecular/go-later/internal/pkg/storage"
+)
+
+const (
+	recordsPath  = "/records"
+	countPath    = "/count"
+	maxBodyBytes = 1 << 20
+)
+
+// statusToValue maps values of the status query parameter to record statuses
+var statusToValue = map[string]storage.Status{
+	"pending": storage.StatusPending,
+	"done":    storage.StatusDone,
+	"all":     storage.StatusAny,
+}
+
+// sortToOrder maps values of the sort query parameter to records order
+var sortToOrder = map[string]storage.Order{
+	"priority": storage.OrderPriority,
+	"created":  storage.OrderNewest,
+	"oldest":   storage.OrderOldest,
+	"due":      storage.OrderDue,
+}
+
+// apiError defines an error returned with a non-successful status code
+type apiError struct {
+	status  int
+	message string
+	allow   []string // methods allowed for the path when the method is not allowed
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+// errorf returns an error reported to the client with the status code
+func errorf(status int, format string, args ...interface{}) error {
+	return &apiError{status: status, message: fmt.Sprintf(format, args...)}
+}
+
+// methodNotAllowed returns an error listing the methods allowed for the path
+func methodNotAllowed(method string, allow ...string) error {
+	return &apiError{status: http.StatusMethodNotAllowed, message: fmt.Sprintf("method %s is not allowed", method), allow: allow}
+}
+
+// Handler serves the REST API over the storage:
+//
+//	GET    /records       list records, filtered by status, tag, list, due_before and sorted by sort
+//	POST   /records       create a record
+//	GET    /records/{id}  get a record
+//	PATCH  /records/{id}  update content, due_at, priority, done, tags or list of a record
+//	DELETE /records/{id}  delete a record with its subtasks
+//	GET    /count         count records, filtered by status, tag and list
+type Handler struct {
+	storage storage.Storage
+	hosts   map[string]bool // host names requests may be addressed to
+	mu      sync.RWMutex    // changes are applied one at a time, as each of them reads the record before saving it
+}
+
+// NewHandler creates the API handler over the storage served on the address; only requests addressed to the host
+// of the address or to localhost are accepted, so that web pages resolving their names to the local address
+// (DNS rebinding) can not reach the API
+func NewHandler(s storage.Storage, addr string) *Handler {
+	hosts := map[string]bool{"localhost": true, "127.0.0.1": true, "::1": true}
+	if host, _, err := net.SplitHostPort(addr); err == nil && host != "" {
+		hosts[strings.ToLower(host)] = true
+	}
+
+	return &Handler{storage: s, hosts: hosts}
+}
+
+// ServeHTTP routes requests to the API methods
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.checkHost(r); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	status, body, err := h.route(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, status, body)
+}
+
+// checkHost returns an error if the request is addressed to a host other than the served one
+func (h *Handler) checkHost(r *http.Request) error {
+	host := r.Host
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+
+	if !h.hosts[strings.ToLower(strings.Trim(host, "[]"))] {
+		return errorf(http.StatusForbidden, "host '%s' is not allowed", r.Host)
+	}
+
+	return nil
+}
+
+// route calls the API method matching the request path and method
+func (h *Handler) route(r *http.Request) (int, interface{}, error) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+
+	switch {
+	case path == recordsPath:
+		switch r.Method {
+		case http.MethodGet:
+			return h.listRecords(r)
+		case http.MethodPost:
+			return h.createRecord(r)
+		}
+		return 0, nil, methodNotAllowed(r.Method, http.MethodGet, http.MethodPost)
+	case strings.HasPrefix(path, recordsPath+"/"):
+		id, err := strconv.ParseUint(strings.TrimPrefix(path, recordsPath+"/"), 10, 0)
+		if err != nil || id == 0 {
+			return 0, nil, errorf(http.StatusNotFound, "record ID '%s' is invalid", strings.TrimPrefix(path, recordsPath+"/"))
+		}
+		switch r.Method {
+		case http.MethodGet:
+			return h.getRecord(uint(id))
+		case http.MethodPatch:
+			return h.updateRecord(uint(id), r)
+		case http.MethodDelete:
+			return h.deleteRecord(uint(id))
+		}
+		return 0, nil, methodNotAllowed(r.Method, http.MethodGet, http.MethodPatch, http.MethodDelete)
+	case path == countPath:
+		if r.Method == http.MethodGet {
+			return h.countRecords(r)
+		}
+		return 0, nil, methodNotAllowed(r.Method, http.MethodGet)
+	}
+
+	return 0, nil, errorf(http.StatusNotFound, "path '%s' is unknown", r.URL.Path)
+}
+
+// listRecords returns records selected by the query parameters
+func (h *Handler) listRecords(r *http.Request) (int, interface{}, error) {
+	filter, err := parseFilter(r, storage.StatusPending)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	records, err := h.storage.GetRecords(filter)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if records == nil {
+		records = []storage.Record{}
+	}
+
+	return http.StatusOK, records, nil
+}
+
+// countRecords returns the number of records selected by the query parameters
+func (h *Handler) countRecords(r *http.Request) (int, interface{}, error) {
+	filter, err := parseFilter(r, storage.StatusPending)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	count, err := h.storage.CountRecords(filter)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, map[string]uint{"count": count}, nil
+}
+
+// getRecord returns a record by its ID
+func (h *Handler) getRecord(id uint) (int, interface{}, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	record, err := h.findRecord(id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, record, nil
+}
+
+// createRecord adds a record from the request body
+func (h *Handler) createRecord(r *http.Request) (int, interface{}, error) {
+	var record storage.Record
+	if err := decodeBody(r, &record); err != nil {
+		return 0, nil, err
+	}
+
+	record.Content = strings.TrimSpace(record.Content)
+	if record.Content == "" {
+		return 0, nil, errorf(http.StatusBadRequest, "content is empty")
+	}
+
+	record.ID, record.CreatedAt, record.UpdatedAt = 0, time.Time{}, nil
+	if record.Done && record.CompletedAt == nil {
+		now := time.Now()
+		record.CompletedAt = &now
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.storage.CreateRecord(&record); err != nil {
+		return 0, nil, err
+	}
+
+	created, err := h.storage.GetRecordByID(record.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusCreated, created, nil
+}
+
+// updateRecord applies the attributes passed in the request body to a record, other attributes are left intact;
+// null due_at or list removes the due date or the list. All the attributes are validated first and saved at once,
+// so that the record is never left half-updated and the update is undone at once
+func (h *Handler) updateRecord(id uint, r *http.Request) (int, interface{}, error) {
+	var fields map[string]json.RawMessage
+	if err := decodeBody(r, &fields); err != nil {
+		return 0, nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	record, err := h.findRecord(id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for name, value := range fields {
+		switch name {
+		case "content":
+			err = json.Unmarshal(value, &record.Content)
+			record.Content = strings.TrimSpace(record.Content)
+			if err == nil && record.Content == "" {
+				return 0, nil, errorf(http.StatusBadRequest, "content is empty")
+			}
+		case "due_at":
+			record.DueAt = nil
+			err = json.Unmarshal(value, &record.DueAt)
+		case "priority":
+			err = json.Unmarshal(value, &record.Priority)
+		case "done":
+			err = json.Unmarshal(value, &record.Done)
+		case "tags":
+			record.Tags = nil
+			err = json.Unmarshal(value, &record.Tags)
+		case "list":
+			record.List = nil
+			err = json.Unmarshal(value, &record.List)
+		default:
+			return 0, nil, errorf(http.StatusBadRequest, "field '%s' can not be updated", name)
+		}
+		if err != nil {
+			return 0, nil, errorf(http.StatusBadRequest, "field '%s' is invalid, error: %s", name, err)
+		}
+	}
+
+	if err = h.storage.SaveRecord(&record); err != nil {
+		return 0, nil, err
+	}
+
+	updated, err := h.storage.GetRecordByID(id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, updated, nil
+}
+
+// deleteRecord deletes a record with its subtasks by its ID
+func (h *Handler) deleteRecord(id uint) (int, interface{}, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, err := h.findRecord(id); err != nil {
+		return 0, nil, err
+	}
+
+	if err := h.storage.DeleteRecordByID(id); err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusNoContent, nil, nil
+}
+
+// findRecord returns a record by its ID or the not found error
+func (h *Handler) findRecord(id uint) (storage.Record, error) {
+	record, err := h.storage.GetRecordByID(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return record, errorf(http.StatusNotFound, "record with ID %d is not found", id)
+	}
+	if err != nil {
+		return record, err
+	}
+
+	return record, nil
+}
+
+// parseFilter returns the filter from the status, tag, list, due_before and sort query parameters
+func parseFilter(r *http.Request, status storage.Status) (storage.Filter, error) {
+	query := r.URL.Query()
+	filter := storage.Filter{Status: status, Tag: query.Get("tag"), List: query.Get("list"), Order: storage.OrderPriority}
+
+	if value := query.Get("status"); value != "" {
+		var ok bool
+		if filter.Status, ok = statusToValue[value]; !ok {
+			return filter, errorf(http.StatusBadRequest, "status '%s' is unknown, expected one of: pending, done, all", value)
+		}
+	}
+
+	if value := query.Get("sort"); value != "" {
+		var ok bool
+		if filter.Order, ok = sortToOrder[value]; !ok {
+			return filter, errorf(http.StatusBadRequest, "sort order '%s' is unknown, expected one of: priority, created, oldest, due", value)
+		}
+	}
+
+	if value := query.Get("due_before"); value != "" {
+		dueBefore, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, errorf(http.StatusBadRequest, "due_before is invalid, expected RFC 3339 time, error: %s", err)
+		}
+		filter.DueBefore = dueBefore
+	}
+
+	return filter, nil
+}
+
+// decodeBody reads the JSON request body into the value, unknown fields are rejected; the body must be sent
+// as application/json, which browsers do not send across origins without asking the server first
+func decodeBody(r *http.Request, v interface{}) error {
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		return errorf(http.StatusUnsupportedMediaType, "request body must be sent as application/json")
+	}
+
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return errorf(http.StatusBadRequest, "request body is invalid, error: %s", err)
+	}
+
+	return nil
+}
+
+// writeJSON writes the value as the JSON response body with the status code
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeError writes the error in the same form as errors of the JSON output of the CLI, storage errors
+// of missing records and invalid input are reported as client errors
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var e *apiError
+	switch {
+	case errors.As(err, &e):
+		status = e.status
+		if len(e.allow) > 0 {
+			w.Header().Set("Allow", strings.Join(e.allow, ", "))
+		}
+	case errors.Is(err, storage.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, storage.ErrInvalidInput):
+		status = http.StatusBadRequest
+	}
+
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{"message": err.Error(), "code": status},
+	})
+}
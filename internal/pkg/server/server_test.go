@@ -0,0 +1,226 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/manmolecular/go-later/internal/pkg/storage"
+)
+
+// createTestServer returns the API server over a temporary storage
+func createTestServer(t *testing.T) *httptest.Server {
+	s, err := storage.NewCustomLocalStorage(t.TempDir(), "db", "test.db", storage.Options{})
+	if err != nil {
+		t.Fatalf("test storage can not be created, unexpected error: %s", err)
+	}
+
+	server := httptest.NewServer(NewHandler(s, "127.0.0.1:0"))
+	t.Cleanup(func() {
+		server.Close()
+		if err := s.Close(); err != nil {
+			t.Errorf("test storage can not be closed, unexpected error: %s", err)
+		}
+	})
+
+	return server
+}
+
+// request sends the request with the JSON body and decodes the JSON response into the value
+func request(t *testing.T, server *httptest.Server, method, path, body string, v interface{}) int {
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("request can not be created, unexpected error: %s", err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("request %s %s failed, unexpected error: %s", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("response can not be read, unexpected error: %s", err)
+	}
+
+	if v != nil && len(data) > 0 {
+		if err = json.Unmarshal(data, v); err != nil {
+			t.Fatalf("response %s can not be decoded, unexpected error: %s", data, err)
+		}
+	}
+
+	return resp.StatusCode
+}
+
+// TestRecordsAPI checks creating, reading, updating and deleting records through the API
+func TestRecordsAPI(t *testing.T) {
+	server := createTestServer(t)
+
+	var record storage.Record
+	status := request(t, server, http.MethodPost, "/records", `{"content": "buy milk", "priority": "high", "tags": ["home"], "list": "errands"}`, &record)
+	if status != http.StatusCreated || record.ID != 1 || record.Priority != storage.PriorityHigh || len(record.Tags) != 1 || record.List == nil {
+		t.Fatalf("expected record to be created, got status %d, record: %v", status, record)
+	}
+
+	if status = request(t, server, http.MethodPost, "/records", `{"content": "write report"}`, nil); status != http.StatusCreated {
+		t.Fatalf("expected record to be created, got status %d", status)
+	}
+
+	if status = request(t, server, http.MethodGet, "/records/1", "", &record); status != http.StatusOK || record.Content != "buy milk" {
+		t.Errorf("expected record to be returned, got status %d, record: %v", status, record)
+	}
+
+	body := `{"content": "buy oat milk", "done": true, "tags": ["shop", "home"], "list": null, "due_at": "2026-10-20T18:00:00Z"}`
+	if status = request(t, server, http.MethodPatch, "/records/1", body, &record); status != http.StatusOK {
+		t.Fatalf("expected record to be updated, got status %d", status)
+	}
+
+	if record.Content != "buy oat milk" || !record.Done || len(record.Tags) != 2 || record.List != nil || record.DueAt == nil || record.Priority != storage.PriorityHigh {
+		t.Errorf("expected updated attributes with the others intact, got: %v", record)
+	}
+
+	var records []storage.Record
+	if status = request(t, server, http.MethodGet, "/records?status=all&tag=shop", "", &records); status != http.StatusOK || len(records) != 1 {
+		t.Errorf("expected 1 record labeled by the tag, got status %d, records: %v", status, records)
+	}
+
+	var count map[string]uint
+	if status = request(t, server, http.MethodGet, "/count", "", &count); status != http.StatusOK || count["count"] != 1 {
+		t.Errorf("expected 1 pending record, got status %d, count: %v", status, count)
+	}
+
+	if status = request(t, server, http.MethodDelete, "/records/1", "", nil); status != http.StatusNoContent {
+		t.Errorf("expected record to be deleted, got status %d", status)
+	}
+
+	if status = request(t, server, http.MethodGet, "/records?status=all", "", &records); status != http.StatusOK || len(records) != 1 {
+		t.Errorf("expected 1 record left, got status %d, records: %v", status, records)
+	}
+}
+
+// TestCreateRecurringRecord checks that the next occurrence and completion time can not be set on creation,
+// so that completing the created record still spawns its next occurrence
+func TestCreateRecurringRecord(t *testing.T) {
+	server := createTestServer(t)
+
+	var record storage.Record
+	body := `{"content": "water plants", "recurrence": "daily", "next_id": 99, "completed_at": "2026-10-17T09:00:00Z"}`
+	status := request(t, server, http.MethodPost, "/records", body, &record)
+	if status != http.StatusCreated || record.NextID != nil || record.CompletedAt != nil {
+		t.Fatalf("expected record to be created without next occurrence and completion time, got status %d, record: %v", status, record)
+	}
+
+	if status = request(t, server, http.MethodPatch, "/records/1", `{"done": true}`, &record); status != http.StatusOK {
+		t.Fatalf("expected record to be updated, got status %d", status)
+	}
+
+	var records []storage.Record
+	if status = request(t, server, http.MethodGet, "/records", "", &records); status != http.StatusOK || len(records) != 1 || records[0].Content != "water plants" {
+		t.Fatalf("expected next occurrence to be created, got status %d, records: %v", status, records)
+	}
+
+	if status = request(t, server, http.MethodGet, "/records/1", "", &record); status != http.StatusOK || record.NextID == nil || *record.NextID != records[0].ID {
+		t.Errorf("expected completed record to refer to its next occurrence, got status %d, record: %v", status, record)
+	}
+}
+
+// TestAPIErrors checks status codes and bodies of failed requests
+func TestAPIErrors(t *testing.T) {
+	server := createTestServer(t)
+
+	cases := []struct {
+		method, path, body string
+		status             int
+	}{
+		{method: http.MethodGet, path: "/records/42", status: http.StatusNotFound},
+		{method: http.MethodDelete, path: "/records/42", status: http.StatusNotFound},
+		{method: http.MethodPatch, path: "/records/42", body: `{"content": "x"}`, status: http.StatusNotFound},
+		{method: http.MethodGet, path: "/records/abc", status: http.StatusNotFound},
+		{method: http.MethodGet, path: "/unknown", status: http.StatusNotFound},
+		{method: http.MethodPost, path: "/records", body: `{"content": " "}`, status: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/records", body: `{"content": "x", "colour": "red"}`, status: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/records", body: `{"content": "x", "priority": "urgent"}`, status: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/records", body: `not json`, status: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/records", body: `{"content": "x", "parent_id": 42}`, status: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/records", body: `{"content": "x", "tags": [{"name": " "}]}`, status: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/records", body: `{"content": "x", "recurrence": "garbage"}`, status: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/records?status=later", status: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/records?sort=random", status: http.StatusBadRequest},
+		{method: http.MethodPut, path: "/records", status: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, path: "/count", status: http.StatusMethodNotAllowed},
+	}
+
+	for _, c := range cases {
+		var body struct {
+			Error struct {
+				Message string `json:"message"`
+				Code    int    `json:"code"`
+			} `json:"error"`
+		}
+
+		status := request(t, server, c.method, c.path, c.body, &body)
+		if status != c.status || body.Error.Code != c.status || body.Error.Message == "" {
+			t.Errorf("expected status %d for %s %s, got %d with body: %v", c.status, c.method, c.path, status, body)
+		}
+	}
+
+	var record storage.Record
+	if status := request(t, server, http.MethodPost, "/records", `{"content": "x"}`, &record); status != http.StatusCreated {
+		t.Fatalf("expected record to be created, got status %d", status)
+	}
+
+	if status := request(t, server, http.MethodPatch, "/records/1", `{"id": 7}`, nil); status != http.StatusBadRequest {
+		t.Errorf("expected ID to be read-only, got status %d", status)
+	}
+}
+
+// TestRequestOrigin checks that requests addressed to other hosts and bodies sent as other media types,
+// which web pages can send across origins, are rejected
+func TestRequestOrigin(t *testing.T) {
+	server := createTestServer(t)
+
+	cases := []struct {
+		host, contentType string
+		status            int
+	}{
+		{host: "localhost:7070", contentType: "application/json; charset=utf-8", status: http.StatusCreated},
+		{host: "127.0.0.1", contentType: "application/json", status: http.StatusCreated},
+		{host: "[::1]:7070", contentType: "application/json", status: http.StatusCreated},
+		{host: "attacker.example:7070", contentType: "application/json", status: http.StatusForbidden},
+		{host: "localhost:7070", contentType: "text/plain", status: http.StatusUnsupportedMediaType},
+		{host: "localhost:7070", status: http.StatusUnsupportedMediaType},
+	}
+
+	for _, c := range cases {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/records", strings.NewReader(`{"content": "x"}`))
+		if err != nil {
+			t.Fatalf("request can not be created, unexpected error: %s", err)
+		}
+		req.Host = c.host
+		if c.contentType != "" {
+			req.Header.Set("Content-Type", c.contentType)
+		}
+
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatalf("request failed, unexpected error: %s", err)
+		}
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != c.status {
+			t.Errorf("expected status %d for host '%s' and content type '%s', got %d", c.status, c.host, c.contentType, resp.StatusCode)
+		}
+	}
+
+	var records []storage.Record
+	if status := request(t, server, http.MethodGet, "/records", "", &records); status != http.StatusOK || len(records) != 3 {
+		t.Errorf("expected only requests to the local host to create records, got status %d, records: %v", status, records)
+	}
+}
@@ -0,0 +1,291 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// backupDir defines the directory inside the storage directory with backups of the database
+const backupDir = "backups"
+
+// defaultBackupLimit defines the number of the latest backups kept unless the options set another one
+const defaultBackupLimit = 10
+
+// Backup defines a copy of the database, its name holds the time it has been made at and the reason, e.g.:
+// later.db.20261017-155036.883.before-import
+type Backup struct {
+	Name      string    `json:"name"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int64     `json:"size"`
+	Path      string    `json:"path"`
+}
+
+// Backups returns backups of the database, the latest first
+func (s *LocalStorage) Backups() ([]Backup, error) {
+	return listBackups(s.dbPath)
+}
+
+// BackupIfDue backs up the database if the latest backup is older than the interval; returns whether it has been made
+func (s *LocalStorage) BackupIfDue(interval time.Duration) (bool, error) {
+	backups, err := listBackups(s.dbPath)
+	if err != nil {
+		return false, err
+	}
+
+	if len(backups) > 0 && time.Since(backups[0].CreatedAt) < interval {
+		return false, nil
+	}
+
+	if _, err = backupDatabase(s.db, s.dbPath, "scheduled", s.options.backupLimit()); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// backupBefore backs up the database before a destructive change; databases without a file are backed up
+// by their backup function unless they are not kept at all
+func (s *LocalStorage) backupBefore(reason string) error {
+	if s.dbPath == "" {
+		if s.backup == nil {
+			return nil
+		}
+		return s.backup(reason)
+	}
+
+	_, err := backupDatabase(s.db, s.dbPath, reason, s.options.backupLimit())
+	return err
+}
+
+// RestoreBackup replaces the content of the database with the backup by its name through the live connection,
+// so that other connections to the database see the restored records without reopening it; the current database
+// is backed up first. Returns the backup of the replaced database
+func (s *LocalStorage) RestoreBackup(name string) (Backup, error) {
+	backups, err := listBackups(s.dbPath)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	var source *Backup
+	for i := range backups {
+		if backups[i].Name == name {
+			source = &backups[i]
+			break
+		}
+	}
+
+	if source == nil {
+		return Backup{}, newError(ErrNotFound, "backup '%s' is not found", name)
+	}
+
+	// the backup is copied before the current database is backed up, which could delete it as the oldest one
+	restored := s.dbPath + ".restore"
+	if err = copyFile(source.Path, restored); err != nil {
+		return Backup{}, fmt.Errorf("backup can not be copied, error: %w", err)
+	}
+	defer os.Remove(restored)
+
+	previous, err := backupDatabase(s.db, s.dbPath, "before-restore", s.options.backupLimit())
+	if err != nil {
+		return Backup{}, err
+	}
+
+	if err = retryOnBusy(func() error { return loadDatabase(s.db, restored) }); err != nil {
+		return previous, fmt.Errorf("backup can not be restored, error: %w", err)
+	}
+
+	// the backup could be made before migrations applied to the replaced database
+	if err = createTable(s.db, s.dbPath, s.options); err != nil {
+		return previous, fmt.Errorf("restored database can not be prepared, error: %w", err)
+	}
+
+	return previous, nil
+}
+
+// backupDatabase copies the database into the backups directory with SQLite online backup API,
+// which is consistent while other connections write into the database, and deletes backups beyond the limit
+func backupDatabase(db *gorm.DB, dbPath, reason string, limit int) (Backup, error) {
+	dir := filepath.Join(filepath.Dir(dbPath), backupDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return Backup{}, fmt.Errorf("backups directory can not be created, error: %w", err)
+	}
+
+	createdAt := time.Now()
+	name := fmt.Sprintf("%s.%s.%s", filepath.Base(dbPath), createdAt.Format(trashTimeMark), reason)
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return Backup{}, fmt.Errorf("backup %s already exists", path)
+	}
+
+	if err := retryOnBusy(func() error { return copyDatabase(db, path) }); err != nil {
+		_ = os.Remove(path)
+		return Backup{}, fmt.Errorf("database can not be backed up, error: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return Backup{}, fmt.Errorf("backup can not be accessed, error: %w", err)
+	}
+
+	if err = pruneBackups(dbPath, limit); err != nil {
+		return Backup{}, err
+	}
+
+	return Backup{Name: name, Reason: reason, CreatedAt: createdAt, Size: info.Size(), Path: path}, nil
+}
+
+// copyDatabase writes all pages of the database into the file at the path
+func copyDatabase(db *gorm.DB, path string) error {
+	return copyPages(db, path, false)
+}
+
+// loadDatabase replaces all pages of the database with pages of the database file at the path, the change is
+// written through the write-ahead log like any other transaction
+func loadDatabase(db *gorm.DB, path string) error {
+	return copyPages(db, path, true)
+}
+
+// copyPages copies all pages from the database into the file at the path, or from the file into the database
+// if load is set, with SQLite online backup API
+func copyPages(db *gorm.DB, path string, load bool) error {
+	live, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	file, err := sql.Open(sqlite.DriverName, path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	ctx := context.Background()
+	liveConn, err := live.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer liveConn.Close()
+
+	fileConn, err := file.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer fileConn.Close()
+
+	return liveConn.Raw(func(liveDriver interface{}) error {
+		return fileConn.Raw(func(fileDriver interface{}) error {
+			from, ok := liveDriver.(*sqlite3.SQLiteConn)
+			to, ok2 := fileDriver.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return errors.New("connections do not support the backup API")
+			}
+			if load {
+				from, to = to, from
+			}
+
+			backup, err := to.Backup("main", from, "main")
+			if err != nil {
+				return err
+			}
+
+			if _, err = backup.Step(-1); err != nil {
+				_ = backup.Finish()
+				return err
+			}
+
+			return backup.Finish()
+		})
+	})
+}
+
+// listBackups returns backups of the database from the backups directory, the latest first
+func listBackups(dbPath string) ([]Backup, error) {
+	prefix := filepath.Base(dbPath) + "."
+	paths, err := filepath.Glob(filepath.Join(filepath.Dir(dbPath), backupDir, prefix+"*"))
+	if err != nil {
+		return nil, fmt.Errorf("backups can not be listed, error: %w", err)
+	}
+
+	backups := make([]Backup, 0, len(paths))
+	for _, path := range paths {
+		name := filepath.Base(path)
+		mark := strings.TrimPrefix(name, prefix)
+		if len(mark) < len(trashTimeMark)+2 || mark[len(trashTimeMark)] != '.' {
+			continue
+		}
+
+		createdAt, err := time.ParseInLocation(trashTimeMark, mark[:len(trashTimeMark)], time.Local)
+		if err != nil {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("backup can not be accessed, error: %w", err)
+		}
+
+		backups = append(backups, Backup{
+			Name:      name,
+			Reason:    mark[len(trashTimeMark)+1:],
+			CreatedAt: createdAt,
+			Size:      info.Size(),
+			Path:      path,
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+
+	return backups, nil
+}
+
+// pruneBackups deletes backups of the database beyond the limit, the oldest ones
+func pruneBackups(dbPath string, limit int) error {
+	backups, err := listBackups(dbPath)
+	if err != nil {
+		return err
+	}
+
+	for i := limit; i < len(backups); i++ {
+		if err = os.Remove(backups[i].Path); err != nil {
+			return fmt.Errorf("outdated backup can not be deleted, error: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// copyFile copies the file at the source path into the destination path
+func copyFile(source, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(destination, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+
+	return out.Close()
+}
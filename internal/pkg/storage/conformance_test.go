@@ -0,0 +1,163 @@
+package storage_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/manmolecular/go-later/internal/pkg/storage"
+	"github.com/manmolecular/go-later/internal/pkg/storage/storagetest"
+)
+
+// TestConformance checks that all the storage backends and wrappers behave the same way
+func TestConformance(t *testing.T) {
+	backends := map[string]storagetest.Opener{
+		"sqlite": func(t *testing.T) storage.Storage {
+			s, err := storage.NewCustomLocalStorage(t.TempDir(), "db", "later.db", storage.Options{})
+			if err != nil {
+				t.Fatalf("sqlite storage can not be created, unexpected error: %s", err)
+			}
+			return s
+		},
+		"memory": func(t *testing.T) storage.Storage {
+			s, err := storage.NewMemoryStorage()
+			if err != nil {
+				t.Fatalf("memory storage can not be created, unexpected error: %s", err)
+			}
+			return s
+		},
+		"file": func(t *testing.T) storage.Storage {
+			s, err := storage.NewFileStorage(filepath.Join(t.TempDir(), "tasks.json"), storage.Options{})
+			if err != nil {
+				t.Fatalf("file storage can not be created, unexpected error: %s", err)
+			}
+			return s
+		},
+		"encrypted": func(t *testing.T) storage.Storage {
+			s, err := storage.NewCustomLocalStorage(t.TempDir(), "db", "later.db", storage.Options{})
+			if err != nil {
+				t.Fatalf("sqlite storage can not be created, unexpected error: %s", err)
+			}
+
+			params, err := storage.NewEncryptionParams()
+			if err != nil {
+				t.Fatalf("encryption parameters can not be created, unexpected error: %s", err)
+			}
+			params.Iterations = 1 // key derivation strength is irrelevant here
+
+			key := storage.DeriveKey([]byte("passphrase"), params)
+			if params, err = s.EncryptData(key, params); err != nil {
+				t.Fatalf("storage can not be encrypted, unexpected error: %s", err)
+			}
+
+			encrypted, err := storage.NewEncryptedStorage(s, key, params)
+			if err != nil {
+				t.Fatalf("encrypted storage can not be created, unexpected error: %s", err)
+			}
+			return encrypted
+		},
+	}
+
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			storagetest.Run(t, open)
+		})
+	}
+}
+
+// TestFileStorage checks that the file storage keeps its state, including the journal, between openings
+func TestFileStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.json")
+
+	s, err := storage.NewFileStorage(path, storage.Options{})
+	if err != nil {
+		t.Fatalf("file storage can not be created, unexpected error: %s", err)
+	}
+
+	records := []storage.Record{{Content: "first", Tags: []storage.Tag{{Name: "home"}}}, {Content: "second"}}
+	for i := range records {
+		if err = s.CreateRecord(&records[i]); err != nil {
+			t.Fatalf("record can not be created, unexpected error: %s", err)
+		}
+	}
+
+	if err = s.MoveRecord(records[1].ID, "work"); err != nil {
+		t.Fatalf("record can not be moved, unexpected error: %s", err)
+	}
+
+	if s, err = storage.NewFileStorage(path, storage.Options{}); err != nil {
+		t.Fatalf("file storage can not be reopened, unexpected error: %s", err)
+	}
+
+	tagged, err := s.GetRecords(storage.Filter{Tag: "home"})
+	if err != nil || len(tagged) != 1 || tagged[0].ID != records[0].ID {
+		t.Errorf("tagged record expected to be kept, got: %v, error: %v", tagged, err)
+	}
+
+	if description, err := s.Undo(); err != nil || description != "move record 2" {
+		t.Errorf("journal expected to be kept, got: %q, error: %v", description, err)
+	}
+
+	if s, err = storage.NewFileStorage(path, storage.Options{}); err != nil {
+		t.Fatalf("file storage can not be reopened, unexpected error: %s", err)
+	}
+
+	if record, _ := s.GetRecordByID(records[1].ID); record.List != nil {
+		t.Errorf("undone move expected to be kept, got: %v", record.List)
+	}
+
+	if _, err = s.ImportRecords(nil, true); err != nil {
+		t.Fatalf("records can not be replaced, unexpected error: %s", err)
+	}
+
+	backups, err := s.Backups()
+	if err != nil || len(backups) != 1 || backups[0].Reason != "before-import" {
+		t.Fatalf("exactly 1 backup before import expected, got: %v, error: %v", backups, err)
+	}
+
+	if _, err = s.RestoreBackup(backups[0].Name); err != nil {
+		t.Fatalf("backup can not be restored, unexpected error: %s", err)
+	}
+
+	if count, _ := s.CountRecords(storage.Filter{}); count != 2 {
+		t.Errorf("records expected to be restored from the backup, got %d records", count)
+	}
+
+	if err = s.CleanUp(); err != nil {
+		t.Fatalf("file storage can not be cleaned up, unexpected error: %s", err)
+	}
+
+	snapshots, err := filepath.Glob(filepath.Join(filepath.Dir(path), "trash", "tasks.json.*"))
+	if err != nil || len(snapshots) != 1 {
+		t.Errorf("exactly 1 file expected in the trash, got: %v, error: %v", snapshots, err)
+	}
+}
+
+// TestOpen checks that storages are opened by their URIs
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	uris := map[string]string{
+		"sqlite://" + filepath.ToSlash(filepath.Join(dir, "later.db")): "*storage.LocalStorage",
+		"memory://": "*storage.MemoryStorage",
+		"file://" + filepath.ToSlash(filepath.Join(dir, "tasks.json")): "*storage.FileStorage",
+	}
+
+	for uri, expected := range uris {
+		s, err := storage.Open(uri, storage.Options{})
+		if err != nil {
+			t.Errorf("storage %s can not be opened, unexpected error: %s", uri, err)
+			continue
+		}
+
+		if got := reflect.TypeOf(s).String(); got != expected {
+			t.Errorf("storage %s expected to be %s, got: %s", uri, expected, got)
+		}
+		_ = s.Close()
+	}
+
+	for _, uri := range []string{"postgres://localhost/later", "later.db", "file://"} {
+		if _, err := storage.Open(uri, storage.Options{}); err == nil {
+			t.Errorf("storage %s can not be opened, error expected", uri)
+		}
+	}
+}
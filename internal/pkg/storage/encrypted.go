@@ -0,0 +1,655 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	KeySize           = 32 // size of the derived encryption key in bytes
+	encryptionSetting = "encryption"
+	sealedPrefix      = "enc1:" // marks values encrypted with the first version of the scheme
+	checkText         = "later" // known text sealed with the key to verify it before use
+	saltSize          = 16
+	defaultIterations = 600000
+)
+
+// ErrWrongKey is returned when the passphrase or the key file does not match the encrypted database
+var ErrWrongKey = errors.New("passphrase or key file is wrong")
+
+// EncryptionParams defines how the key is derived from the passphrase or the key file, they are kept in the database
+type EncryptionParams struct {
+	Salt       []byte `json:"salt"`
+	Iterations int    `json:"iterations"`
+	Check      string `json:"check"` // known text sealed with the key
+}
+
+// NewEncryptionParams returns parameters with a random salt, the check is set when the database is encrypted
+func NewEncryptionParams() (EncryptionParams, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return EncryptionParams{}, fmt.Errorf("salt can not be generated, error: %w", err)
+	}
+
+	return EncryptionParams{Salt: salt, Iterations: defaultIterations}, nil
+}
+
+// DeriveKey returns the key derived from the passphrase or the content of the key file with PBKDF2-HMAC-SHA256
+func DeriveKey(secret []byte, params EncryptionParams) []byte {
+	return pbkdf2(secret, params.Salt, params.Iterations, KeySize)
+}
+
+// pbkdf2 implements PBKDF2 from RFC 8018 with HMAC-SHA256 as the pseudorandom function
+func pbkdf2(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	key := make([]byte, 0, blocks*hashLen)
+	counter := make([]byte, 4)
+	u := make([]byte, 0, hashLen)
+	for block := 1; block <= blocks; block++ {
+		binary.BigEndian.PutUint32(counter, uint32(block))
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(counter)
+		u = prf.Sum(u[:0])
+
+		t := make([]byte, hashLen)
+		copy(t, u)
+		for n := 2; n <= iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range t {
+				t[i] ^= u[i]
+			}
+		}
+		key = append(key, t...)
+	}
+
+	return key[:keyLen]
+}
+
+// sealer encrypts values with AES-256-GCM using a synthetic nonce: HMAC-SHA256 of the value. Equal values
+// are sealed into equal ciphertexts, so tags, lists and duplicates are still matched in the database,
+// while nothing but the equality of values is revealed
+type sealer struct {
+	aead   cipher.AEAD
+	macKey []byte
+}
+
+// newSealer derives encryption and nonce keys from the key
+func newSealer(key []byte) (*sealer, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key size is %d bytes, expected %d", len(key), KeySize)
+	}
+
+	block, err := aes.NewCipher(subkey(key, "later encryption key"))
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sealer{aead: aead, macKey: subkey(key, "later nonce key")}, nil
+}
+
+// subkey derives a key for the purpose from the key
+func subkey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// seal returns the encrypted value in lower case hex, so it survives normalization of tag and list names
+func (s *sealer) seal(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, s.macKey)
+	mac.Write([]byte(value))
+	nonce := mac.Sum(nil)[:s.aead.NonceSize()]
+
+	return sealedPrefix + hex.EncodeToString(s.aead.Seal(nonce, nonce, []byte(value), nil))
+}
+
+// open returns the decrypted value, values which are not sealed are returned as they are
+func (s *sealer) open(value string) (string, error) {
+	if !strings.HasPrefix(value, sealedPrefix) {
+		return value, nil
+	}
+
+	data, err := hex.DecodeString(strings.TrimPrefix(value, sealedPrefix))
+	if err != nil || len(data) < s.aead.NonceSize() {
+		return "", errors.New("encrypted value is malformed")
+	}
+
+	plain, err := s.aead.Open(nil, data[:s.aead.NonceSize()], data[s.aead.NonceSize():], nil)
+	if err != nil {
+		return "", ErrWrongKey
+	}
+
+	return string(plain), nil
+}
+
+// sealRecord encrypts content, tags and the list of the record in place
+func (s *sealer) sealRecord(record *Record) {
+	record.Content = s.seal(record.Content)
+	for i := range record.Tags {
+		record.Tags[i].Name = s.seal(NormalizeTag(record.Tags[i].Name))
+	}
+	if record.List != nil {
+		record.List.Name = s.seal(NormalizeList(record.List.Name))
+	}
+}
+
+// openRecord decrypts content, tags and the list of the record in place
+func (s *sealer) openRecord(record *Record) error {
+	var err error
+	if record.Content, err = s.open(record.Content); err != nil {
+		return err
+	}
+	for i := range record.Tags {
+		if record.Tags[i].Name, err = s.open(record.Tags[i].Name); err != nil {
+			return err
+		}
+	}
+	if record.List != nil {
+		if record.List.Name, err = s.open(record.List.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sealFilter returns the filter with the encrypted tag and list
+func (s *sealer) sealFilter(filter Filter) Filter {
+	filter.Tag = s.seal(NormalizeTag(filter.Tag))
+	filter.List = s.seal(NormalizeList(filter.List))
+	return filter
+}
+
+// EncryptedStorage encrypts content, tags and lists of records before they reach the underlying storage and
+// decrypts them on the way back; dates, priorities, statuses and recurrence rules are stored as they are
+type EncryptedStorage struct {
+	storage Storage
+	sealer  *sealer
+}
+
+// Validate that structure satisfies the interface
+var _ Storage = (*EncryptedStorage)(nil)
+
+// NewEncryptedStorage wraps the storage, the key is verified with the check of the encryption parameters
+func NewEncryptedStorage(s Storage, key []byte, params EncryptionParams) (*EncryptedStorage, error) {
+	sealer, err := verifiedSealer(key, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptedStorage{storage: s, sealer: sealer}, nil
+}
+
+// VerifyKey returns ErrWrongKey if the key does not match the encryption parameters
+func VerifyKey(key []byte, params EncryptionParams) error {
+	_, err := verifiedSealer(key, params)
+	return err
+}
+
+// verifiedSealer returns the sealer with the key which opens the check of the encryption parameters
+func verifiedSealer(key []byte, params EncryptionParams) (*sealer, error) {
+	sealer, err := newSealer(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if text, err := sealer.open(params.Check); err != nil || text != checkText {
+		return nil, ErrWrongKey
+	}
+
+	return sealer, nil
+}
+
+// CreateRecord encrypts and creates a record, assigned ID and creation time are set on the record
+func (e *EncryptedStorage) CreateRecord(record *Record) error {
+	sealed := copyRecord(*record)
+	e.sealer.sealRecord(&sealed)
+	if err := e.storage.CreateRecord(&sealed); err != nil {
+		return err
+	}
+
+	record.ID, record.CreatedAt = sealed.ID, sealed.CreatedAt
+	return nil
+}
+
+// GetRecordByID returns the decrypted record by its ID
+func (e *EncryptedStorage) GetRecordByID(id uint) (Record, error) {
+	record, err := e.storage.GetRecordByID(id)
+	if err != nil {
+		return record, err
+	}
+
+	err = e.sealer.openRecord(&record)
+	return record, err
+}
+
+// GetRecords returns decrypted records matching the filter
+func (e *EncryptedStorage) GetRecords(filter Filter) ([]Record, error) {
+	records, err := e.storage.GetRecords(e.sealer.sealFilter(filter))
+	if err != nil {
+		return records, err
+	}
+
+	err = e.openRecords(records)
+	return records, err
+}
+
+// CountRecords counts records matching the filter
+func (e *EncryptedStorage) CountRecords(filter Filter) (uint, error) {
+	return e.storage.CountRecords(e.sealer.sealFilter(filter))
+}
+
+// UpdateRecord encrypts and saves content, due date and priority of a record by its ID
+func (e *EncryptedStorage) UpdateRecord(record *Record) error {
+	sealed := copyRecord(*record)
+	e.sealer.sealRecord(&sealed)
+	if err := e.storage.UpdateRecord(&sealed); err != nil {
+		return err
+	}
+
+	record.UpdatedAt = sealed.UpdatedAt
+	return nil
+}
+
+// SaveRecord encrypts and saves all the editable attributes of a record by its ID as a single change
+func (e *EncryptedStorage) SaveRecord(record *Record) error {
+	sealed := copyRecord(*record)
+	e.sealer.sealRecord(&sealed)
+	if err := e.storage.SaveRecord(&sealed); err != nil {
+		return err
+	}
+
+	record.UpdatedAt = sealed.UpdatedAt
+	return nil
+}
+
+// MarkRecordDone marks a record by its ID as completed or pending
+func (e *EncryptedStorage) MarkRecordDone(id uint, done bool) error {
+	return e.storage.MarkRecordDone(id, done)
+}
+
+// SetRecordPriority sets the priority of a record by its ID
+func (e *EncryptedStorage) SetRecordPriority(id uint, priority Priority) error {
+	return e.storage.SetRecordPriority(id, priority)
+}
+
+// TagRecord labels a record with the encrypted tag
+func (e *EncryptedStorage) TagRecord(id uint, tag string) error {
+	if NormalizeTag(tag) == "" {
+		return e.storage.TagRecord(id, tag)
+	}
+
+	return e.storage.TagRecord(id, e.sealer.seal(NormalizeTag(tag)))
+}
+
+// UntagRecord removes the encrypted tag from a record
+func (e *EncryptedStorage) UntagRecord(id uint, tag string) error {
+	return e.storage.UntagRecord(id, e.sealer.seal(NormalizeTag(tag)))
+}
+
+// GetTags returns decrypted tags with the number of records labeled by them
+func (e *EncryptedStorage) GetTags() ([]TagCount, error) {
+	tags, err := e.storage.GetTags()
+	if err != nil {
+		return tags, err
+	}
+
+	for i := range tags {
+		if tags[i].Name, err = e.sealer.open(tags[i].Name); err != nil {
+			return nil, err
+		}
+	}
+
+	// ciphertexts are ordered randomly, so tags with the same count are ordered by their names again
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].Count > tags[j].Count || tags[i].Count == tags[j].Count && tags[i].Name < tags[j].Name
+	})
+
+	return tags, nil
+}
+
+// MoveRecord moves a record into the encrypted list
+func (e *EncryptedStorage) MoveRecord(id uint, list string) error {
+	return e.storage.MoveRecord(id, e.sealer.seal(NormalizeList(list)))
+}
+
+// GetLists returns decrypted lists with the number of records matching the filter in them
+func (e *EncryptedStorage) GetLists(filter Filter) ([]ListCount, error) {
+	lists, err := e.storage.GetLists(e.sealer.sealFilter(filter))
+	if err != nil {
+		return lists, err
+	}
+
+	for i := range lists {
+		if lists[i].Name, err = e.sealer.open(lists[i].Name); err != nil {
+			return nil, err
+		}
+	}
+
+	// ciphertexts are ordered randomly, so lists are ordered by their names again
+	sort.SliceStable(lists, func(i, j int) bool { return lists[i].Name < lists[j].Name })
+
+	return lists, nil
+}
+
+// GetProgress returns the number of completed and all subtasks of the records by their IDs
+func (e *EncryptedStorage) GetProgress(ids []uint) (map[uint]Progress, error) {
+	return e.storage.GetProgress(ids)
+}
+
+// SearchRecords matches the terms of the query against decrypted content, the search index holds only ciphertexts
+func (e *EncryptedStorage) SearchRecords(query string) ([]SearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, newError(ErrInvalidInput, "search query has no terms")
+	}
+
+	records, err := e.GetRecords(Filter{Order: OrderNewest})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SearchResult
+	for _, record := range records {
+		content := strings.ToLower(record.Content)
+		matched := true
+		for _, term := range terms {
+			if !strings.Contains(content, strings.ToLower(term)) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			results = append(results, SearchResult{Record: record, Snippet: highlight(record.Content, terms)})
+		}
+	}
+
+	return results, nil
+}
+
+// ImportRecords encrypts and adds records, skipping duplicates
+func (e *EncryptedStorage) ImportRecords(records []Record, replace bool) (uint, error) {
+	sealed := make([]Record, 0, len(records))
+	for _, record := range records {
+		record = copyRecord(record)
+		e.sealer.sealRecord(&record)
+		sealed = append(sealed, record)
+	}
+
+	return e.storage.ImportRecords(sealed, replace)
+}
+
+// DeleteRecordByID deletes a record with its subtasks by its ID
+func (e *EncryptedStorage) DeleteRecordByID(id uint) error {
+	return e.storage.DeleteRecordByID(id)
+}
+
+// DeleteRecords deletes records matching the filter with their subtasks
+func (e *EncryptedStorage) DeleteRecords(filter Filter) (uint, error) {
+	return e.storage.DeleteRecords(e.sealer.sealFilter(filter))
+}
+
+// DeleteLastRecord deletes the latest record
+func (e *EncryptedStorage) DeleteLastRecord() error {
+	return e.storage.DeleteLastRecord()
+}
+
+// Undo reverts the latest change
+func (e *EncryptedStorage) Undo() (string, error) {
+	return e.storage.Undo()
+}
+
+// Redo applies again the latest reverted change
+func (e *EncryptedStorage) Redo() (string, error) {
+	return e.storage.Redo()
+}
+
+// Migrations returns migrations of the underlying storage
+func (e *EncryptedStorage) Migrations() ([]Migration, error) {
+	return e.storage.Migrations()
+}
+
+// Migrate applies pending migrations of the underlying storage
+func (e *EncryptedStorage) Migrate() ([]Migration, string, error) {
+	return e.storage.Migrate()
+}
+
+// RollbackMigrations reverts migrations of the underlying storage above the version
+func (e *EncryptedStorage) RollbackMigrations(version uint) ([]Migration, string, error) {
+	return e.storage.RollbackMigrations(version)
+}
+
+// Backups returns backups of the underlying storage, they hold encrypted values as well
+func (e *EncryptedStorage) Backups() ([]Backup, error) {
+	return e.storage.Backups()
+}
+
+// RestoreBackup replaces the underlying database with the backup by its name
+func (e *EncryptedStorage) RestoreBackup(name string) (Backup, error) {
+	return e.storage.RestoreBackup(name)
+}
+
+// Close closes the underlying storage
+func (e *EncryptedStorage) Close() error {
+	return e.storage.Close()
+}
+
+// CleanUp cleans up the underlying storage, which stays encrypted with the same key
+func (e *EncryptedStorage) CleanUp() error {
+	return e.storage.CleanUp()
+}
+
+// openRecords decrypts the records in place
+func (e *EncryptedStorage) openRecords(records []Record) error {
+	for i := range records {
+		if err := e.sealer.openRecord(&records[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setting defines a named value of the database settings
+type setting struct {
+	Name  string `gorm:"primarykey"`
+	Value string
+}
+
+// settings returns all the settings of the database, none if its schema has no settings yet
+func (s *LocalStorage) settings() ([]setting, error) {
+	if !s.db.Migrator().HasTable(&setting{}) {
+		return nil, nil
+	}
+
+	var stored []setting
+	if err := s.db.Find(&stored).Error; err != nil {
+		return nil, fmt.Errorf("can not get settings, error: %w", err)
+	}
+
+	return stored, nil
+}
+
+// Encryption returns encryption parameters of the database or nil if it is not encrypted
+func (s *LocalStorage) Encryption() (*EncryptionParams, error) {
+	if !s.db.Migrator().HasTable(&setting{}) {
+		return nil, nil
+	}
+
+	var stored []setting
+	if err := s.db.Where("name = ?", encryptionSetting).Find(&stored).Error; err != nil {
+		return nil, fmt.Errorf("can not get encryption parameters, error: %w", err)
+	}
+
+	if len(stored) == 0 {
+		return nil, nil
+	}
+
+	var params EncryptionParams
+	if err := json.Unmarshal([]byte(stored[0].Value), &params); err != nil {
+		return nil, fmt.Errorf("encryption parameters are invalid, error: %w", err)
+	}
+
+	return &params, nil
+}
+
+// EncryptData encrypts content, tags and lists of all records with the key and keeps the parameters; the undo
+// history, the trash and backups are deleted, as they hold plain values, and the database file is rebuilt,
+// so no plain values are left in its free pages
+func (s *LocalStorage) EncryptData(key []byte, params EncryptionParams) (EncryptionParams, error) {
+	if current, err := s.Encryption(); err != nil || current != nil {
+		if err == nil {
+			err = errors.New("database is already encrypted")
+		}
+		return params, err
+	}
+
+	sealer, err := newSealer(key)
+	if err != nil {
+		return params, err
+	}
+	params.Check = sealer.seal(checkText)
+
+	value, err := json.Marshal(params)
+	if err != nil {
+		return params, err
+	}
+
+	err = s.convertData(sealer.seal, func(tx *gorm.DB) error {
+		return tx.Create(&setting{Name: encryptionSetting, Value: string(value)}).Error
+	})
+	if err != nil {
+		return params, err
+	}
+
+	copies, err := trashSnapshots(s.dbPath)
+	if err != nil {
+		return params, err
+	}
+
+	backups, err := listBackups(s.dbPath)
+	if err != nil {
+		return params, err
+	}
+
+	for _, backup := range backups {
+		copies = append(copies, backup.Path)
+	}
+
+	for _, path := range copies {
+		if err = os.Remove(path); err != nil {
+			return params, fmt.Errorf("plain copy of the database can not be deleted, error: %w", err)
+		}
+	}
+
+	return params, nil
+}
+
+// DecryptData decrypts content, tags and lists of all records with the key and drops encryption parameters,
+// the undo history is deleted, as it holds encrypted values
+func (s *LocalStorage) DecryptData(key []byte) error {
+	params, err := s.Encryption()
+	if err != nil {
+		return err
+	}
+	if params == nil {
+		return errors.New("database is not encrypted")
+	}
+
+	sealer, err := verifiedSealer(key, *params)
+	if err != nil {
+		return err
+	}
+
+	var failure error
+	open := func(value string) string {
+		plain, err := sealer.open(value)
+		if err != nil && failure == nil {
+			failure = err
+		}
+		return plain
+	}
+
+	return s.convertData(open, func(tx *gorm.DB) error {
+		if failure != nil {
+			return failure
+		}
+		return tx.Where("name = ?", encryptionSetting).Delete(&setting{}).Error
+	})
+}
+
+// convertData replaces content of records and names of tags and lists with their converted values in a transaction,
+// deletes the undo history, then rebuilds the search index and the database file
+func (s *LocalStorage) convertData(convert func(string) string, finish func(tx *gorm.DB) error) error {
+	err := retryOnBusy(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			for _, table := range []struct{ name, column string }{
+				{"records", "content"},
+				{"tags", "name"},
+				{"lists", "name"},
+			} {
+				var rows []struct {
+					ID    uint
+					Value string
+				}
+				if err := tx.Table(table.name).Select("id, " + table.column + " AS value").Scan(&rows).Error; err != nil {
+					return err
+				}
+				for _, row := range rows {
+					if err := tx.Table(table.name).Where("id = ?", row.ID).Update(table.column, convert(row.Value)).Error; err != nil {
+						return err
+					}
+				}
+			}
+
+			if err := tx.Where("1 = 1").Delete(&journalEntry{}).Error; err != nil {
+				return err
+			}
+
+			return finish(tx)
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("records can not be converted, error: %w", err)
+	}
+
+	if hasFullTextSearch(s.db) {
+		if err = s.db.Exec("INSERT INTO records_fts(records_fts) VALUES ('rebuild')").Error; err != nil {
+			return fmt.Errorf("search index can not be rebuilt, error: %w", err)
+		}
+	}
+
+	if err = s.db.Exec("VACUUM").Error; err != nil {
+		return fmt.Errorf("database file can not be rebuilt, error: %w", err)
+	}
+
+	return checkpoint(s.db)
+}
@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var _ Storage = (*FileStorage)(nil)
+
+// fileData defines the content of the storage file
+type fileData struct {
+	Lists   []string    `json:"lists"`
+	Records []Record    `json:"records"`
+	Journal []fileEntry `json:"journal"`
+}
+
+// fileEntry defines an operation made through the file storage with images of affected records
+type fileEntry struct {
+	Description string        `json:"description"`
+	Images      []recordImage `json:"images"`
+	Undone      bool          `json:"undone"`
+}
+
+// FileStorage keeps records in a plain JSON file, which is loaded into a memory database on open and rewritten
+// after each change; it is meant for a single process at a time, as changes made to the file by other processes
+// after it has been opened are overwritten
+type FileStorage struct {
+	*MemoryStorage
+	path string
+}
+
+// NewFileStorage opens the JSON file storage at the path, the file is created on the first change
+func NewFileStorage(path string, options Options) (*FileStorage, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("storage file path is invalid, error: %w", err)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("storage directory can not be created, error: %w", err)
+	}
+
+	s := &FileStorage{MemoryStorage: &MemoryStorage{LocalStorage: &LocalStorage{options: options}}, path: path}
+	if err = s.read(); err != nil {
+		return nil, err
+	}
+	s.save, s.backup = s.write, s.backupFile
+
+	return s, nil
+}
+
+// Path returns the location of the storage file
+func (s *FileStorage) Path() string {
+	return s.path
+}
+
+// Backups returns backups of the storage file, the latest first
+func (s *FileStorage) Backups() ([]Backup, error) {
+	return listBackups(s.path)
+}
+
+// RestoreBackup replaces the storage file with the backup by its name, the current file is backed up first;
+// returns the backup of the replaced file
+func (s *FileStorage) RestoreBackup(name string) (Backup, error) {
+	backups, err := listBackups(s.path)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	var source *Backup
+	for i := range backups {
+		if backups[i].Name == name {
+			source = &backups[i]
+			break
+		}
+	}
+
+	if source == nil {
+		return Backup{}, newError(ErrNotFound, "backup '%s' is not found", name)
+	}
+
+	// the backup is copied before the current file is backed up, which could delete it as the oldest one
+	restored := s.path + ".restore"
+	if err = copyFile(source.Path, restored); err != nil {
+		return Backup{}, fmt.Errorf("backup can not be copied, error: %w", err)
+	}
+	defer os.Remove(restored)
+
+	if err = s.writeAll(); err != nil {
+		return Backup{}, err
+	}
+
+	previous, err := copyBackup(s.path, "before-restore", s.options.backupLimit())
+	if err != nil {
+		return Backup{}, err
+	}
+
+	if err = os.Rename(restored, s.path); err != nil {
+		return previous, fmt.Errorf("storage file can not be replaced, error: %w", err)
+	}
+
+	return previous, s.read()
+}
+
+// CleanUp backs up the storage file and moves it into the trash next to it, leaving the storage empty
+func (s *FileStorage) CleanUp() error {
+	if err := s.writeAll(); err != nil {
+		return err
+	}
+
+	if err := s.backupFile("before-clean"); err != nil {
+		return err
+	}
+
+	if err := moveToTrash(s.path); err != nil {
+		return fmt.Errorf("storage file can not be cleaned up, error: %w", err)
+	}
+
+	return s.MemoryStorage.CleanUp()
+}
+
+// read loads the state from the storage file into a new memory database, a missing file means the empty storage
+func (s *FileStorage) read() error {
+	var data fileData
+	content, err := os.ReadFile(s.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("storage file can not be read, error: %w", err)
+	default:
+		if err = json.Unmarshal(content, &data); err != nil {
+			return fmt.Errorf("storage file %s is not valid, error: %w", s.path, err)
+		}
+	}
+
+	db, err := openMemoryDb()
+	if err != nil {
+		return err
+	}
+
+	if err = db.Transaction(func(tx *gorm.DB) error { return loadData(tx, data) }); err != nil {
+		_ = closeDb(db)
+		return fmt.Errorf("storage file %s can not be loaded, error: %w", s.path, err)
+	}
+
+	return s.replaceDb(db)
+}
+
+// writeAll writes the current state into the storage file
+func (s *FileStorage) writeAll() error {
+	return s.db.Transaction(s.write)
+}
+
+// write replaces the storage file with the state of the database atomically, so that the file is never left
+// half-written
+func (s *FileStorage) write(tx *gorm.DB) error {
+	data, err := dumpData(tx)
+	if err != nil {
+		return fmt.Errorf("storage state can not be read, error: %w", err)
+	}
+
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("storage state can not be encoded, error: %w", err)
+	}
+
+	temporary := s.path + ".tmp"
+	if err = os.WriteFile(temporary, append(content, '\n'), 0600); err != nil {
+		return fmt.Errorf("storage file can not be written, error: %w", err)
+	}
+
+	if err = os.Rename(temporary, s.path); err != nil {
+		_ = os.Remove(temporary)
+		return fmt.Errorf("storage file can not be replaced, error: %w", err)
+	}
+
+	return nil
+}
+
+// backupFile copies the storage file into the backups directory unless it does not exist yet
+func (s *FileStorage) backupFile(reason string) error {
+	if _, err := os.Stat(s.path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	_, err := copyBackup(s.path, reason, s.options.backupLimit())
+	return err
+}
+
+// loadData fills the empty database with the lists, records and the journal of the storage file
+func loadData(tx *gorm.DB, data fileData) error {
+	for _, name := range data.Lists {
+		if _, err := resolveList(tx, name); err != nil {
+			return err
+		}
+	}
+
+	for i := range data.Records {
+		if err := restoreRecord(tx, data.Records[i].ID, &data.Records[i]); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range data.Journal {
+		images, err := json.Marshal(entry.Images)
+		if err != nil {
+			return fmt.Errorf("can not encode records state, error: %w", err)
+		}
+
+		if err = tx.Create(&journalEntry{Description: entry.Description, Images: string(images), Undone: entry.Undone}).Error; err != nil {
+			return fmt.Errorf("can not record the operation, error: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// dumpData returns the state of the database: lists by name, records by ID and the journal, the oldest first
+func dumpData(tx *gorm.DB) (fileData, error) {
+	data := fileData{Lists: []string{}, Records: []Record{}, Journal: []fileEntry{}}
+	if err := tx.Model(&List{}).Order("name ASC").Pluck("name", &data.Lists).Error; err != nil {
+		return data, err
+	}
+
+	var ids []uint
+	if err := tx.Model(&Record{}).Order("id ASC").Pluck("id", &ids).Error; err != nil {
+		return data, err
+	}
+
+	idToRecord, err := loadRecords(tx, ids)
+	if err != nil {
+		return data, err
+	}
+	for _, id := range ids {
+		data.Records = append(data.Records, *idToRecord[id])
+	}
+
+	var entries []journalEntry
+	if err = tx.Order("id ASC").Find(&entries).Error; err != nil {
+		return data, err
+	}
+
+	for _, entry := range entries {
+		var images []recordImage
+		if err = json.Unmarshal([]byte(entry.Images), &images); err != nil {
+			return data, fmt.Errorf("can not decode records state, error: %w", err)
+		}
+		data.Journal = append(data.Journal, fileEntry{Description: entry.Description, Images: images, Undone: entry.Undone})
+	}
+
+	return data, nil
+}
+
+// copyBackup copies the file into the backups directory next to it and deletes outdated backups
+func copyBackup(path, reason string, limit int) (Backup, error) {
+	dir := filepath.Join(filepath.Dir(path), backupDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return Backup{}, fmt.Errorf("backups directory can not be created, error: %w", err)
+	}
+
+	createdAt := time.Now()
+	name := fmt.Sprintf("%s.%s.%s", filepath.Base(path), createdAt.Format(trashTimeMark), reason)
+	backup := filepath.Join(dir, name)
+	if err := copyFile(path, backup); err != nil {
+		_ = os.Remove(backup)
+		return Backup{}, fmt.Errorf("storage file can not be backed up, error: %w", err)
+	}
+
+	info, err := os.Stat(backup)
+	if err != nil {
+		return Backup{}, fmt.Errorf("backup can not be accessed, error: %w", err)
+	}
+
+	if err = pruneBackups(path, limit); err != nil {
+		return Backup{}, err
+	}
+
+	return Backup{Name: name, Reason: reason, CreatedAt: createdAt, Size: info.Size(), Path: backup}, nil
+}
@@ -0,0 +1,380 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	journalLimit    = 100                   // number of the latest operations kept in the journal
+	trashDir        = "trash"               // directory inside the storage directory with cleaned up databases
+	trashLimit      = 5                     // number of the latest cleaned up databases kept in the trash
+	trashTimeMark   = "20060102-150405.000" // suffix format of cleaned up database files
+	maxDescribedIDs = 10                    // number of record IDs listed in descriptions of operations at most
+	loadBatchSize   = 500                   // number of records loaded at once, preloading binds each of their IDs
+)
+
+// journalEntry defines an operation made through the storage with images of affected records
+type journalEntry struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	Description string
+	Images      string // JSON-encoded list of recordImage
+	Undone      bool
+}
+
+// recordImage defines the state of a record before and after an operation, nil state means absence of the record
+type recordImage struct {
+	ID     uint    `json:"id"`
+	Before *Record `json:"before"`
+	After  *Record `json:"after"`
+}
+
+// change applies a mutation within the transaction and returns IDs of the records it has created
+type change func(tx *gorm.DB) ([]uint, error)
+
+// Undo reverts the latest operation made through the storage and returns its description;
+// when the journal is exhausted and the storage is empty, the latest cleaned up database is restored
+func (s *LocalStorage) Undo() (string, error) {
+	var entry journalEntry
+	if err := s.db.Where("undone = ?", false).Order("id DESC").Limit(1).Find(&entry).Error; err != nil {
+		return "", fmt.Errorf("can not read the journal, error: %w", err)
+	}
+
+	if entry.ID == 0 {
+		return s.restoreTrash()
+	}
+
+	if err := s.replay(entry, false); err != nil {
+		return "", fmt.Errorf("can not undo %s, error: %w", entry.Description, err)
+	}
+
+	return entry.Description, nil
+}
+
+// Redo applies again the earliest operation reverted by Undo and returns its description
+func (s *LocalStorage) Redo() (string, error) {
+	var entry journalEntry
+	if err := s.db.Where("undone = ?", true).Order("id ASC").Limit(1).Find(&entry).Error; err != nil {
+		return "", fmt.Errorf("can not read the journal, error: %w", err)
+	}
+
+	if entry.ID == 0 {
+		return "", errors.New("nothing to redo")
+	}
+
+	if err := s.replay(entry, true); err != nil {
+		return "", fmt.Errorf("can not redo %s, error: %w", entry.Description, err)
+	}
+
+	return entry.Description, nil
+}
+
+// journaled applies the change in a transaction, recording images of the given and created records in the journal;
+// a new operation discards operations reverted by Undo, so they can not be redone anymore; the transaction is
+// retried while the database is locked by other connections
+func (s *LocalStorage) journaled(action string, affected []uint, apply change) error {
+	return retryOnBusy(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			return s.journal(tx, action, append([]uint(nil), affected...), apply)
+		})
+	})
+}
+
+// journaledSelection applies the change like journaled, but selects the affected records within the same transaction,
+// so that records changed by other connections in between are not missed; nothing is changed nor journaled
+// when no records are selected
+func (s *LocalStorage) journaledSelection(action string, selectIDs func(tx *gorm.DB) ([]uint, error), apply change) error {
+	return retryOnBusy(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			ids, err := selectIDs(tx)
+			if err != nil || len(ids) == 0 {
+				return err
+			}
+
+			return s.journal(tx, action, ids, apply)
+		})
+	})
+}
+
+// journal applies the change within the transaction and records it in the journal
+func (s *LocalStorage) journal(tx *gorm.DB, action string, ids []uint, apply change) error {
+	before, err := loadRecords(tx, ids)
+	if err != nil {
+		return fmt.Errorf("can not read records state, error: %w", err)
+	}
+
+	created, err := apply(tx)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		known[id] = true
+	}
+	for _, id := range created {
+		if !known[id] {
+			ids = append(ids, id)
+		}
+	}
+	after, err := loadRecords(tx, ids)
+	if err != nil {
+		return fmt.Errorf("can not read records state, error: %w", err)
+	}
+
+	images := make([]recordImage, 0, len(ids))
+	for _, id := range ids {
+		images = append(images, recordImage{ID: id, Before: before[id], After: after[id]})
+	}
+
+	encoded, err := json.Marshal(images)
+	if err != nil {
+		return fmt.Errorf("can not encode records state, error: %w", err)
+	}
+
+	if err = tx.Where("undone = ?", true).Delete(&journalEntry{}).Error; err != nil {
+		return fmt.Errorf("can not discard reverted operations, error: %w", err)
+	}
+
+	entry := journalEntry{Description: describe(action, ids), Images: string(encoded)}
+	if err = tx.Create(&entry).Error; err != nil {
+		return fmt.Errorf("can not record the operation, error: %w", err)
+	}
+
+	if err = tx.Where("id <= ?", int(entry.ID)-journalLimit).Delete(&journalEntry{}).Error; err != nil {
+		return err
+	}
+
+	return s.persist(tx)
+}
+
+// replay restores records to their state after (redo) or before (undo) the operation
+func (s *LocalStorage) replay(entry journalEntry, redo bool) error {
+	var images []recordImage
+	if err := json.Unmarshal([]byte(entry.Images), &images); err != nil {
+		return fmt.Errorf("can not decode records state, error: %w", err)
+	}
+
+	return retryOnBusy(func() error {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			for i := range images {
+				image := images[len(images)-1-i]
+				state := image.Before
+				if redo {
+					image = images[i]
+					state = image.After
+				}
+
+				if err := restoreRecord(tx, image.ID, state); err != nil {
+					return err
+				}
+			}
+
+			if err := tx.Model(&journalEntry{ID: entry.ID}).Update("undone", !redo).Error; err != nil {
+				return err
+			}
+
+			return s.persist(tx)
+		})
+	})
+}
+
+// persist saves the state changed within the transaction if the storage keeps it outside of the database
+func (s *LocalStorage) persist(tx *gorm.DB) error {
+	if s.save == nil {
+		return nil
+	}
+
+	return s.save(tx)
+}
+
+// restoreTrash replaces the empty database with the latest cleaned up one; databases without a file,
+// e.g. memory ones, have no trash
+func (s *LocalStorage) restoreTrash() (string, error) {
+	if s.dbPath == "" {
+		return "", errors.New("nothing to undo")
+	}
+
+	snapshots, err := trashSnapshots(s.dbPath)
+	if err != nil {
+		return "", err
+	}
+
+	if len(snapshots) == 0 {
+		return "", errors.New("nothing to undo")
+	}
+
+	var count int64
+	if err = s.db.Model(&Record{}).Count(&count).Error; err != nil {
+		return "", fmt.Errorf("can not count records, error: %w", err)
+	}
+
+	if count > 0 {
+		return "", errors.New("nothing to undo, cleaned up database can be restored only in place of an empty one")
+	}
+
+	if err = s.Close(); err != nil {
+		return "", err
+	}
+
+	if err = removeWalFiles(s.dbPath); err != nil {
+		return "", fmt.Errorf("write-ahead log of the empty database can not be removed, error: %w", err)
+	}
+
+	latest := snapshots[len(snapshots)-1]
+	if err = os.Rename(latest, s.dbPath); err != nil {
+		return "", fmt.Errorf("cleaned up database can not be restored, error: %w", err)
+	}
+
+	if s.db, err = openDb(s.dbPath, s.options); err != nil {
+		return "", fmt.Errorf("restored database can not be opened, error: %w", err)
+	}
+
+	return "clean up", nil
+}
+
+// moveToTrash moves the database file into the trash keeping only the latest cleaned up databases
+func moveToTrash(dbPath string) error {
+	dir := filepath.Join(filepath.Dir(dbPath), trashDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("trash directory can not be created, error: %w", err)
+	}
+
+	snapshot := filepath.Join(dir, filepath.Base(dbPath)+"."+time.Now().Format(trashTimeMark))
+	if err := os.Rename(dbPath, snapshot); err != nil {
+		return fmt.Errorf("database file can not be moved to the trash, error: %w", err)
+	}
+
+	if err := removeWalFiles(dbPath); err != nil {
+		return fmt.Errorf("write-ahead log of the database can not be removed, error: %w", err)
+	}
+
+	snapshots, err := trashSnapshots(dbPath)
+	if err != nil {
+		return err
+	}
+
+	for len(snapshots) > trashLimit {
+		if err = os.Remove(snapshots[0]); err != nil {
+			return fmt.Errorf("outdated database can not be deleted from the trash, error: %w", err)
+		}
+		snapshots = snapshots[1:]
+	}
+
+	return nil
+}
+
+// trashSnapshots returns paths of cleaned up copies of the database, the oldest first
+func trashSnapshots(dbPath string) ([]string, error) {
+	pattern := filepath.Join(filepath.Dir(dbPath), trashDir, filepath.Base(dbPath)+".*")
+	snapshots, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("trash can not be listed, error: %w", err)
+	}
+
+	sort.Strings(snapshots)
+
+	return snapshots, nil
+}
+
+// loadRecords returns records by their IDs, missing records are absent in the result; records are loaded
+// in batches, as preloading of their tags and lists binds IDs of all the loaded records
+func loadRecords(tx *gorm.DB, ids []uint) (map[uint]*Record, error) {
+	idToRecord := make(map[uint]*Record, len(ids))
+	for start := 0; start < len(ids); start += loadBatchSize {
+		end := start + loadBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		var records []Record
+		if err := tx.Preload("Tags").Preload("List").Where(idsIn("id", ids[start:end])).Find(&records).Error; err != nil {
+			return nil, err
+		}
+
+		for i := range records {
+			idToRecord[records[i].ID] = &records[i]
+		}
+	}
+
+	return idToRecord, nil
+}
+
+// listName returns the name of the record list or an empty string if the record does not belong to any list
+func listName(record *Record) string {
+	if record.List == nil {
+		return ""
+	}
+
+	return record.List.Name
+}
+
+// restoreRecord brings a record with the ID to the given state, deleting it if the state is nil
+func restoreRecord(tx *gorm.DB, id uint, state *Record) error {
+	if err := tx.Delete(&Record{}, id).Error; err != nil {
+		return fmt.Errorf("record %d can not be reverted, error: %w", id, err)
+	}
+
+	if err := pruneTagLinks(tx); err != nil {
+		return fmt.Errorf("record %d tags can not be reverted, error: %w", id, err)
+	}
+
+	if state == nil {
+		return nil
+	}
+
+	// list ID is not kept in the journal, so the list is resolved by its name
+	list, err := resolveList(tx, listName(state))
+	if err != nil {
+		return fmt.Errorf("record %d list can not be reverted, error: %w", id, err)
+	}
+
+	record := *state
+	record.Tags, record.List, record.ListID = nil, nil, nil
+	if list != nil {
+		record.ListID = &list.ID
+	}
+	if err = tx.Omit(clause.Associations).Create(&record).Error; err != nil {
+		return fmt.Errorf("record %d can not be reverted, error: %w", id, err)
+	}
+
+	if len(state.Tags) == 0 {
+		return nil
+	}
+
+	tags, err := resolveTags(tx, state.Tags)
+	if err != nil {
+		return fmt.Errorf("record %d tags can not be reverted, error: %w", id, err)
+	}
+
+	return tx.Model(&record).Association("Tags").Append(tags)
+}
+
+// describe returns a human-readable description of the action made with records, bulk actions are described
+// by the number of records only
+func describe(action string, ids []uint) string {
+	if len(ids) == 1 {
+		return fmt.Sprintf("%s record %d", action, ids[0])
+	}
+
+	if len(ids) > maxDescribedIDs {
+		return fmt.Sprintf("%s %d records", action, len(ids))
+	}
+
+	formatted := make([]string, 0, len(ids))
+	for _, id := range ids {
+		formatted = append(formatted, strconv.Itoa(int(id)))
+	}
+
+	return fmt.Sprintf("%s records %s", action, strings.Join(formatted, ", "))
+}
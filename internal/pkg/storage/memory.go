@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var _ Storage = (*MemoryStorage)(nil)
+
+// memoryDatabases counts opened memory databases, so that every memory storage gets its own database
+var memoryDatabases atomic.Uint64
+
+// MemoryStorage keeps records in a SQLite database held in memory with the same behavior as LocalStorage,
+// it is meant for tests and as the base of storages which persist the whole state at once
+type MemoryStorage struct {
+	*LocalStorage
+}
+
+// NewMemoryStorage returns an empty memory storage
+func NewMemoryStorage() (*MemoryStorage, error) {
+	db, err := openMemoryDb()
+	if err != nil {
+		return nil, err
+	}
+
+	return &MemoryStorage{LocalStorage: &LocalStorage{db: db}}, nil
+}
+
+// Migrations returns no migrations, the schema of a memory database is created up to date
+func (s *MemoryStorage) Migrations() ([]Migration, error) {
+	return nil, nil
+}
+
+// Migrate does nothing, the schema of a memory database is created up to date
+func (s *MemoryStorage) Migrate() ([]Migration, string, error) {
+	return nil, "", nil
+}
+
+// RollbackMigrations reverts nothing, the schema of a memory database is created up to date
+func (s *MemoryStorage) RollbackMigrations(uint) ([]Migration, string, error) {
+	return nil, "", nil
+}
+
+// Backups returns no backups, the memory storage does not keep them
+func (s *MemoryStorage) Backups() ([]Backup, error) {
+	return nil, nil
+}
+
+// BackupIfDue does nothing, the memory storage does not keep backups
+func (s *MemoryStorage) BackupIfDue(time.Duration) (bool, error) {
+	return false, nil
+}
+
+// RestoreBackup fails, the memory storage does not keep backups
+func (s *MemoryStorage) RestoreBackup(name string) (Backup, error) {
+	return Backup{}, newError(ErrNotFound, "backup '%s' is not found", name)
+}
+
+// CleanUp deletes all the records, lists and the journal by going on with a new empty database
+func (s *MemoryStorage) CleanUp() error {
+	db, err := openMemoryDb()
+	if err != nil {
+		return err
+	}
+
+	return s.replaceDb(db)
+}
+
+// replaceDb closes the current database and goes on with the given one
+func (s *MemoryStorage) replaceDb(db *gorm.DB) error {
+	if s.db != nil {
+		if err := s.Close(); err != nil {
+			return err
+		}
+	}
+	s.db = db
+
+	return nil
+}
+
+// openMemoryDb opens a new empty SQLite database in memory and prepares its schema; the database lives while
+// its connection is open, so the connection is never closed by the pool, and transactions wait for it in turn
+func openMemoryDb() (*gorm.DB, error) {
+	dsn := fmt.Sprintf("file:later-memory-%d?mode=memory&cache=shared", memoryDatabases.Add(1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return nil, fmt.Errorf("memory database can not be opened, error: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("can not get database object, error: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	sqlDB.SetConnMaxLifetime(0)
+	sqlDB.SetConnMaxIdleTime(0)
+
+	if err = createTable(db, "", Options{}); err != nil {
+		return nil, fmt.Errorf("table can not be created, error: %w", err)
+	}
+
+	return db, nil
+}
@@ -0,0 +1,375 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration defines a versioned change of the database schema
+type Migration struct {
+	Version     uint       `json:"version"`
+	Description string     `json:"description"`
+	AppliedAt   *time.Time `json:"applied_at"` // nil if the migration is pending
+}
+
+// migrationStep defines how a migration is applied and reverted, steps are never changed once released:
+// a change of the schema, e.g. a new field of Record, is made by a new step
+type migrationStep struct {
+	version     uint
+	description string
+	up          func(tx *gorm.DB) error
+	down        func(tx *gorm.DB) error // nil if the migration can not be reverted
+}
+
+// schemaMigration defines a migration applied to the database
+type schemaMigration struct {
+	Version     uint `gorm:"primarykey;autoIncrement:false"`
+	Description string
+	AppliedAt   time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// column defines a column of a table with its type and constraints
+type column struct {
+	name       string
+	definition string
+}
+
+// table defines a table of the baseline schema
+type table struct {
+	name       string
+	columns    []column
+	primaryKey string
+	indexes    []string
+}
+
+// baselineTables defines the schema created by AutoMigrate before migrations were introduced
+var baselineTables = []table{
+	{
+		name:       "lists",
+		columns:    []column{{"id", "integer"}, {"name", "text NOT NULL"}},
+		primaryKey: "`id`",
+		indexes:    []string{"CREATE UNIQUE INDEX IF NOT EXISTS `idx_lists_name` ON `lists`(`name`)"},
+	},
+	{
+		name: "records",
+		columns: []column{
+			{"id", "integer"},
+			{"created_at", "datetime"},
+			{"content", "text"},
+			{"done", "numeric"},
+			{"updated_at", "datetime"},
+			{"completed_at", "datetime"},
+			{"due_at", "datetime"},
+			{"priority", "integer NOT NULL DEFAULT 0"},
+			{"list_id", "integer REFERENCES `lists`(`id`)"},
+			{"recurrence", "text"},
+			{"parent_id", "integer"},
+		},
+		primaryKey: "`id`",
+		indexes: []string{
+			"CREATE INDEX IF NOT EXISTS `idx_records_list_id` ON `records`(`list_id`)",
+			"CREATE INDEX IF NOT EXISTS `idx_records_parent_id` ON `records`(`parent_id`)",
+		},
+	},
+	{
+		name:       "tags",
+		columns:    []column{{"id", "integer"}, {"name", "text NOT NULL"}},
+		primaryKey: "`id`",
+		indexes:    []string{"CREATE UNIQUE INDEX IF NOT EXISTS `idx_tags_name` ON `tags`(`name`)"},
+	},
+	{
+		name: "record_tags",
+		columns: []column{
+			{"record_id", "integer REFERENCES `records`(`id`)"},
+			{"tag_id", "integer REFERENCES `tags`(`id`)"},
+		},
+		primaryKey: "`record_id`,`tag_id`",
+	},
+	{
+		name:       "journal_entries",
+		columns:    []column{{"id", "integer"}, {"created_at", "datetime"}, {"description", "text"}, {"images", "text"}, {"undone", "numeric"}},
+		primaryKey: "`id`",
+	},
+}
+
+// migrationSteps defines all the migrations in the order of their versions
+var migrationSteps = []migrationStep{
+	{
+		version:     1,
+		description: "create baseline schema, adding missing columns to databases created by earlier versions",
+		up:          createBaseline,
+	},
+	{
+		version:     2,
+		description: "index records by due date",
+		up: func(tx *gorm.DB) error {
+			return tx.Exec("CREATE INDEX IF NOT EXISTS `idx_records_due_at` ON `records`(`due_at`)").Error
+		},
+		down: func(tx *gorm.DB) error {
+			return tx.Exec("DROP INDEX IF EXISTS `idx_records_due_at`").Error
+		},
+	},
+	{
+		version:     3,
+		description: "create settings table, it keeps encryption parameters",
+		up: func(tx *gorm.DB) error {
+			return tx.Exec("CREATE TABLE IF NOT EXISTS `settings` (`name` text,`value` text,PRIMARY KEY (`name`))").Error
+		},
+		down: func(tx *gorm.DB) error {
+			var count int64
+			if err := tx.Table("settings").Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return errors.New("settings are in use, decrypt the database first")
+			}
+			return tx.Exec("DROP TABLE IF EXISTS `settings`").Error
+		},
+	},
+	{
+		version:     4,
+		description: "link completed recurring records to their next occurrences",
+		up: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE `records` ADD COLUMN `next_id` integer").Error
+		},
+		down: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE `records` DROP COLUMN `next_id`").Error
+		},
+	},
+}
+
+// Migrations returns all the known migrations and the applied ones unknown to this version, in the order of versions
+func (s *LocalStorage) Migrations() ([]Migration, error) {
+	applied, err := appliedMigrations(s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(migrationSteps))
+	for _, step := range migrationSteps {
+		migration := Migration{Version: step.version, Description: step.description}
+		if record, ok := applied[step.version]; ok {
+			migration.AppliedAt = &record.AppliedAt
+		}
+		migrations = append(migrations, migration)
+	}
+
+	for _, version := range unknownVersions(applied) {
+		record := applied[version]
+		migrations = append(migrations, Migration{Version: version, Description: record.Description, AppliedAt: &record.AppliedAt})
+	}
+
+	return migrations, nil
+}
+
+// Migrate applies pending migrations, backing up the database first; returns the applied migrations
+// and the path of the backup, which is empty if nothing has been applied
+func (s *LocalStorage) Migrate() ([]Migration, string, error) {
+	applied, backup, err := migrate(s.db, s.dbPath, s.options)
+	if err != nil {
+		return applied, backup, err
+	}
+
+	if err = createSearchIndex(s.db); err != nil {
+		return applied, backup, fmt.Errorf("can not create search index, error: %w", err)
+	}
+
+	return applied, backup, nil
+}
+
+// RollbackMigrations reverts applied migrations with versions above the given one, the latest first,
+// backing up the database first; returns the reverted migrations and the path of the backup
+func (s *LocalStorage) RollbackMigrations(version uint) ([]Migration, string, error) {
+	applied, err := appliedMigrations(s.db)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var steps []migrationStep
+	for i := len(migrationSteps) - 1; i >= 0; i-- {
+		step := migrationSteps[i]
+		if step.version <= version {
+			break
+		}
+		if _, ok := applied[step.version]; !ok {
+			continue
+		}
+		if step.down == nil {
+			return nil, "", fmt.Errorf("migration %d can not be rolled back", step.version)
+		}
+		steps = append(steps, step)
+	}
+
+	if unknown := unknownVersions(applied); len(unknown) > 0 {
+		return nil, "", fmt.Errorf("migration %d is unknown to this version and can not be rolled back", unknown[len(unknown)-1])
+	}
+
+	if len(steps) == 0 {
+		return nil, "", nil
+	}
+
+	created, err := backupDatabase(s.db, s.dbPath, fmt.Sprintf("before-rollback-%d", steps[0].version), s.options.backupLimit())
+	if err != nil {
+		return nil, "", err
+	}
+	backup := created.Path
+
+	reverted := make([]Migration, 0, len(steps))
+	for _, step := range steps {
+		err = retryOnBusy(func() error {
+			return s.db.Transaction(func(tx *gorm.DB) error {
+				if err := step.down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{}, step.version).Error
+			})
+		})
+		if err != nil {
+			return reverted, backup, fmt.Errorf("migration %d can not be rolled back, error: %w", step.version, err)
+		}
+		reverted = append(reverted, Migration{Version: step.version, Description: step.description})
+	}
+
+	return reverted, backup, nil
+}
+
+// migrate applies pending migrations, each in its own transaction; an existing database is backed up first
+func migrate(db *gorm.DB, dbPath string, options Options) ([]Migration, string, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if unknown := unknownVersions(applied); len(unknown) > 0 {
+		return nil, "", fmt.Errorf("database schema version %d is newer than the supported version %d, upgrade later", unknown[len(unknown)-1], latestVersion())
+	}
+
+	var pending []migrationStep
+	for _, step := range migrationSteps {
+		if _, ok := applied[step.version]; !ok {
+			pending = append(pending, step)
+		}
+	}
+
+	if len(pending) == 0 {
+		return nil, "", nil
+	}
+
+	backup := ""
+	if db.Migrator().HasTable("records") {
+		created, err := backupDatabase(db, dbPath, fmt.Sprintf("before-migration-%d", pending[0].version), options.backupLimit())
+		if err != nil {
+			return nil, "", err
+		}
+		backup = created.Path
+	}
+
+	migrations := make([]Migration, 0, len(pending))
+	for _, step := range pending {
+		now := time.Now()
+		err = retryOnBusy(func() error {
+			return db.Transaction(func(tx *gorm.DB) error {
+				// another process could have applied the migration while this one was waiting for the lock
+				var count int64
+				if err := tx.Model(&schemaMigration{}).Where("version = ?", step.version).Count(&count).Error; err != nil || count > 0 {
+					return err
+				}
+				if err := step.up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{Version: step.version, Description: step.description, AppliedAt: now}).Error
+			})
+		})
+		if err != nil {
+			return migrations, backup, fmt.Errorf("migration %d can not be applied, error: %w", step.version, err)
+		}
+		migrations = append(migrations, Migration{Version: step.version, Description: step.description, AppliedAt: &now})
+	}
+
+	return migrations, backup, nil
+}
+
+// appliedMigrations returns migrations applied to the database by their versions
+func appliedMigrations(db *gorm.DB) (map[uint]schemaMigration, error) {
+	err := retryOnBusy(func() error {
+		return db.Exec("CREATE TABLE IF NOT EXISTS `schema_migrations` (`version` integer, `description` text, `applied_at` datetime, PRIMARY KEY (`version`))").Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can not create migrations table, error: %w", err)
+	}
+
+	var records []schemaMigration
+	if err = db.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("can not read applied migrations, error: %w", err)
+	}
+
+	applied := make(map[uint]schemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+
+	return applied, nil
+}
+
+// unknownVersions returns versions of the applied migrations unknown to this version in ascending order
+func unknownVersions(applied map[uint]schemaMigration) []uint {
+	var versions []uint
+	for version := range applied {
+		if version > latestVersion() {
+			versions = append(versions, version)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	return versions
+}
+
+// latestVersion returns the version of the latest known migration
+func latestVersion() uint {
+	return migrationSteps[len(migrationSteps)-1].version
+}
+
+// createBaseline creates missing tables of the baseline schema and adds missing columns to the existing ones
+func createBaseline(tx *gorm.DB) error {
+	for _, t := range baselineTables {
+		if !tx.Migrator().HasTable(t.name) {
+			definitions := make([]string, 0, len(t.columns)+1)
+			for _, c := range t.columns {
+				definitions = append(definitions, fmt.Sprintf("`%s` %s", c.name, c.definition))
+			}
+			definitions = append(definitions, "PRIMARY KEY ("+t.primaryKey+")")
+
+			statement := fmt.Sprintf("CREATE TABLE `%s` (%s)", t.name, strings.Join(definitions, ","))
+			if err := tx.Exec(statement).Error; err != nil {
+				return fmt.Errorf("table %s can not be created, error: %w", t.name, err)
+			}
+		}
+
+		for _, c := range t.columns {
+			if tx.Migrator().HasColumn(t.name, c.name) {
+				continue
+			}
+			statement := fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s", t.name, c.name, c.definition)
+			if err := tx.Exec(statement).Error; err != nil {
+				return fmt.Errorf("column %s.%s can not be added, error: %w", t.name, c.name, err)
+			}
+		}
+
+		for _, index := range t.indexes {
+			if err := tx.Exec(index).Error; err != nil {
+				return fmt.Errorf("index of table %s can not be created, error: %w", t.name, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Opener opens a storage by its URI with the options
+type Opener func(uri *url.URL, options Options) (Storage, error)
+
+var (
+	openersMu sync.RWMutex
+	openers   = map[string]Opener{}
+)
+
+func init() {
+	Register("sqlite", func(uri *url.URL, options Options) (Storage, error) {
+		if path := uriPath(uri); path != "" {
+			return NewFileLocalStorage(path, options)
+		}
+		return NewLocalStorage(options)
+	})
+	Register("memory", func(*url.URL, Options) (Storage, error) {
+		return NewMemoryStorage()
+	})
+	Register("file", func(uri *url.URL, options Options) (Storage, error) {
+		path := uriPath(uri)
+		if path == "" {
+			return nil, fmt.Errorf("storage URI '%s' has no file path", uri)
+		}
+		return NewFileStorage(path, options)
+	})
+}
+
+// Register makes a storage backend available by the URI scheme, registering the same scheme again replaces
+// the backend
+func Register(scheme string, opener Opener) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+
+	openers[strings.ToLower(scheme)] = opener
+}
+
+// Schemes returns URI schemes of the registered storage backends in alphabetical order
+func Schemes() []string {
+	openersMu.RLock()
+	defer openersMu.RUnlock()
+
+	schemes := make([]string, 0, len(openers))
+	for scheme := range openers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+
+	return schemes
+}
+
+// Open opens a storage by its URI with the options, the scheme selects the backend:
+// sqlite:///path/to/later.db (sqlite:// for the default database), memory://, file:///path/to/tasks.json
+func Open(uri string, options Options) (Storage, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("storage URI '%s' is invalid, error: %w", uri, err)
+	}
+
+	if parsed.Scheme == "" {
+		return nil, fmt.Errorf("storage URI '%s' has no scheme, expected one of: %s", uri, strings.Join(Schemes(), ", "))
+	}
+
+	openersMu.RLock()
+	opener, ok := openers[strings.ToLower(parsed.Scheme)]
+	openersMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf(
+			"storage backend '%s' is not available in this build, expected one of: %s",
+			parsed.Scheme, strings.Join(Schemes(), ", "),
+		)
+	}
+
+	return opener(parsed, options)
+}
+
+// uriPath returns the file path of the URI: the absolute path of scheme:///path, the relative path of
+// scheme://path or scheme:path, with "~" expanded to the home directory
+func uriPath(uri *url.URL) string {
+	path := uri.Opaque
+	if path == "" {
+		path = uri.Host + uri.Path
+	}
+
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = home + path[1:]
+		}
+	}
+
+	return path
+}
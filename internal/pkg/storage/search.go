@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	HighlightStart = "\x02" // marks the beginning of a matched term in search snippets
+	HighlightEnd   = "\x03" // marks the end of a matched term in search snippets
+)
+
+// searchTerm defines a word or a phrase of a full-text query
+type searchTerm struct {
+	text   string
+	prefix bool // the term matches words starting with it
+}
+
+// parseQuery splits a full-text query into terms: quoted phrases are kept together,
+// boolean operators are dropped
+func parseQuery(query string) []searchTerm {
+	var terms []searchTerm
+	for i, part := range strings.Split(query, `"`) {
+		if i%2 == 1 {
+			if phrase := strings.TrimSpace(part); phrase != "" {
+				terms = append(terms, searchTerm{text: phrase})
+			}
+			continue
+		}
+
+		for _, word := range strings.Fields(part) {
+			term := searchTerm{text: strings.TrimSuffix(word, "*"), prefix: strings.HasSuffix(word, "*")}
+			switch term.text {
+			case "", "AND", "OR", "NOT":
+				continue
+			}
+			terms = append(terms, term)
+		}
+	}
+
+	return terms
+}
+
+// searchTerms splits a full-text query into plain terms: quoted phrases are kept together,
+// prefix markers and boolean operators are dropped
+func searchTerms(query string) []string {
+	var terms []string
+	for _, term := range parseQuery(query) {
+		terms = append(terms, term.text)
+	}
+
+	return terms
+}
+
+// matchExpression converts a full-text query into FTS5 MATCH expression, where every term is a quoted string,
+// so that punctuation of the terms, e.g. "ticket-123" or "v1.2", is never read as FTS5 syntax
+func matchExpression(query string) string {
+	terms := parseQuery(query)
+	quoted := make([]string, 0, len(terms))
+	for _, term := range terms {
+		expression := `"` + strings.ReplaceAll(term.text, `"`, `""`) + `"`
+		if term.prefix {
+			expression += "*"
+		}
+		quoted = append(quoted, expression)
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// highlight encloses all case-insensitive occurrences of the terms in the content with highlight markers
+func highlight(content string, terms []string) string {
+	lowered := strings.ToLower(content)
+	caseless := len(lowered) == len(content)
+	if !caseless {
+		lowered = content // lower case form has different byte offsets, match case-sensitively
+	}
+	marked := make([]bool, len(content))
+
+	for _, term := range terms {
+		if caseless {
+			term = strings.ToLower(term)
+		}
+		for offset := 0; term != ""; {
+			index := strings.Index(lowered[offset:], term)
+			if index < 0 {
+				break
+			}
+			for i := offset + index; i < offset+index+len(term); i++ {
+				marked[i] = true
+			}
+			offset += index + len(term)
+		}
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(content); {
+		_, size := utf8.DecodeRuneInString(content[i:])
+		if marked[i] && (i == 0 || !marked[i-1]) {
+			builder.WriteString(HighlightStart)
+		}
+		builder.WriteString(content[i : i+size])
+		if marked[i] && (i+size == len(content) || !marked[i+size]) {
+			builder.WriteString(HighlightEnd)
+		}
+		i += size
+	}
+
+	return builder.String()
+}
+
+// escapeLike escapes wildcard characters of the LIKE operator using backslash
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+}
@@ -1,194 +1,872 @@
 package storage
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/manmolecular/go-later/internal/pkg/recurrence"
+	"github.com/mattn/go-sqlite3"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 )
 
+// connectionParams enables the write-ahead log, so that readers do not block writers, and makes concurrent
+// writers wait for each other: transactions take the write lock on start and wait for it up to the busy timeout
+const connectionParams = "?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate"
+
 const (
-	defaultDbDir  = ".later"
-	defaultDbFile = "later.db"
+	busyRetries    = 5                      // attempts of a transaction failed as the database is locked
+	busyRetryDelay = 100 * time.Millisecond // delay before the next attempt, growing with each attempt
 )
 
+// walSuffixes defines suffixes of the write-ahead log files kept next to the database file
+var walSuffixes = []string{"-wal", "-shm"}
+
+const (
+	defaultDbDir   = ".later"
+	xdgDbDir       = "later" // storage directory inside $XDG_DATA_HOME
+	defaultDbFile  = "later.db"
+	defaultProfile = "default" // profile using the default database file
+	dbFileExt      = ".db"
+)
+
+// profilePattern defines allowed profile names, so that a profile can not point outside the storage directory
+var profilePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// searchIndexTriggers keeps the full-text search index in sync with records content
+var searchIndexTriggers = map[string]string{
+	"records_fts_insert": `CREATE TRIGGER records_fts_insert AFTER INSERT ON records BEGIN
+		INSERT INTO records_fts(rowid, content) VALUES (new.id, new.content);
+	END`,
+	"records_fts_delete": `CREATE TRIGGER records_fts_delete AFTER DELETE ON records BEGIN
+		INSERT INTO records_fts(records_fts, rowid, content) VALUES ('delete', old.id, old.content);
+	END`,
+	"records_fts_update": `CREATE TRIGGER records_fts_update AFTER UPDATE OF content ON records BEGIN
+		INSERT INTO records_fts(records_fts, rowid, content) VALUES ('delete', old.id, old.content);
+		INSERT INTO records_fts(rowid, content) VALUES (new.id, new.content);
+	END`,
+}
+
 // LocalStorage defines local storage for records
 type LocalStorage struct {
-	db     *gorm.DB
-	dbPath string
+	db      *gorm.DB
+	dbPath  string                    // empty for databases without a file, e.g. memory ones
+	options Options                   // applied whenever the database is opened again, e.g. after clean up
+	save    func(tx *gorm.DB) error   // persists the state within the transaction of each change, nil if not needed
+	backup  func(reason string) error // backs up the state before destructive changes of databases without a file
 }
 
 // Validate that structure satisfies the interface
 var _ Storage = (*LocalStorage)(nil)
 
 // NewCustomLocalStorage creates a new local storage with custom storage location
-func NewCustomLocalStorage(baseDir, dbDir, dbName string) (*LocalStorage, error) {
+func NewCustomLocalStorage(baseDir, dbDir, dbName string, options Options) (*LocalStorage, error) {
 	dbPath, err := createCustomStorage(baseDir, dbDir, dbName)
 	if err != nil {
-		return nil, fmt.Errorf("can not create custom storage, error: %s", err)
+		return nil, fmt.Errorf("can not create custom storage, error: %w", err)
 	}
 
-	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	db, err := openDb(dbPath, options)
 	if err != nil {
-		return nil, fmt.Errorf("database connection can not be established, error: %s", err)
-	}
-
-	if err = createTable(db); err != nil {
-		return nil, fmt.Errorf("table can not be created, error: %s", err)
+		return nil, err
 	}
 
 	return &LocalStorage{
-		db:     db,
-		dbPath: dbPath,
+		db:      db,
+		dbPath:  dbPath,
+		options: options,
 	}, nil
 }
 
-// NewLocalStorage creates a new local storage with default configuration in current user's home directory
-func NewLocalStorage() (*LocalStorage, error) {
+// NewLocalStorage creates a new local storage with default configuration in the data directory of current user:
+// $XDG_DATA_HOME/later when the variable is set, ~/.later otherwise
+func NewLocalStorage(options Options) (*LocalStorage, error) {
 	dbPath, err := createStorage()
 	if err != nil {
-		return nil, fmt.Errorf("can not create default storage, error: %s", err)
+		return nil, fmt.Errorf("can not create default storage, error: %w", err)
 	}
 
-	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	db, err := openDb(dbPath, options)
 	if err != nil {
-		return nil, fmt.Errorf("database connection can not be established, error: %s", err)
-	}
-
-	if err = createTable(db); err != nil {
-		return nil, fmt.Errorf("table can not be created, error: %s", err)
+		return nil, err
 	}
 
 	return &LocalStorage{
-		db:     db,
-		dbPath: dbPath,
+		db:      db,
+		dbPath:  dbPath,
+		options: options,
 	}, nil
 }
 
-// CreateRecord creates a record in the storage
-func (s *LocalStorage) CreateRecord(content string) error {
-	if err := s.db.Create(&Record{Content: content}).Error; err != nil {
-		return fmt.Errorf("can not create record, error: %s", err)
+// NewProfileLocalStorage creates a local storage of the named profile in the data directory of current user;
+// every profile has its own database file "<profile>.db" next to the default one, the default profile uses it
+func NewProfileLocalStorage(profile string, options Options) (*LocalStorage, error) {
+	if profile == "" || profile == defaultProfile {
+		return NewLocalStorage(options)
+	}
+
+	if !profilePattern.MatchString(profile) {
+		return nil, newError(ErrInvalidInput, "profile name '%s' is invalid, expected letters, digits, '_', '-' and '.'", profile)
+	}
+
+	// backups and the trash of a database are found by its file name followed by a dot, so neither the default
+	// database nor another profile may share the prefix, e.g.: "later" or "work.db" next to "work"
+	if profile == strings.TrimSuffix(defaultDbFile, dbFileExt) || strings.Contains(profile+".", dbFileExt+".") {
+		return nil, newError(ErrInvalidInput, "profile name '%s' is reserved, its files would mix with another database", profile)
+	}
+
+	baseDir, dbDir, err := storageDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewCustomLocalStorage(baseDir, dbDir, profile+dbFileExt, options)
+}
+
+// NewFileLocalStorage creates a local storage with the database file at the path, creating missing directories
+func NewFileLocalStorage(dbPath string, options Options) (*LocalStorage, error) {
+	dbPath, err := filepath.Abs(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("database path can not be resolved, error: %w", err)
+	}
+
+	return NewCustomLocalStorage(filepath.Dir(dbPath), "", filepath.Base(dbPath), options)
+}
+
+// Path returns the location of the database file
+func (s *LocalStorage) Path() string {
+	return s.dbPath
+}
+
+// CreateRecord creates a record in the storage, assigned ID and creation time are set on the record
+func (s *LocalStorage) CreateRecord(record *Record) error {
+	err := s.journaled("create", nil, func(tx *gorm.DB) ([]uint, error) {
+		if err := createRecord(tx, record); err != nil {
+			return nil, err
+		}
+
+		return []uint{record.ID}, nil
+	})
+	if err != nil {
+		return fmt.Errorf("can not create record, error: %w", err)
 	}
 
 	return nil
 }
 
-// GetRecordByID returns record content by its ID
-func (s *LocalStorage) GetRecordByID(id uint) (string, error) {
+// GetRecordByID returns record by its ID
+func (s *LocalStorage) GetRecordByID(id uint) (Record, error) {
 	var record Record
 
-	if err := s.db.First(&record, id).Error; err != nil {
-		return record.Content, fmt.Errorf("can not get record, error: %s", err)
+	if err := s.db.Preload("Tags").Preload("List").First(&record, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = notFound(id)
+		}
+		return record, fmt.Errorf("can not get record, error: %w", err)
 	}
 
-	return record.Content, nil
+	return record, nil
 }
 
-// GetRecords returns all records
-func (s *LocalStorage) GetRecords() ([]Record, error) {
+// GetRecords returns records matching the filter
+func (s *LocalStorage) GetRecords(filter Filter) ([]Record, error) {
 	var records []Record
-	if err := s.db.Order("id DESC").Find(&records).Error; err != nil {
-		return records, fmt.Errorf("can not get list of records, error: %s", err)
+	if err := applyOrder(applyFilter(s.db.Preload("Tags").Preload("List"), filter), filter.Order).Find(&records).Error; err != nil {
+		return records, fmt.Errorf("can not get list of records, error: %w", err)
 	}
 
 	return records, nil
 }
 
-// CountRecords counts all records
-func (s *LocalStorage) CountRecords() (uint, error) {
+// CountRecords counts records matching the filter
+func (s *LocalStorage) CountRecords(filter Filter) (uint, error) {
 	var count int64
-	if err := s.db.Table("records").Count(&count).Error; err != nil {
-		return uint(count), fmt.Errorf("can not count records, error: %s", err)
+	if err := applyFilter(s.db.Model(&Record{}), filter).Count(&count).Error; err != nil {
+		return uint(count), fmt.Errorf("can not count records, error: %w", err)
 	}
 
 	return uint(count), nil
 }
 
-// DeleteRecordByID deletes a record from the storage by its ID
-func (s *LocalStorage) DeleteRecordByID(id uint) error {
-	if err := s.db.Delete(&Record{}, id).Error; err != nil {
-		return fmt.Errorf("can not delete record, error: %s", err)
+// UpdateRecord saves content, due date, priority and recurrence of a record by its ID and records the update time;
+// tags and completion status are left intact, use the dedicated methods to change them
+func (s *LocalStorage) UpdateRecord(record *Record) error {
+	if err := validateRecurrence(record.Recurrence); err != nil {
+		return fmt.Errorf("can not update record, error: %w", err)
+	}
+
+	now := time.Now()
+	record.UpdatedAt = &now
+
+	err := s.journaled("update", []uint{record.ID}, func(tx *gorm.DB) ([]uint, error) {
+		result := tx.Model(&Record{ID: record.ID}).
+			Select("content", "due_at", "priority", "recurrence", "updated_at").
+			Updates(record)
+		return nil, checkAffected(result, record.ID)
+	})
+	if err != nil {
+		return fmt.Errorf("can not update record, error: %w", err)
 	}
 
 	return nil
 }
 
-// DeleteLastRecord deletes the latest record from the storage
-func (s *LocalStorage) DeleteLastRecord() error {
-	query := `DELETE FROM records WHERE id = (SELECT id FROM records ORDER BY id DESC LIMIT 1)`
+// MarkRecordDone sets completion status of a record by its ID; completing a record completes all its pending
+// subtasks as well, while reopening affects only the record itself
+func (s *LocalStorage) MarkRecordDone(id uint, done bool) error {
+	action := "complete"
+	if !done {
+		action = "reopen"
+	}
+
+	var ids []uint
+	err := s.journaledSelection(action, selectRecord(id, done, &ids), func(tx *gorm.DB) ([]uint, error) {
+		var record Record
+		if err := tx.Preload("Tags").Preload("List").Limit(1).Find(&record, id).Error; err != nil {
+			return nil, err
+		}
 
-	db, err := s.db.DB()
+		if record.ID == 0 {
+			return nil, notFound(id)
+		}
+
+		return changeStatus(tx, record, done, ids[1:])
+	})
 	if err != nil {
-		fmt.Printf("can not get database object, error: %s\n", err)
+		return fmt.Errorf("can not update record status, error: %w", err)
 	}
 
-	if _, err := db.Exec(query); err != nil {
-		return fmt.Errorf("can not execute delete last record statement, error: %s", err)
+	return nil
+}
+
+// SaveRecord saves content, due date, priority, recurrence, tags, list and completion status of a record by its ID
+// as a single change, which is undone at once, and records the update time; the status is changed the same way as
+// by MarkRecordDone, while the record is saved as it is when the status is the same
+func (s *LocalStorage) SaveRecord(record *Record) error {
+	if err := validateRecurrence(record.Recurrence); err != nil {
+		return fmt.Errorf("can not save record, error: %w", err)
+	}
+
+	now := time.Now()
+	record.UpdatedAt = &now
+
+	var ids []uint
+	err := s.journaledSelection("update", selectRecord(record.ID, record.Done, &ids), func(tx *gorm.DB) ([]uint, error) {
+		list, err := resolveList(tx, listName(record))
+		if err != nil {
+			return nil, err
+		}
+
+		var listID *uint
+		if list != nil {
+			listID = &list.ID
+		}
+
+		result := tx.Model(&Record{ID: record.ID}).Updates(map[string]interface{}{
+			"content":    record.Content,
+			"due_at":     record.DueAt,
+			"priority":   record.Priority,
+			"recurrence": record.Recurrence,
+			"list_id":    listID,
+			"updated_at": record.UpdatedAt,
+		})
+		if err = checkAffected(result, record.ID); err != nil {
+			return nil, err
+		}
+
+		tags, err := resolveTags(tx, record.Tags)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = tx.Model(&Record{ID: record.ID}).Association("Tags").Replace(tags); err != nil {
+			return nil, err
+		}
+
+		var saved Record
+		if err = tx.Preload("Tags").Preload("List").First(&saved, record.ID).Error; err != nil {
+			return nil, err
+		}
+
+		if saved.Done == record.Done {
+			return nil, nil
+		}
+
+		return changeStatus(tx, saved, record.Done, ids[1:])
+	})
+	if err != nil {
+		return fmt.Errorf("can not save record, error: %w", err)
 	}
 
 	return nil
 }
 
-// Close closes the storage
-func (s *LocalStorage) Close() error {
-	db, err := s.db.DB()
+// SetRecordPriority sets priority level of a record by its ID
+func (s *LocalStorage) SetRecordPriority(id uint, priority Priority) error {
+	err := s.journaled("prioritize", []uint{id}, func(tx *gorm.DB) ([]uint, error) {
+		return nil, checkAffected(tx.Model(&Record{ID: id}).Update("priority", priority), id)
+	})
 	if err != nil {
-		return fmt.Errorf("can not get database object, error: %s\n", err)
+		return fmt.Errorf("can not update record priority, error: %w", err)
 	}
 
-	if err := db.Close(); err != nil {
-		return fmt.Errorf("database connection can not be closed, error: %s\n", err)
+	return nil
+}
+
+// TagRecord labels a record with the tag, the tag is created if it does not exist yet
+func (s *LocalStorage) TagRecord(id uint, tag string) error {
+	err := s.journaled("tag", []uint{id}, func(tx *gorm.DB) ([]uint, error) {
+		record := Record{ID: id}
+		if err := tx.First(&record).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, notFound(id)
+			}
+			return nil, err
+		}
+
+		tags, err := resolveTags(tx, []Tag{{Name: tag}})
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, tx.Model(&record).Association("Tags").Append(tags)
+	})
+	if err != nil {
+		return fmt.Errorf("can not tag record, error: %w", err)
+	}
+
+	return nil
+}
+
+// UntagRecord removes the tag from a record
+func (s *LocalStorage) UntagRecord(id uint, tag string) error {
+	err := s.journaled("untag", []uint{id}, func(tx *gorm.DB) ([]uint, error) {
+		result := tx.Exec(
+			"DELETE FROM record_tags WHERE record_id = ? AND tag_id IN (SELECT id FROM tags WHERE name = ?)",
+			id, NormalizeTag(tag),
+		)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return nil, newError(ErrNotFound, "record with ID %d is not tagged with '%s'", id, NormalizeTag(tag))
+		}
+
+		return nil, nil
+	})
+	if err != nil {
+		return fmt.Errorf("can not untag record, error: %w", err)
+	}
+
+	return nil
+}
+
+// GetTags returns tags used by records with the number of records per tag, the most used tags first
+func (s *LocalStorage) GetTags() ([]TagCount, error) {
+	var tags []TagCount
+	err := s.db.Table("tags").
+		Select("tags.name AS name, COUNT(record_tags.record_id) AS count").
+		Joins("JOIN record_tags ON record_tags.tag_id = tags.id").
+		Group("tags.name").
+		Order("count DESC, name ASC").
+		Scan(&tags).Error
+	if err != nil {
+		return tags, fmt.Errorf("can not get list of tags, error: %w", err)
+	}
+
+	return tags, nil
+}
+
+// MoveRecord moves a record into the list, the list is created if it does not exist yet;
+// the empty list name removes the record from its list
+func (s *LocalStorage) MoveRecord(id uint, list string) error {
+	err := s.journaled("move", []uint{id}, func(tx *gorm.DB) ([]uint, error) {
+		resolved, err := resolveList(tx, list)
+		if err != nil {
+			return nil, err
+		}
+
+		var listID *uint
+		if resolved != nil {
+			listID = &resolved.ID
+		}
+
+		return nil, checkAffected(tx.Model(&Record{ID: id}).Update("list_id", listID), id)
+	})
+	if err != nil {
+		return fmt.Errorf("can not move record, error: %w", err)
+	}
+
+	return nil
+}
+
+// GetLists returns all the lists ordered by name with the number of their records matching the filter;
+// records without a list are counted under the empty name, which is omitted if there are no such records
+func (s *LocalStorage) GetLists(filter Filter) ([]ListCount, error) {
+	var lists []List
+	if err := s.db.Order("name ASC").Find(&lists).Error; err != nil {
+		return nil, fmt.Errorf("can not get list of lists, error: %w", err)
+	}
+
+	var counts []struct {
+		ListID *uint
+		Count  uint
+	}
+	err := applyFilter(s.db.Model(&Record{}), filter).
+		Select("list_id, COUNT(*) AS count").
+		Group("list_id").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, fmt.Errorf("can not count records of lists, error: %w", err)
+	}
+
+	listToCount := make(map[uint]uint, len(counts))
+	result := make([]ListCount, 0, len(lists)+1)
+	for _, count := range counts {
+		if count.ListID == nil {
+			result = append(result, ListCount{Count: count.Count})
+			continue
+		}
+		listToCount[*count.ListID] = count.Count
+	}
+
+	for _, list := range lists {
+		result = append(result, ListCount{Name: list.Name, Count: listToCount[list.ID]})
+	}
+
+	return result, nil
+}
+
+// GetProgress returns the number of completed and all direct subtasks of the records with the given IDs,
+// records without subtasks are omitted
+func (s *LocalStorage) GetProgress(ids []uint) (map[uint]Progress, error) {
+	var rows []struct {
+		ParentID uint
+		Done     uint
+		Total    uint
+	}
+
+	idToProgress := make(map[uint]Progress, len(ids))
+	if len(ids) == 0 {
+		return idToProgress, nil
+	}
+
+	err := s.db.Model(&Record{}).
+		Select("parent_id, COUNT(CASE WHEN done THEN 1 END) AS done, COUNT(*) AS total").
+		Where(idsIn("parent_id", ids)).
+		Group("parent_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("can not get progress of subtasks, error: %w", err)
+	}
+
+	for _, row := range rows {
+		idToProgress[row.ParentID] = Progress{Done: row.Done, Total: row.Total}
+	}
+
+	return idToProgress, nil
+}
+
+// SearchRecords returns records matching the full-text query, the most relevant records first;
+// the query supports phrases ("exact words") and prefixes (word*), falling back to
+// a substring search of all the query terms if SQLite is built without FTS5
+func (s *LocalStorage) SearchRecords(query string) ([]SearchResult, error) {
+	if !hasFullTextSearch(s.db) {
+		return s.searchRecordsBySubstring(query)
+	}
+
+	expression := matchExpression(query)
+	if expression == "" {
+		return nil, newError(ErrInvalidInput, "search query has no terms")
+	}
+
+	var matches []struct {
+		ID      uint
+		Snippet string
+	}
+	err := s.db.Raw(
+		"SELECT rowid AS id, snippet(records_fts, 0, ?, ?, '...', 16) AS snippet FROM records_fts WHERE records_fts MATCH ? ORDER BY rank",
+		HighlightStart, HighlightEnd, expression,
+	).Scan(&matches).Error
+	if err != nil {
+		return nil, fmt.Errorf("can not search records, error: %w", err)
+	}
+
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, 0, len(matches))
+	for _, match := range matches {
+		ids = append(ids, match.ID)
+	}
+
+	var records []Record
+	if err = s.db.Preload("Tags").Preload("List").Find(&records, ids).Error; err != nil {
+		return nil, fmt.Errorf("can not get matched records, error: %w", err)
+	}
+
+	idToRecord := make(map[uint]Record, len(records))
+	for _, record := range records {
+		idToRecord[record.ID] = record
+	}
+
+	results := make([]SearchResult, 0, len(matches))
+	for _, match := range matches {
+		if record, ok := idToRecord[match.ID]; ok {
+			results = append(results, SearchResult{Record: record, Snippet: match.Snippet})
+		}
+	}
+
+	return results, nil
+}
+
+// searchRecordsBySubstring returns records containing all the query terms, the most recent records first
+func (s *LocalStorage) searchRecordsBySubstring(query string) ([]SearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, newError(ErrInvalidInput, "search query has no terms")
+	}
+
+	db := s.db.Preload("Tags").Preload("List")
+	for _, term := range terms {
+		db = db.Where(`content LIKE ? ESCAPE '\'`, "%"+escapeLike(term)+"%")
+	}
+
+	var records []Record
+	if err := db.Order("id DESC").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("can not search records, error: %w", err)
+	}
+
+	results := make([]SearchResult, 0, len(records))
+	for _, record := range records {
+		results = append(results, SearchResult{Record: record, Snippet: highlight(record.Content, terms)})
+	}
+
+	return results, nil
+}
+
+// ImportRecords adds records keeping their creation time, completion status and other attributes, but assigning
+// new IDs; records with the same content and creation time as the existing or already imported ones are skipped as
+// duplicates. In replace mode all the existing records are deleted first. Returns the number of imported records
+func (s *LocalStorage) ImportRecords(records []Record, replace bool) (uint, error) {
+	var existing []Record
+	if err := s.db.Select("id", "content", "created_at").Find(&existing).Error; err != nil {
+		return 0, fmt.Errorf("can not get list of records, error: %w", err)
+	}
+
+	var ids []uint
+	seen := make(map[string]bool, len(existing)+len(records))
+	for _, record := range existing {
+		if replace {
+			ids = append(ids, record.ID)
+			continue
+		}
+		seen[duplicateKey(record)] = true
+	}
+
+	if len(ids) > 0 {
+		if err := s.backupBefore("before-import"); err != nil {
+			return 0, err
+		}
+	}
+
+	var imported uint
+	err := s.journaled("import", ids, func(tx *gorm.DB) ([]uint, error) {
+		if len(ids) > 0 {
+			if _, err := deleteRecords(ids...)(tx); err != nil {
+				return nil, err
+			}
+		}
+
+		created := make([]uint, 0, len(records))
+		sourceToCreated := make(map[uint]uint, len(records))
+		parents := make(map[uint]uint)
+		occurrences := make(map[uint]uint)
+		for _, source := range records {
+			key := duplicateKey(source)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			record := source
+			record.ID, record.ParentID, record.NextID = 0, nil, nil
+			if err := createRecord(tx, &record); err != nil {
+				return nil, err
+			}
+			created = append(created, record.ID)
+
+			if source.ID != 0 {
+				sourceToCreated[source.ID] = record.ID
+			}
+			if source.ParentID != nil {
+				parents[record.ID] = *source.ParentID
+			}
+			if source.NextID != nil {
+				occurrences[record.ID] = *source.NextID
+			}
+		}
+		imported = uint(len(created))
+
+		// subtasks are linked after all the records get their new IDs, as parents may follow their subtasks
+		for id, sourceParentID := range parents {
+			parentID, ok := sourceToCreated[sourceParentID]
+			if !ok || parentID == id {
+				continue
+			}
+			if err := tx.Model(&Record{ID: id}).Update("parent_id", parentID).Error; err != nil {
+				return nil, err
+			}
+		}
+
+		for id, sourceNextID := range occurrences {
+			if nextID, ok := sourceToCreated[sourceNextID]; ok && nextID != id {
+				if err := tx.Model(&Record{ID: id}).Update("next_id", nextID).Error; err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		return created, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("can not import records, error: %w", err)
+	}
+
+	return imported, nil
+}
+
+// DeleteRecordByID deletes a record from the storage by its ID together with all its subtasks,
+// ErrNotFound is returned if the record does not exist
+func (s *LocalStorage) DeleteRecordByID(id uint) error {
+	var ids []uint
+	err := s.journaledSelection("delete", selectRecord(id, true, &ids), func(tx *gorm.DB) ([]uint, error) {
+		if err := checkAffected(tx.Where(idsIn("id", ids)).Delete(&Record{}), id); err != nil {
+			return nil, err
+		}
+
+		return nil, pruneTagLinks(tx)
+	})
+	if err != nil {
+		return fmt.Errorf("can not delete record, error: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteRecords deletes records matching the filter together with all their subtasks as a single change, which
+// is undone at once; returns the number of deleted records, the zero filter matches all the records
+func (s *LocalStorage) DeleteRecords(filter Filter) (uint, error) {
+	var ids []uint
+	selectIDs := func(tx *gorm.DB) ([]uint, error) {
+		var matched []uint
+		if err := applyFilter(tx.Model(&Record{}), filter).Pluck("id", &matched).Error; err != nil {
+			return nil, fmt.Errorf("can not select records, error: %w", err)
+		}
+
+		ids = nil
+		if len(matched) == 0 {
+			return nil, nil
+		}
+
+		subtasks, err := subtasksOf(tx, matched)
+		if err != nil {
+			return nil, fmt.Errorf("can not get subtasks of records, error: %w", err)
+		}
+		ids = mergeIDs(matched, subtasks)
+
+		return ids, nil
+	}
+
+	err := s.journaledSelection("delete", selectIDs, func(tx *gorm.DB) ([]uint, error) {
+		return deleteRecords(ids...)(tx)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("can not delete records, error: %w", err)
+	}
+
+	return uint(len(ids)), nil
+}
+
+// DeleteLastRecord deletes the latest record from the storage together with all its subtasks,
+// ErrEmpty is returned if there are no records
+func (s *LocalStorage) DeleteLastRecord() error {
+	var ids []uint
+	selectIDs := func(tx *gorm.DB) ([]uint, error) {
+		var last []uint
+		if err := tx.Model(&Record{}).Order("id DESC").Limit(1).Pluck("id", &last).Error; err != nil {
+			return nil, fmt.Errorf("can not find the last record, error: %w", err)
+		}
+
+		if len(last) == 0 {
+			return nil, ErrEmpty
+		}
+
+		subtasks, err := subtasksOf(tx, last)
+		if err != nil {
+			return nil, fmt.Errorf("can not get subtasks of record, error: %w", err)
+		}
+		ids = mergeIDs(last, subtasks)
+
+		return ids, nil
+	}
+
+	err := s.journaledSelection("delete", selectIDs, func(tx *gorm.DB) ([]uint, error) {
+		return deleteRecords(ids...)(tx)
+	})
+	if err != nil {
+		return fmt.Errorf("can not delete the last record, error: %w", err)
 	}
 
 	return nil
 }
 
-// CleanUp cleans up database
+// Close closes the storage
+func (s *LocalStorage) Close() error {
+	return closeDb(s.db)
+}
+
+// CleanUp moves the database into the trash inside the storage directory, so that it can be restored by Undo,
+// and goes on with a new empty database keeping the settings, e.g. encryption parameters; only a few of the latest
+// cleaned up databases are kept
 func (s *LocalStorage) CleanUp() error {
 	if _, err := os.Stat(s.dbPath); err != nil {
-		return fmt.Errorf("database file does not exist, error: %s", err)
+		return fmt.Errorf("database file does not exist, error: %w", err)
 	}
 
-	if err := os.Remove(s.dbPath); err != nil {
-		return fmt.Errorf("database file can not be deleted, error: %s", err)
+	if _, err := backupDatabase(s.db, s.dbPath, "before-clean", s.options.backupLimit()); err != nil {
+		return err
+	}
+
+	settings, err := s.settings()
+	if err != nil {
+		return err
 	}
 
-	storageDir := filepath.Dir(s.dbPath)
-	if err := os.RemoveAll(storageDir); err != nil {
-		return fmt.Errorf("storage directory can not be deleted, error: %s", err)
+	// the empty database is prepared aside with the settings of the cleaned up one, e.g. encryption parameters,
+	// so that an encrypted database never turns into a plain one, even if the clean up fails halfway
+	empty := s.dbPath + ".empty"
+	if err = createEmptyDb(empty, s.options, settings); err != nil {
+		return fmt.Errorf("empty database can not be created, error: %w", err)
 	}
+	defer os.Remove(empty)
+
+	if err = checkpoint(s.db); err != nil {
+		return fmt.Errorf("database changes can not be written into the file, error: %w", err)
+	}
+
+	if err = s.Close(); err != nil {
+		return err
+	}
+
+	if err = moveToTrash(s.dbPath); err != nil {
+		return fmt.Errorf("database file can not be cleaned up, error: %w", err)
+	}
+
+	if err = os.Rename(empty, s.dbPath); err != nil {
+		return fmt.Errorf("empty database can not be moved into place, error: %w", err)
+	}
+
+	db, err := openDb(s.dbPath, s.options)
+	if err != nil {
+		return fmt.Errorf("empty database can not be opened, error: %w", err)
+	}
+	s.db = db
 
 	return nil
 }
 
+// createEmptyDb creates the database file without records holding the settings
+func createEmptyDb(dbPath string, options Options, settings []setting) error {
+	if err := removeWalFiles(dbPath); err != nil {
+		return err
+	}
+
+	if err := os.Remove(dbPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err := createDb(dbPath); err != nil {
+		return err
+	}
+
+	db, err := openDb(dbPath, options)
+	if err != nil {
+		return err
+	}
+
+	if len(settings) > 0 {
+		if err = db.Create(&settings).Error; err != nil {
+			_ = closeDb(db)
+			return fmt.Errorf("settings can not be kept, error: %w", err)
+		}
+	}
+
+	return closeDb(db)
+}
+
 // createCustomStorage creates a custom path storage
 func createCustomStorage(baseDir, dbDir, dbName string) (string, error) {
 	dbDirPath := path.Join(baseDir, dbDir)
 	if err := os.MkdirAll(dbDirPath, 0700); err != nil {
-		return "", fmt.Errorf("can not create storage directory, error: %s", err)
+		return "", fmt.Errorf("can not create storage directory, error: %w", err)
 	}
 
 	dbPath := path.Join(dbDirPath, dbName)
 	if err := createDb(dbPath); err != nil {
-		return "", fmt.Errorf("can not prepare database, error: %s", err)
+		return "", fmt.Errorf("can not prepare database, error: %w", err)
 	}
 
 	return dbPath, nil
 }
 
-// createStorage creates a default storage in current user's home directory
-func createStorage() (string, error) {
+// storageDir returns the base directory and the storage directory inside it:
+// $XDG_DATA_HOME/later when the variable is set, ~/.later otherwise
+func storageDir() (string, string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return "", fmt.Errorf("can not locate home directory, error: %s", err)
+		if dataHome != "" {
+			return dataHome, xdgDbDir, nil
+		}
+		return "", "", fmt.Errorf("can not locate home directory, error: %w", err)
+	}
+
+	// ~/.later is kept until $XDG_DATA_HOME/later is created, so that tasks stored before the variable
+	// has been set do not disappear
+	if dataHome != "" && (isDir(filepath.Join(dataHome, xdgDbDir)) || !isDir(filepath.Join(homeDir, defaultDbDir))) {
+		return dataHome, xdgDbDir, nil
+	}
+
+	return homeDir, defaultDbDir, nil
+}
+
+// isDir returns whether the directory exists at the path
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// createStorage creates a default storage in the data directory of current user
+func createStorage() (string, error) {
+	baseDir, dbDir, err := storageDir()
+	if err != nil {
+		return "", err
 	}
 
-	dbPath, err := createCustomStorage(homeDir, defaultDbDir, defaultDbFile)
+	dbPath, err := createCustomStorage(baseDir, dbDir, defaultDbFile)
 	if err != nil {
-		return "", fmt.Errorf("can not create storage, error: %s", err)
+		return "", fmt.Errorf("can not create storage, error: %w", err)
 	}
 
 	return dbPath, nil
@@ -202,20 +880,462 @@ func createDb(dbPath string) error {
 
 	file, err := os.Create(dbPath)
 	if err != nil {
-		return fmt.Errorf("database file can not be created, error: %s", err)
+		return fmt.Errorf("database file can not be created, error: %w", err)
 	}
 
 	if err = file.Close(); err != nil {
-		return fmt.Errorf("database file can not be closed, error: %s", err)
+		return fmt.Errorf("database file can not be closed, error: %w", err)
 	}
 
 	return nil
 }
 
-// createTable creates table for record entities
-func createTable(db *gorm.DB) error {
-	if err := db.AutoMigrate(&Record{}); err != nil {
-		return fmt.Errorf("can not migrate the schema, error: %s", err)
+// openDb opens the database file and prepares its schema
+func openDb(dbPath string, options Options) (*gorm.DB, error) {
+	// errors are returned to the caller, logging them would break machine-readable output
+	db, err := gorm.Open(sqlite.Open(dbPath+connectionParams), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return nil, fmt.Errorf("database connection can not be established, error: %w", err)
+	}
+
+	if err = createTable(db, dbPath, options); err != nil {
+		return nil, fmt.Errorf("table can not be created, error: %w", err)
+	}
+
+	return db, nil
+}
+
+// closeDb closes connections to the database
+func closeDb(gormDB *gorm.DB) error {
+	db, err := gormDB.DB()
+	if err != nil {
+		return fmt.Errorf("can not get database object, error: %w\n", err)
+	}
+
+	if err := db.Close(); err != nil {
+		return fmt.Errorf("database connection can not be closed, error: %w\n", err)
+	}
+
+	return nil
+}
+
+// retryOnBusy runs the operation again while the database stays locked by other connections
+// longer than the busy timeout
+func retryOnBusy(operation func() error) error {
+	var err error
+	for attempt := 1; attempt <= busyRetries; attempt++ {
+		if err = operation(); !isBusy(err) {
+			return err
+		}
+		time.Sleep(time.Duration(attempt) * busyRetryDelay)
+	}
+
+	return err
+}
+
+// isBusy reports whether the error is caused by the database locked by another connection
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
+
+// checkpoint moves changes from the write-ahead log into the database file and truncates the log,
+// so that the database file can be moved or copied on its own
+func checkpoint(db *gorm.DB) error {
+	return retryOnBusy(func() error {
+		return db.Exec("PRAGMA wal_checkpoint(TRUNCATE)").Error
+	})
+}
+
+// removeWalFiles removes the write-ahead log files left next to the database file
+func removeWalFiles(dbPath string) error {
+	for _, suffix := range walSuffixes {
+		if err := os.Remove(dbPath + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createTable creates tables for record entities by applying pending migrations, unless they are skipped
+func createTable(db *gorm.DB, dbPath string, options Options) error {
+	if options.SkipMigrations {
+		return nil
+	}
+
+	if _, _, err := migrate(db, dbPath, options); err != nil {
+		return fmt.Errorf("can not migrate the schema, error: %w", err)
+	}
+
+	if err := retryOnBusy(func() error { return createSearchIndex(db) }); err != nil {
+		return fmt.Errorf("can not create search index, error: %w", err)
+	}
+
+	return nil
+}
+
+// createSearchIndex creates FTS5 table for records content with triggers keeping it in sync,
+// the index is rebuilt if it has been just created or could have missed changes; without FTS5
+// support the triggers are dropped, so that records can still be modified
+func createSearchIndex(db *gorm.DB) error {
+	if !hasFullTextSearch(db) {
+		for name := range searchIndexTriggers {
+			if err := db.Exec("DROP TRIGGER IF EXISTS " + name).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var existing int64
+	if err := db.Table("sqlite_master").Where("type = ? AND name LIKE ?", "trigger", "records_fts_%").Count(&existing).Error; err != nil {
+		return err
+	}
+
+	if int(existing) == len(searchIndexTriggers) && db.Migrator().HasTable("records_fts") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		statement := "CREATE VIRTUAL TABLE IF NOT EXISTS records_fts USING fts5(content, content='records', content_rowid='id')"
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+
+		for name, trigger := range searchIndexTriggers {
+			if err := tx.Exec("DROP TRIGGER IF EXISTS " + name).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec(trigger).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Exec("INSERT INTO records_fts(records_fts) VALUES ('rebuild')").Error
+	})
+}
+
+// hasFullTextSearch reports whether SQLite library is compiled with FTS5 support
+func hasFullTextSearch(db *gorm.DB) bool {
+	var enabled bool
+	if err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled).Error; err != nil {
+		return false
+	}
+
+	return enabled
+}
+
+// applyFilter narrows down the query according to the filter
+func applyFilter(db *gorm.DB, filter Filter) *gorm.DB {
+	switch filter.Status {
+	case StatusPending:
+		db = db.Where("done = ?", false)
+	case StatusDone:
+		db = db.Where("done = ?", true)
+	}
+
+	if len(filter.IDs) > 0 {
+		db = db.Where(idsIn("id", filter.IDs))
+	}
+
+	if filter.List != "" {
+		db = db.Where("list_id IN (SELECT id FROM lists WHERE name = ?)", NormalizeList(filter.List))
+	}
+
+	if filter.Tag != "" {
+		db = db.Where(
+			"id IN (SELECT record_tags.record_id FROM record_tags JOIN tags ON tags.id = record_tags.tag_id WHERE tags.name = ?)",
+			NormalizeTag(filter.Tag),
+		)
+	}
+
+	if !filter.DueBefore.IsZero() {
+		db = db.Where("due_at IS NOT NULL AND julianday(due_at) < julianday(?)", filter.DueBefore)
+	}
+
+	if !filter.CreatedBefore.IsZero() {
+		db = db.Where("julianday(created_at) < julianday(?)", filter.CreatedBefore)
+	}
+
+	return db
+}
+
+// applyOrder sorts query results according to the order
+func applyOrder(db *gorm.DB, order Order) *gorm.DB {
+	switch order {
+	case OrderDue:
+		return db.Order("due_at IS NULL, julianday(due_at) ASC, id DESC")
+	case OrderPriority:
+		return db.Order("priority DESC, id DESC")
+	case OrderOldest:
+		return db.Order("id ASC")
+	}
+
+	return db.Order("id DESC")
+}
+
+// resolveTags finds tags by their names, creating missing ones
+func resolveTags(tx *gorm.DB, tags []Tag) ([]Tag, error) {
+	resolved := make([]Tag, 0, len(tags))
+	for _, tag := range tags {
+		name := NormalizeTag(tag.Name)
+		if name == "" {
+			return nil, newError(ErrInvalidInput, "tag name can not be empty")
+		}
+
+		existing := Tag{}
+		if err := tx.Where(Tag{Name: name}).FirstOrCreate(&existing).Error; err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, existing)
+	}
+
+	return resolved, nil
+}
+
+// pruneTagLinks deletes links between tags and records which do not exist anymore
+func pruneTagLinks(db *gorm.DB) error {
+	return db.Exec("DELETE FROM record_tags WHERE record_id NOT IN (SELECT id FROM records)").Error
+}
+
+// createRecord creates a record with its tags, creating missing tags; the parent of a subtask must exist;
+// a new record has no next occurrence yet, and only a done one has the completion time
+func createRecord(tx *gorm.DB, record *Record) error {
+	if err := validateRecurrence(record.Recurrence); err != nil {
+		return err
+	}
+
+	record.NextID = nil
+	if !record.Done {
+		record.CompletedAt = nil
+	}
+
+	if record.ParentID != nil {
+		var count int64
+		if err := tx.Model(&Record{}).Where("id = ?", *record.ParentID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return newError(ErrInvalidInput, "parent record with ID %d does not exist", *record.ParentID)
+		}
+	}
+
+	if record.List != nil {
+		list, err := resolveList(tx, record.List.Name)
+		if err != nil {
+			return err
+		}
+		record.List, record.ListID = list, nil
+		if list != nil {
+			record.ListID = &list.ID
+		}
+	}
+
+	if err := tx.Omit(clause.Associations).Create(record).Error; err != nil {
+		return err
+	}
+
+	if len(record.Tags) == 0 {
+		return nil
+	}
+
+	tags, err := resolveTags(tx, record.Tags)
+	if err != nil {
+		return err
+	}
+	record.Tags = tags
+
+	return tx.Model(record).Association("Tags").Append(tags)
+}
+
+// selectRecord returns the selection of the record by its ID together with all its subtasks if they are included,
+// the selected IDs are kept in ids for the change, the record itself goes first
+func selectRecord(id uint, withSubtasks bool, ids *[]uint) func(tx *gorm.DB) ([]uint, error) {
+	return func(tx *gorm.DB) ([]uint, error) {
+		*ids = []uint{id}
+		if !withSubtasks {
+			return *ids, nil
+		}
+
+		subtasks, err := subtasksOf(tx, *ids)
+		if err != nil {
+			return nil, fmt.Errorf("can not get subtasks of record, error: %w", err)
+		}
+		*ids = append(*ids, subtasks...)
+
+		return *ids, nil
+	}
+}
+
+// changeStatus sets completion status of the record, completing the given subtasks as well unless they are done
+// already; completion of a pending recurring record creates its next occurrence. Returns IDs of created records
+func changeStatus(tx *gorm.DB, record Record, done bool, subtasks []uint) ([]uint, error) {
+	var completedAt *time.Time
+	if done {
+		now := time.Now()
+		completedAt = &now
+	}
+
+	result := tx.Model(&Record{ID: record.ID}).Updates(map[string]interface{}{
+		"done":         done,
+		"completed_at": completedAt,
+	})
+	if err := checkAffected(result, record.ID); err != nil {
+		return nil, err
+	}
+
+	if done && len(subtasks) > 0 {
+		err := tx.Model(&Record{}).Where(idsIn("id", subtasks)).Where("done = ?", false).Updates(map[string]interface{}{
+			"done":         true,
+			"completed_at": completedAt,
+		}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !done || record.Done || record.Recurrence == "" {
+		return nil, nil
+	}
+
+	// a record completed again after reopening keeps the occurrence created on the first completion
+	if record.NextID != nil {
+		var count int64
+		if err := tx.Model(&Record{}).Where("id = ?", *record.NextID).Count(&count).Error; err != nil || count > 0 {
+			return nil, err
+		}
+	}
+
+	next, err := nextOccurrence(record, *completedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err = createRecord(tx, &next); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Model(&Record{ID: record.ID}).Update("next_id", next.ID).Error; err != nil {
+		return nil, err
+	}
+
+	return []uint{next.ID}, nil
+}
+
+// subtasksOf returns IDs of all the subtasks of the records, including subtasks of subtasks, in ascending order
+func subtasksOf(db *gorm.DB, ids []uint) ([]uint, error) {
+	var subtasks []uint
+	err := db.Raw(`WITH RECURSIVE subtasks(id) AS (
+			SELECT id FROM records WHERE parent_id IN (SELECT value FROM json_each(?))
+			UNION
+			SELECT records.id FROM records JOIN subtasks ON records.parent_id = subtasks.id
+		)
+		SELECT id FROM subtasks ORDER BY id`, encodeIDs(ids)).Scan(&subtasks).Error
+
+	return subtasks, err
+}
+
+// idsIn returns the condition matching the column against the IDs, which are bound as a single JSON parameter,
+// so that bulk operations never exceed the SQLite limit of bound parameters however many records they select
+func idsIn(column string, ids []uint) clause.Expr {
+	return clause.Expr{SQL: column + " IN (SELECT value FROM json_each(?))", Vars: []interface{}{encodeIDs(ids)}}
+}
+
+// encodeIDs returns the IDs as a JSON array
+func encodeIDs(ids []uint) string {
+	encoded, _ := json.Marshal(append([]uint{}, ids...))
+	return string(encoded)
+}
+
+// validateRecurrence returns the invalid input error if the recurrence rule can not be parsed,
+// the empty rule is valid as records without recurrence have it
+func validateRecurrence(rule string) error {
+	if rule == "" {
+		return nil
+	}
+
+	if _, err := recurrence.Parse(rule); err != nil {
+		return newError(ErrInvalidInput, "recurrence '%s' is invalid, error: %s", rule, err)
+	}
+
+	return nil
+}
+
+// nextOccurrence returns a new pending record repeating the recurring one, due at the first occurrence
+// after the completion time; records without the due date repeat from the completion time
+func nextOccurrence(record Record, completedAt time.Time) (Record, error) {
+	rule, err := recurrence.Parse(record.Recurrence)
+	if err != nil {
+		return Record{}, fmt.Errorf("recurrence of record %d is invalid, error: %w", record.ID, err)
+	}
+
+	dueAt := completedAt
+	if record.DueAt != nil {
+		dueAt = *record.DueAt
+	}
+	for dueAt = rule.Next(dueAt); !dueAt.After(completedAt); dueAt = rule.Next(dueAt) {
+	}
+
+	next := Record{
+		Content:    record.Content,
+		DueAt:      &dueAt,
+		Priority:   record.Priority,
+		List:       record.List,
+		Recurrence: record.Recurrence,
+		ParentID:   record.ParentID,
+	}
+	for _, tag := range record.Tags {
+		next.Tags = append(next.Tags, Tag{Name: tag.Name})
+	}
+
+	return next, nil
+}
+
+// resolveList finds a list by its name, creating it if it does not exist; the empty name resolves to no list
+func resolveList(tx *gorm.DB, name string) (*List, error) {
+	name = NormalizeList(name)
+	if name == "" {
+		return nil, nil
+	}
+
+	list := List{Name: name}
+	if err := tx.Where(List{Name: name}).FirstOrCreate(&list).Error; err != nil {
+		return nil, fmt.Errorf("list '%s' can not be resolved, error: %w", name, err)
+	}
+
+	return &list, nil
+}
+
+// duplicateKey returns a key identifying records with the same content created at the same moment
+func duplicateKey(record Record) string {
+	return record.CreatedAt.UTC().Format(time.RFC3339Nano) + " " + record.Content
+}
+
+// deleteRecords returns a change deleting records by their IDs with links to their tags,
+// ErrNotFound is returned if some of the records do not exist anymore
+func deleteRecords(ids ...uint) change {
+	return func(tx *gorm.DB) ([]uint, error) {
+		result := tx.Where(idsIn("id", ids)).Delete(&Record{})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+
+		if result.RowsAffected != int64(len(ids)) {
+			return nil, newError(ErrNotFound, "%d of %d records do not exist anymore", int64(len(ids))-result.RowsAffected, len(ids))
+		}
+
+		return nil, pruneTagLinks(tx)
+	}
+}
+
+// checkAffected returns an error if the query has failed or the record with the ID has not been found
+func checkAffected(result *gorm.DB, id uint) error {
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return notFound(id)
 	}
 
 	return nil
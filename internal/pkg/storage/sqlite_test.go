@@ -1,44 +1,62 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 const (
-	testBaseDir = "."
-	testDbDir   = "test_db_dir"
-	testDbName  = "test_db_name.db"
-	testDbPath  = "./test_db_dir/test_db_name.db"
+	testDbDir  = "test_db_dir"
+	testDbName = "test_db_name.db"
 )
 
-// createTestStorage creates test sqlite database using a custom test path
-func createTestStorage() (*LocalStorage, error) {
-	return NewCustomLocalStorage(testBaseDir, testDbDir, testDbName)
+// createTestStorage creates test sqlite database using a custom test path in a temporary directory
+func createTestStorage(t *testing.T) (*LocalStorage, error) {
+	return NewCustomLocalStorage(t.TempDir(), testDbDir, testDbName, Options{})
 }
 
 // TestNewCustomLocalStorage checks that sqlite database as a storage can be
-// created and accessed using a custom path
+// created and accessed using a custom path, and moved into the trash on clean up leaving an empty one
 func TestNewCustomLocalStorage(t *testing.T) {
-	s, err := NewCustomLocalStorage(testBaseDir, testDbDir, testDbName)
+	baseDir := t.TempDir()
+	testDbPath := filepath.Join(baseDir, testDbDir, testDbName)
+
+	s, err := NewCustomLocalStorage(baseDir, testDbDir, testDbName, Options{})
 	if err != nil {
-		t.Errorf("custom local storage can not be created, unexpected error: %s", err)
+		t.Fatalf("custom local storage can not be created, unexpected error: %s", err)
 	}
 
-	defer func() {
-		if err = s.CleanUp(); err != nil {
-			t.Errorf("database file was created, but can not be deleted, unexpected error: %s", err)
-		}
-	}()
-
-	if _, err := os.Stat(testDbPath); err != nil {
+	if _, err = os.Stat(testDbPath); err != nil {
 		t.Errorf("database file was not created, unexpected error: %s", err)
 	}
+
+	if err = s.CreateRecord(&Record{Content: "test_record"}); err != nil {
+		t.Fatalf("test record can not be created, unexpected error: %s", err)
+	}
+
+	if err = s.CleanUp(); err != nil {
+		t.Fatalf("database file was created, but can not be deleted, unexpected error: %s", err)
+	}
+
+	if count, err := s.CountRecords(Filter{}); err != nil || count != 0 {
+		t.Errorf("empty database expected in place of the cleaned up one, got %d records, error: %v", count, err)
+	}
+
+	snapshots, err := filepath.Glob(filepath.Join(baseDir, testDbDir, trashDir, testDbName+".*"))
+	if err != nil || len(snapshots) != 1 {
+		t.Errorf("exactly 1 database file expected in the trash, got: %v, error: %v", snapshots, err)
+	}
 }
 
 // TestCreateRetrieveCountRecordSmoke checks that record can be created, retrieved and counter; generic smoke test
 func TestCreateRetrieveCountRecordSmoke(t *testing.T) {
-	s, err := createTestStorage()
+	s, err := createTestStorage(t)
 	if err != nil {
 		t.Errorf("test storage can not be created, unexpected error: %s", err)
 	}
@@ -51,11 +69,11 @@ func TestCreateRetrieveCountRecordSmoke(t *testing.T) {
 
 	testRecordContent := "test_record"
 
-	if err = s.CreateRecord(testRecordContent); err != nil {
+	if err = s.CreateRecord(&Record{Content: testRecordContent}); err != nil {
 		t.Errorf("test record can not be created, unexpected error: %s", err)
 	}
 
-	records, err := s.GetRecords()
+	records, err := s.GetRecords(Filter{})
 	if err != nil {
 		t.Errorf("records can not be retrieved, unexpected error: %s", err)
 	}
@@ -68,7 +86,7 @@ func TestCreateRetrieveCountRecordSmoke(t *testing.T) {
 		t.Errorf("expected test record content: %s, got: %s", testRecordContent, records[0].Content)
 	}
 
-	count, err := s.CountRecords()
+	count, err := s.CountRecords(Filter{})
 	if err != nil {
 		t.Errorf("records can not be counted, unexpected error: %s", err)
 	}
@@ -77,3 +95,1391 @@ func TestCreateRetrieveCountRecordSmoke(t *testing.T) {
 		t.Errorf("exactly 1 test record expected, got: %d", count)
 	}
 }
+
+// TestMarkRecordDone checks that record can be completed and reopened, and that completed records are filtered out
+func TestMarkRecordDone(t *testing.T) {
+	s, err := createTestStorage(t)
+	if err != nil {
+		t.Fatalf("test storage can not be created, unexpected error: %s", err)
+	}
+
+	defer func() {
+		if err = s.CleanUp(); err != nil {
+			t.Errorf("database file was created, but can not be deleted, unexpected error: %s", err)
+		}
+	}()
+
+	for _, content := range []string{"first_record", "second_record"} {
+		if err = s.CreateRecord(&Record{Content: content}); err != nil {
+			t.Fatalf("test record can not be created, unexpected error: %s", err)
+		}
+	}
+
+	if err = s.MarkRecordDone(1, true); err != nil {
+		t.Fatalf("test record can not be completed, unexpected error: %s", err)
+	}
+
+	pending, err := s.GetRecords(Filter{Status: StatusPending})
+	if err != nil {
+		t.Fatalf("records can not be retrieved, unexpected error: %s", err)
+	}
+
+	if len(pending) != 1 || pending[0].Content != "second_record" {
+		t.Errorf("expected only second_record to be pending, got: %v", pending)
+	}
+
+	done, err := s.GetRecords(Filter{Status: StatusDone})
+	if err != nil {
+		t.Fatalf("records can not be retrieved, unexpected error: %s", err)
+	}
+
+	if len(done) != 1 || !done[0].Done || done[0].CompletedAt == nil {
+		t.Errorf("expected first_record to be completed with completion time, got: %v", done)
+	}
+
+	if err = s.MarkRecordDone(1, false); err != nil {
+		t.Fatalf("test record can not be reopened, unexpected error: %s", err)
+	}
+
+	count, err := s.CountRecords(Filter{Status: StatusPending})
+	if err != nil {
+		t.Fatalf("records can not be counted, unexpected error: %s", err)
+	}
+
+	if count != 2 {
+		t.Errorf("exactly 2 pending records expected, got: %d", count)
+	}
+
+	if err = s.MarkRecordDone(42, true); err == nil {
+		t.Errorf("error expected when completing a record that does not exist")
+	}
+}
+
+// TestDueRecords checks that records can be selected by due date and ordered by it
+func TestDueRecords(t *testing.T) {
+	s, err := createTestStorage(t)
+	if err != nil {
+		t.Fatalf("test storage can not be created, unexpected error: %s", err)
+	}
+
+	defer func() {
+		if err = s.CleanUp(); err != nil {
+			t.Errorf("database file was created, but can not be deleted, unexpected error: %s", err)
+		}
+	}()
+
+	now := time.Now()
+	yesterday, nextWeek := now.AddDate(0, 0, -1), now.AddDate(0, 0, 7)
+	testRecords := []*Record{
+		{Content: "later_record", DueAt: &nextWeek},
+		{Content: "no_due_record"},
+		{Content: "overdue_record", DueAt: &yesterday},
+	}
+
+	for _, record := range testRecords {
+		if err = s.CreateRecord(record); err != nil {
+			t.Fatalf("test record can not be created, unexpected error: %s", err)
+		}
+	}
+
+	overdue, err := s.GetRecords(Filter{DueBefore: now})
+	if err != nil {
+		t.Fatalf("records can not be retrieved, unexpected error: %s", err)
+	}
+
+	if len(overdue) != 1 || overdue[0].Content != "overdue_record" {
+		t.Errorf("expected only overdue_record to be selected, got: %v", overdue)
+	}
+
+	ordered, err := s.GetRecords(Filter{Order: OrderDue})
+	if err != nil {
+		t.Fatalf("records can not be retrieved, unexpected error: %s", err)
+	}
+
+	expected := []string{"overdue_record", "later_record", "no_due_record"}
+	for i, record := range ordered {
+		if record.Content != expected[i] {
+			t.Errorf("expected record %s at position %d, got: %s", expected[i], i, record.Content)
+		}
+	}
+}
+
+// TestRecordPriority checks that priority can be set and that records are ordered by it
+func TestRecordPriority(t *testing.T) {
+	s, err := createTestStorage(t)
+	if err != nil {
+		t.Fatalf("test storage can not be created, unexpected error: %s", err)
+	}
+
+	defer func() {
+		if err = s.CleanUp(); err != nil {
+			t.Errorf("database file was created, but can not be deleted, unexpected error: %s", err)
+		}
+	}()
+
+	testRecords := []*Record{
+		{Content: "high_record", Priority: PriorityHigh},
+		{Content: "low_record", Priority: PriorityLow},
+		{Content: "plain_record"},
+	}
+
+	for _, record := range testRecords {
+		if err = s.CreateRecord(record); err != nil {
+			t.Fatalf("test record can not be created, unexpected error: %s", err)
+		}
+	}
+
+	if err = s.SetRecordPriority(testRecords[2].ID, PriorityMedium); err != nil {
+		t.Fatalf("test record priority can not be set, unexpected error: %s", err)
+	}
+
+	ordered, err := s.GetRecords(Filter{Order: OrderPriority})
+	if err != nil {
+		t.Fatalf("records can not be retrieved, unexpected error: %s", err)
+	}
+
+	expected := []string{"high_record", "plain_record", "low_record"}
+	for i, record := range ordered {
+		if record.Content != expected[i] {
+			t.Errorf("expected record %s at position %d, got: %s", expected[i], i, record.Content)
+		}
+	}
+
+	if err = s.SetRecordPriority(42, PriorityHigh); err == nil {
+		t.Errorf("error expected when setting priority of a record that does not exist")
+	}
+}
+
+// TestRecordTags checks that records can be tagged on creation and later, filtered and counted by tags
+func TestRecordTags(t *testing.T) {
+	s, err := createTestStorage(t)
+	if err != nil {
+		t.Fatalf("test storage can not be created, unexpected error: %s", err)
+	}
+
+	defer func() {
+		if err = s.CleanUp(); err != nil {
+			t.Errorf("database file was created, but can not be deleted, unexpected error: %s", err)
+		}
+	}()
+
+	testRecords := []*Record{
+		{Content: "oncall_record", Tags: []Tag{{Name: "+OnCall"}}},
+		{Content: "review_record", Tags: []Tag{{Name: "review"}, {Name: "oncall"}}},
+		{Content: "plain_record"},
+	}
+
+	for _, record := range testRecords {
+		if err = s.CreateRecord(record); err != nil {
+			t.Fatalf("test record can not be created, unexpected error: %s", err)
+		}
+	}
+
+	if err = s.TagRecord(testRecords[2].ID, "personal"); err != nil {
+		t.Fatalf("test record can not be tagged, unexpected error: %s", err)
+	}
+
+	if err = s.UntagRecord(testRecords[1].ID, "review"); err != nil {
+		t.Fatalf("test record can not be untagged, unexpected error: %s", err)
+	}
+
+	oncall, err := s.GetRecords(Filter{Tag: "oncall"})
+	if err != nil {
+		t.Fatalf("records can not be retrieved, unexpected error: %s", err)
+	}
+
+	if len(oncall) != 2 {
+		t.Errorf("exactly 2 records tagged with oncall expected, got: %d", len(oncall))
+	}
+
+	if err = s.DeleteRecordByID(testRecords[0].ID); err != nil {
+		t.Fatalf("test record can not be deleted, unexpected error: %s", err)
+	}
+
+	tags, err := s.GetTags()
+	if err != nil {
+		t.Fatalf("tags can not be retrieved, unexpected error: %s", err)
+	}
+
+	expected := []TagCount{{Name: "oncall", Count: 1}, {Name: "personal", Count: 1}}
+	if len(tags) != len(expected) {
+		t.Fatalf("expected tags: %v, got: %v", expected, tags)
+	}
+
+	for i := range expected {
+		if tags[i] != expected[i] {
+			t.Errorf("expected tag %v at position %d, got: %v", expected[i], i, tags[i])
+		}
+	}
+
+	if err = s.UntagRecord(testRecords[2].ID, "oncall"); err == nil {
+		t.Errorf("error expected when removing a tag which is not attached to the record")
+	}
+
+	if err = s.TagRecord(42, "oncall"); err == nil {
+		t.Errorf("error expected when tagging a record that does not exist")
+	}
+}
+
+// TestSearchRecords checks that records can be found by words, prefixes and phrases with matches highlighted
+func TestSearchRecords(t *testing.T) {
+	s, err := createTestStorage(t)
+	if err != nil {
+		t.Fatalf("test storage can not be created, unexpected error: %s", err)
+	}
+
+	defer func() {
+		if err = s.CleanUp(); err != nil {
+			t.Errorf("database file was created, but can not be deleted, unexpected error: %s", err)
+		}
+	}()
+
+	for _, content := range []string{"deploy the billing service", "review deployment docs", "fix the billing bug"} {
+		if err = s.CreateRecord(&Record{Content: content}); err != nil {
+			t.Fatalf("test record can not be created, unexpected error: %s", err)
+		}
+	}
+
+	if err = s.DeleteRecordByID(3); err != nil {
+		t.Fatalf("test record can not be deleted, unexpected error: %s", err)
+	}
+
+	cases := map[string][]string{
+		"billing":           {"deploy the billing service"},
+		"deploy*":           {"deploy the billing service", "review deployment docs"},
+		`"billing service"`: {"deploy the billing service"},
+		"docs review":       {"review deployment docs"},
+		"missing":           nil,
+	}
+
+	for query, expected := range cases {
+		results, err := s.SearchRecords(query)
+		if err != nil {
+			t.Errorf("records can not be searched by '%s', unexpected error: %s", query, err)
+			continue
+		}
+
+		if len(results) != len(expected) {
+			t.Errorf("expected %d records found by '%s', got: %v", len(expected), query, results)
+			continue
+		}
+
+		for _, result := range results {
+			found := false
+			for _, content := range expected {
+				found = found || result.Record.Content == content
+			}
+			if !found {
+				t.Errorf("unexpected record '%s' found by '%s'", result.Record.Content, query)
+			}
+		}
+	}
+
+	results, err := s.SearchRecords("billing")
+	if err != nil {
+		t.Fatalf("records can not be searched, unexpected error: %s", err)
+	}
+
+	if expected := "deploy the " + HighlightStart + "billing" + HighlightEnd + " service"; results[0].Snippet != expected {
+		t.Errorf("expected snippet %q, got: %q", expected, results[0].Snippet)
+	}
+}
+
+// TestSearchPunctuatedTerms checks that terms with punctuation are searched as plain text instead of being read
+// as FTS5 syntax, so that builds with and without FTS5 find the same records
+func TestSearchPunctuatedTerms(t *testing.T) {
+	s, err := createTestStorage(t)
+	if err != nil {
+		t.Fatalf("test storage can not be created, unexpected error: %s", err)
+	}
+	defer s.Close()
+
+	contents := []string{"close ticket-123", "send e-mail to foo:bar", "release v1.2", "don't forget \"quotes\""}
+	for _, content := range contents {
+		if err = s.CreateRecord(&Record{Content: content}); err != nil {
+			t.Fatalf("test record can not be created, unexpected error: %s", err)
+		}
+	}
+
+	cases := map[string]string{
+		"ticket-123":     contents[0],
+		"e-mail":         contents[1],
+		"foo:bar":        contents[1],
+		"v1.2":           contents[2],
+		"don't":          contents[3],
+		`don't "quotes"`: contents[3],
+		"ticket-12*":     contents[0],
+		"release AND":    contents[2],
+	}
+
+	for query, expected := range cases {
+		results, err := s.SearchRecords(query)
+		if err != nil {
+			t.Errorf("records can not be searched by '%s', unexpected error: %s", query, err)
+			continue
+		}
+
+		if len(results) != 1 || results[0].Record.Content != expected {
+			t.Errorf("expected '%s' found by '%s', got: %v", expected, query, results)
+		}
+	}
+
+	if _, err = s.SearchRecords("AND *"); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("expected invalid input error for the query without terms, got: %v", err)
+	}
+}
+
+// TestUpdateRecord checks that record content can be edited in place keeping its ID and creation time
+func TestUpdateRecord(t *testing.T) {
+	s, err := createTestStorage(t)
+	if err != nil {
+		t.Fatalf("test storage can not be created, unexpected error: %s", err)
+	}
+
+	defer func() {
+		if err = s.CleanUp(); err != nil {
+			t.Errorf("database file was created, but can not be deleted, unexpected error: %s", err)
+		}
+	}()
+
+	record := &Record{Content: "tset_record", Priority: PriorityHigh}
+	if err = s.CreateRecord(record); err != nil {
+		t.Fatalf("test record can not be created, unexpected error: %s", err)
+	}
+
+	created, err := s.GetRecordByID(record.ID)
+	if err != nil {
+		t.Fatalf("test record can not be retrieved, unexpected error: %s", err)
+	}
+
+	if created.UpdatedAt != nil {
+		t.Errorf("new record is not expected to have update time, got: %s", created.UpdatedAt)
+	}
+
+	created.Content = "test_record"
+	if err = s.UpdateRecord(&created); err != nil {
+		t.Fatalf("test record can not be updated, unexpected error: %s", err)
+	}
+
+	updated, err := s.GetRecordByID(record.ID)
+	if err != nil {
+		t.Fatalf("test record can not be retrieved, unexpected error: %s", err)
+	}
+
+	if updated.Content != "test_record" || updated.Priority != PriorityHigh {
+		t.Errorf("expected updated content with the same priority, got: %v", updated)
+	}
+
+	if !updated.CreatedAt.Equal(created.CreatedAt) || updated.UpdatedAt == nil {
+		t.Errorf("expected creation time to be kept and update time to be set, got: %v", updated)
+	}
+
+	results, err := s.SearchRecords("test_record")
+	if err != nil || len(results) != 1 {
+		t.Errorf("updated record expected to be found by new content, got: %v, error: %v", results, err)
+	}
+
+	if err = s.UpdateRecord(&Record{ID: 42, Content: "missing_record"}); err == nil {
+		t.Errorf("error expected when updating a record that does not exist")
+	}
+}
+
+// TestUndoRedo checks that mutations can be reverted and applied again, including a database clean up
+func TestUndoRedo(t *testing.T) {
+	baseDir := t.TempDir()
+	s, err := NewCustomLocalStorage(baseDir, testDbDir, testDbName, Options{})
+	if err != nil {
+		t.Fatalf("test storage can not be created, unexpected error: %s", err)
+	}
+
+	defer func() {
+		if err = s.Close(); err != nil {
+			t.Errorf("test storage can not be closed, unexpected error: %s", err)
+		}
+	}()
+
+	record := &Record{Content: "test_record", Tags: []Tag{{Name: "test"}}}
+	if err = s.CreateRecord(record); err != nil {
+		t.Fatalf("test record can not be created, unexpected error: %s", err)
+	}
+
+	if err = s.DeleteRecordByID(record.ID); err != nil {
+		t.Fatalf("test record can not be deleted, unexpected error: %s", err)
+	}
+
+	description, err := s.Undo()
+	if err != nil {
+		t.Fatalf("deletion can not be undone, unexpected error: %s", err)
+	}
+
+	if description != "delete record 1" {
+		t.Errorf("expected undone operation description 'delete record 1', got: %s", description)
+	}
+
+	restored, err := s.GetRecordByID(record.ID)
+	if err != nil {
+		t.Fatalf("deleted record was not restored, unexpected error: %s", err)
+	}
+
+	if restored.Content != record.Content || len(restored.Tags) != 1 || !restored.CreatedAt.Equal(record.CreatedAt) {
+		t.Errorf("expected record to be restored as %v, got: %v", record, restored)
+	}
+
+	if _, err = s.Redo(); err != nil {
+		t.Fatalf("deletion can not be redone, unexpected error: %s", err)
+	}
+
+	if count, _ := s.CountRecords(Filter{}); count != 0 {
+		t.Errorf("no records expected after redo of deletion, got: %d", count)
+	}
+
+	if _, err = s.Redo(); err == nil {
+		t.Errorf("error expected when there is nothing to redo")
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err = s.Undo(); err != nil {
+			t.Fatalf("operation can not be undone, unexpected error: %s", err)
+		}
+	}
+
+	if count, _ := s.CountRecords(Filter{}); count != 0 {
+		t.Errorf("no records expected after undo of creation, got: %d", count)
+	}
+
+	if _, err = s.Undo(); err == nil {
+		t.Errorf("error expected when there is nothing to undo")
+	}
+
+	if _, err = s.Redo(); err != nil {
+		t.Fatalf("creation can not be redone, unexpected error: %s", err)
+	}
+
+	if err = s.CleanUp(); err != nil {
+		t.Fatalf("test storage can not be cleaned up, unexpected error: %s", err)
+	}
+
+	if s, err = NewCustomLocalStorage(baseDir, testDbDir, testDbName, Options{}); err != nil {
+		t.Fatalf("test storage can not be created again, unexpected error: %s", err)
+	}
+
+	if description, err = s.Undo(); err != nil || description != "clean up" {
+		t.Fatalf("clean up can not be undone, got: %s, unexpected error: %v", description, err)
+	}
+
+	if count, _ := s.CountRecords(Filter{}); count != 1 {
+		t.Errorf("exactly 1 record expected after undo of clean up, got: %d", count)
+	}
+}
+
+// TestImportRecords checks that imported records keep their attributes, duplicates are skipped on merge
+// and the existing records are deleted on replace
+func TestImportRecords(t *testing.T) {
+	s, err := createTestStorage(t)
+	if err != nil {
+		t.Fatalf("test storage can not be created, unexpected error: %s", err)
+	}
+
+	defer func() {
+		if err = s.CleanUp(); err != nil {
+			t.Errorf("database file was created, but can not be deleted, unexpected error: %s", err)
+		}
+	}()
+
+	existing := &Record{Content: "test_record"}
+	if err = s.CreateRecord(existing); err != nil {
+		t.Fatalf("test record can not be created, unexpected error: %s", err)
+	}
+
+	createdAt := time.Date(2026, time.October, 1, 10, 0, 0, 0, time.UTC)
+	records := []Record{
+		{ID: existing.ID, Content: existing.Content, CreatedAt: existing.CreatedAt},
+		{ID: 7, Content: "imported_record", CreatedAt: createdAt, Done: true, Priority: PriorityLow, Tags: []Tag{{Name: "test"}}},
+		{ID: 8, Content: "imported_record", CreatedAt: createdAt},
+	}
+
+	imported, err := s.ImportRecords(records, false)
+	if err != nil {
+		t.Fatalf("test records can not be imported, unexpected error: %s", err)
+	}
+
+	if imported != 1 {
+		t.Errorf("exactly 1 record expected to be imported with duplicates skipped, got: %d", imported)
+	}
+
+	all, err := s.GetRecords(Filter{Order: OrderOldest})
+	if err != nil || len(all) != 2 {
+		t.Fatalf("expected 2 records after merge, got: %v, error: %v", all, err)
+	}
+
+	record := all[1]
+	if record.ID == 7 || !record.CreatedAt.Equal(createdAt) || !record.Done || record.Priority != PriorityLow || len(record.Tags) != 1 {
+		t.Errorf("expected imported record with a new ID and kept attributes, got: %v", record)
+	}
+
+	parentID := uint(7)
+	subtask := Record{ID: 9, Content: "imported_subtask", CreatedAt: createdAt, ParentID: &parentID}
+	if imported, err = s.ImportRecords([]Record{subtask, records[1]}, true); err != nil || imported != 2 {
+		t.Fatalf("expected 2 records to be imported on replace, got: %d, error: %v", imported, err)
+	}
+
+	if all, err = s.GetRecords(Filter{Order: OrderOldest}); err != nil || len(all) != 2 || all[0].ParentID == nil || *all[0].ParentID != all[1].ID {
+		t.Errorf("expected imported subtask to be linked to the new ID of its parent, got: %v, error: %v", all, err)
+	}
+
+	if imported, err = s.ImportRecords(records[1:], true); err != nil || imported != 1 {
+		t.Fatalf("expected 1 record to be imported on replace, got: %d, error: %v", imported, err)
+	}
+
+	if count, _ := s.CountRecords(Filter{}); count != 1 {
+		t.Errorf("exactly 1 record expected after replace, got: %d", count)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err = s.Undo(); err != nil {
+			t.Fatalf("import can not be undone, unexpected error: %s", err)
+		}
+	}
+
+	if count, _ := s.CountRecords(Filter{}); count != 2 {
+		t.Errorf("expected 2 records after undo of replace, got: %d", count)
+	}
+}
+
+// TestRecordLists checks that records can be added to lists, moved between them and counted per list
+func TestRecordLists(t *testing.T) {
+	s, err := createTestStorage(t)
+	if err != nil {
+		t.Fatalf("test storage can not be created, unexpected error: %s", err)
+	}
+
+	defer func() {
+		if err = s.CleanUp(); err != nil {
+			t.Errorf("database file was created, but can not be deleted, unexpected error: %s", err)
+		}
+	}()
+
+	records := []*Record{
+		{Content: "test_work_record", List: &List{Name: "Work"}},
+		{Content: "test_personal_record", List: &List{Name: "personal"}},
+		{Content: "test_record"},
+	}
+	for _, record := range records {
+		if err = s.CreateRecord(record); err != nil {
+			t.Fatalf("test record can not be created, unexpected error: %s", err)
+		}
+	}
+
+	work, err := s.GetRecords(Filter{List: "work"})
+	if err != nil || len(work) != 1 || work[0].List == nil || work[0].List.Name != "work" {
+		t.Fatalf("expected 1 record in the work list, got: %v, error: %v", work, err)
+	}
+
+	if err = s.MoveRecord(records[2].ID, "work"); err != nil {
+		t.Fatalf("test record can not be moved, unexpected error: %s", err)
+	}
+
+	if err = s.MoveRecord(records[1].ID, ""); err != nil {
+		t.Fatalf("test record can not be removed from its list, unexpected error: %s", err)
+	}
+
+	if err = s.MoveRecord(42, "work"); err == nil {
+		t.Errorf("error expected when moving a record that does not exist")
+	}
+
+	lists, err := s.GetLists(Filter{})
+	if err != nil {
+		t.Fatalf("lists can not be retrieved, unexpected error: %s", err)
+	}
+
+	expected := []ListCount{{Name: "", Count: 1}, {Name: "personal", Count: 0}, {Name: "work", Count: 2}}
+	if len(lists) != len(expected) {
+		t.Fatalf("expected lists %v, got: %v", expected, lists)
+	}
+
+	for i := range expected {
+		if lists[i] != expected[i] {
+			t.Errorf("expected lists %v, got: %v", expected, lists)
+		}
+	}
+
+	if err = s.DeleteRecordByID(records[0].ID); err != nil {
+		t.Fatalf("test record can not be deleted, unexpected error: %s", err)
+	}
+
+	if _, err = s.Undo(); err != nil {
+		t.Fatalf("deletion can not be undone, unexpected error: %s", err)
+	}
+
+	if record, err := s.GetRecordByID(records[0].ID); err != nil || record.List == nil || record.List.Name != "work" {
+		t.Errorf("expected record to be restored into its list, got: %v, error: %v", record, err)
+	}
+}
+
+// TestRecurringRecord checks that completing a recurring record creates its next occurrence
+func TestRecurringRecord(t *testing.T) {
+	s, err := createTestStorage(t)
+	if err != nil {
+		t.Fatalf("test storage can not be created, unexpected error: %s", err)
+	}
+
+	defer func() {
+		if err = s.CleanUp(); err != nil {
+			t.Errorf("database file was created, but can not be deleted, unexpected error: %s", err)
+		}
+	}()
+
+	dueAt := time.Now().AddDate(0, 0, -10)
+	record := &Record{
+		Content:    "test_recurring_record",
+		DueAt:      &dueAt,
+		Priority:   PriorityHigh,
+		Tags:       []Tag{{Name: "home"}},
+		List:       &List{Name: "chores"},
+		Recurrence: "FREQ=WEEKLY",
+	}
+	if err = s.CreateRecord(record); err != nil {
+		t.Fatalf("test record can not be created, unexpected error: %s", err)
+	}
+
+	if err = s.MarkRecordDone(record.ID, true); err != nil {
+		t.Fatalf("test record can not be marked as done, unexpected error: %s", err)
+	}
+
+	next, err := s.GetRecordByID(record.ID + 1)
+	if err != nil {
+		t.Fatalf("expected next occurrence to be created, unexpected error: %s", err)
+	}
+
+	expectedDue := dueAt.AddDate(0, 0, 14)
+	if next.Done || next.DueAt == nil || !next.DueAt.Equal(expectedDue) || next.Recurrence != record.Recurrence {
+		t.Errorf("expected pending occurrence due at %s, got: %v", expectedDue, next)
+	}
+
+	if next.Priority != PriorityHigh || len(next.Tags) != 1 || next.List == nil || next.List.Name != "chores" {
+		t.Errorf("expected occurrence to keep priority, tags and list, got: %v", next)
+	}
+
+	if err = s.MarkRecordDone(record.ID, true); err != nil {
+		t.Fatalf("test record can not be marked as done, unexpected error: %s", err)
+	}
+
+	if count, _ := s.CountRecords(Filter{}); count != 2 {
+		t.Errorf("expected no occurrence for already completed record, got %d records", count)
+	}
+
+	if _, err = s.Undo(); err != nil {
+		t.Fatalf("completion can not be undone, unexpected error: %s", err)
+	}
+
+	if _, err = s.Undo(); err != nil {
+		t.Fatalf("completion can not be undone, unexpected error: %s", err)
+	}
+
+	if count, _ := s.CountRecords(Filter{}); count != 1 {
+		t.Errorf("expected occurrence to be removed by undo, got %d records", count)
+	}
+}
+
+// TestSubtasks checks progress of subtasks and cascading completion and deletion of their parents
+func TestSubtasks(t *testing.T) {
+	s, err := createTestStorage(t)
+	if err != nil {
+		t.Fatalf("test storage can not be created, unexpected error: %s", err)
+	}
+
+	defer func() {
+		if err = s.CleanUp(); err != nil {
+			t.Errorf("database file was created, but can not be deleted, unexpected error: %s", err)
+		}
+	}()
+
+	parent := &Record{Content: "test_parent_record"}
+	if err = s.CreateRecord(parent); err != nil {
+		t.Fatalf("test record can not be created, unexpected error: %s", err)
+	}
+
+	child := &Record{Content: "test_child_record", ParentID: &parent.ID}
+	if err = s.CreateRecord(child); err != nil {
+		t.Fatalf("test subtask can not be created, unexpected error: %s", err)
+	}
+
+	for _, content := range []string{"test_grandchild_record", "test_done_grandchild_record"} {
+		if err = s.CreateRecord(&Record{Content: content, ParentID: &child.ID}); err != nil {
+			t.Fatalf("test subtask can not be created, unexpected error: %s", err)
+		}
+	}
+
+	missing := uint(42)
+	if err = s.CreateRecord(&Record{Content: "test_orphan_record", ParentID: &missing}); err == nil {
+		t.Errorf("error expected when parent record does not exist")
+	}
+
+	if err = s.MarkRecordDone(4, true); err != nil {
+		t.Fatalf("test subtask can not be marked as done, unexpected error: %s", err)
+	}
+
+	progress, err := s.GetProgress([]uint{parent.ID, child.ID, 3})
+	if err != nil {
+		t.Fatalf("progress can not be retrieved, unexpected error: %s", err)
+	}
+
+	if len(progress) != 2 || progress[parent.ID] != (Progress{Done: 0, Total: 1}) || progress[child.ID] != (Progress{Done: 1, Total: 2}) {
+		t.Errorf("expected progress of subtasks, got: %v", progress)
+	}
+
+	if err = s.MarkRecordDone(parent.ID, true); err != nil {
+		t.Fatalf("test record can not be marked as done, unexpected error: %s", err)
+	}
+
+	if count, _ := s.CountRecords(Filter{Status: StatusPending}); count != 0 {
+		t.Errorf("expected subtasks to be completed with their parent, got %d pending records", count)
+	}
+
+	if err = s.DeleteRecordByID(child.ID); err != nil {
+		t.Fatalf("test subtask can not be deleted, unexpected error: %s", err)
+	}
+
+	if count, _ := s.CountRecords(Filter{}); count != 1 {
+		t.Errorf("expected subtasks to be deleted with their parent, got %d records", count)
+	}
+
+	if _, err = s.Undo(); err != nil {
+		t.Fatalf("deletion can not be undone, unexpected error: %s", err)
+	}
+
+	if count, _ := s.CountRecords(Filter{}); count != 4 {
+		t.Errorf("expected subtasks to be restored by undo, got %d records", count)
+	}
+}
+
+// TestProfileLocalStorage checks that profiles and custom database paths resolve to distinct database files
+func TestProfileLocalStorage(t *testing.T) {
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+	t.Setenv("XDG_DATA_HOME", "")
+
+	for profile, dbName := range map[string]string{"": defaultDbFile, "default": defaultDbFile, "work": "work.db"} {
+		s, err := NewProfileLocalStorage(profile, Options{})
+		if err != nil {
+			t.Fatalf("storage of profile '%s' can not be created, unexpected error: %s", profile, err)
+		}
+
+		if expected := filepath.Join(homeDir, defaultDbDir, dbName); s.dbPath != expected {
+			t.Errorf("expected profile '%s' database at %s, got: %s", profile, expected, s.dbPath)
+		}
+
+		if err = s.Close(); err != nil {
+			t.Errorf("test storage can not be closed, unexpected error: %s", err)
+		}
+	}
+
+	for _, profile := range []string{"../work", "work/db", ".hidden", "later", "later.db", "work.db", "work.db.old"} {
+		if _, err := NewProfileLocalStorage(profile, Options{}); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("invalid input error expected for profile name '%s', got: %v", profile, err)
+		}
+	}
+
+	dataHome := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dataHome)
+
+	s, err := NewProfileLocalStorage("work", Options{})
+	if err != nil {
+		t.Fatalf("storage of profile 'work' can not be created, unexpected error: %s", err)
+	}
+
+	if expected := filepath.Join(homeDir, defaultDbDir, "work.db"); s.dbPath != expected {
+		t.Errorf("expected existing ~/.later to be kept with XDG_DATA_HOME set, at %s, got: %s", expected, s.dbPath)
+	}
+
+	if err = s.Close(); err != nil {
+		t.Errorf("test storage can not be closed, unexpected error: %s", err)
+	}
+
+	if err = os.Rename(filepath.Join(homeDir, defaultDbDir), filepath.Join(dataHome, xdgDbDir)); err != nil {
+		t.Fatalf("storage directory can not be moved, unexpected error: %s", err)
+	}
+
+	if s, err = NewProfileLocalStorage("work", Options{}); err != nil {
+		t.Fatalf("storage of profile 'work' can not be created, unexpected error: %s", err)
+	}
+
+	if expected := filepath.Join(dataHome, xdgDbDir, "work.db"); s.dbPath != expected {
+		t.Errorf("expected profile database at %s with XDG_DATA_HOME set, got: %s", expected, s.dbPath)
+	}
+
+	if err = s.Close(); err != nil {
+		t.Errorf("test storage can not be closed, unexpected error: %s", err)
+	}
+
+	if _, err = os.Stat(filepath.Join(homeDir, defaultDbDir)); !os.IsNotExist(err) {
+		t.Errorf("expected ~/.later not to be created again once the data directory exists, got: %v", err)
+	}
+
+	dbPath := filepath.Join(t.TempDir(), "nested", "tasks.db")
+	s, err = NewFileLocalStorage(dbPath, Options{})
+	if err != nil {
+		t.Fatalf("storage with custom database path can not be created, unexpected error: %s", err)
+	}
+
+	if s.dbPath != dbPath {
+		t.Errorf("expected database at %s, got: %s", dbPath, s.dbPath)
+	}
+
+	if err = s.Close(); err != nil {
+		t.Errorf("test storage can not be closed, unexpected error: %s", err)
+	}
+}
+
+// TestConcurrentAccess checks that concurrent writers and readers using separate connections to the same database,
+// like shells running later at the same time, neither lose records nor fail with the locked database
+func TestConcurrentAccess(t *testing.T) {
+	const (
+		writers = 16
+		readers = 4
+		records = 25
+	)
+
+	baseDir := t.TempDir()
+	storages := make([]*LocalStorage, writers+readers)
+	for i := range storages {
+		s, err := NewCustomLocalStorage(baseDir, testDbDir, testDbName, Options{})
+		if err != nil {
+			t.Fatalf("test storage can not be opened, unexpected error: %s", err)
+		}
+		storages[i] = s
+	}
+
+	defer func() {
+		for _, s := range storages {
+			if err := s.Close(); err != nil {
+				t.Errorf("test storage can not be closed, unexpected error: %s", err)
+			}
+		}
+	}()
+
+	var mode string
+	if err := storages[0].db.Raw("PRAGMA journal_mode").Scan(&mode).Error; err != nil || mode != "wal" {
+		t.Errorf("expected write-ahead log journal mode, got: %s, error: %v", mode, err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, (writers+readers)*records)
+	for i, s := range storages {
+		wg.Add(1)
+		go func(i int, s *LocalStorage) {
+			defer wg.Done()
+			for j := 0; j < records; j++ {
+				if i >= writers {
+					if _, err := s.CountRecords(Filter{}); err != nil {
+						errs <- err
+					}
+					continue
+				}
+
+				record := &Record{Content: fmt.Sprintf("test_record_%d_%d", i, j), Tags: []Tag{{Name: "test"}}}
+				if err := s.CreateRecord(record); err != nil {
+					errs <- err
+				}
+			}
+		}(i, s)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("concurrent access failed, unexpected error: %s", err)
+	}
+
+	all, err := storages[0].GetRecords(Filter{Tag: "test"})
+	if err != nil {
+		t.Fatalf("records can not be retrieved, unexpected error: %s", err)
+	}
+
+	contents := make(map[string]bool, len(all))
+	for _, record := range all {
+		contents[record.Content] = true
+	}
+
+	if len(all) != writers*records || len(contents) != writers*records {
+		t.Errorf("expected %d distinct records, got %d records with %d distinct contents", writers*records, len(all), len(contents))
+	}
+}
+
+// TestConcurrentPop checks that concurrent pops using separate connections delete distinct records,
+// so that every successful pop deletes exactly one record
+func TestConcurrentPop(t *testing.T) {
+	const (
+		poppers = 8
+		records = 40
+	)
+
+	baseDir := t.TempDir()
+	storages := make([]*LocalStorage, poppers)
+	for i := range storages {
+		s, err := NewCustomLocalStorage(baseDir, testDbDir, testDbName, Options{})
+		if err != nil {
+			t.Fatalf("test storage can not be opened, unexpected error: %s", err)
+		}
+		storages[i] = s
+	}
+
+	defer func() {
+		for _, s := range storages {
+			if err := s.Close(); err != nil {
+				t.Errorf("test storage can not be closed, unexpected error: %s", err)
+			}
+		}
+	}()
+
+	for i := 0; i < records; i++ {
+		if err := storages[0].CreateRecord(&Record{Content: fmt.Sprintf("test_record_%d", i)}); err != nil {
+			t.Fatalf("test record can not be created, unexpected error: %s", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	popped := make(chan uint, poppers)
+	errs := make(chan error, poppers)
+	for _, s := range storages {
+		wg.Add(1)
+		go func(s *LocalStorage) {
+			defer wg.Done()
+			var count uint
+			for {
+				err := s.DeleteLastRecord()
+				if errors.Is(err, ErrEmpty) {
+					break
+				}
+				if err != nil {
+					errs <- err
+					break
+				}
+				count++
+			}
+			popped <- count
+		}(s)
+	}
+	wg.Wait()
+	close(popped)
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("concurrent pop failed, unexpected error: %s", err)
+	}
+
+	var total uint
+	for count := range popped {
+		total += count
+	}
+
+	if total != records {
+		t.Errorf("expected %d successful pops of %d records, got %d", records, records, total)
+	}
+}
+
+// TestBulkDeleteManyRecords checks that bulk deletion of more records than SQLite binds parameters in one query
+// deletes and restores all of them
+func TestBulkDeleteManyRecords(t *testing.T) {
+	const records = 33000 // above the default SQLite limit of 32766 bound parameters
+
+	s, err := createTestStorage(t)
+	if err != nil {
+		t.Fatalf("test storage can not be created, unexpected error: %s", err)
+	}
+	defer func() { _ = s.Close() }()
+
+	imported := make([]Record, records)
+	createdAt := time.Now().Add(-time.Hour)
+	for i := range imported {
+		imported[i] = Record{Content: fmt.Sprintf("test_record_%d", i), CreatedAt: createdAt}
+	}
+	if _, err = s.ImportRecords(imported, false); err != nil {
+		t.Fatalf("test records can not be imported, unexpected error: %s", err)
+	}
+
+	ids := make([]uint, records)
+	for i := range ids {
+		ids[i] = uint(i + 1)
+	}
+
+	deleted, err := s.DeleteRecords(Filter{IDs: ids})
+	if err != nil || deleted != records {
+		t.Fatalf("%d records expected to be deleted, got: %d, error: %v", records, deleted, err)
+	}
+
+	if _, err = s.Undo(); err != nil {
+		t.Fatalf("bulk delete can not be undone, unexpected error: %s", err)
+	}
+
+	if count, _ := s.CountRecords(Filter{}); count != records {
+		t.Errorf("%d records expected to be restored, got: %d", records, count)
+	}
+}
+
+// TestMigrations checks that migrations are applied on open, rolled back and applied again with backups made first
+func TestMigrations(t *testing.T) {
+	s, err := createTestStorage(t)
+	if err != nil {
+		t.Fatalf("test storage can not be created, unexpected error: %s", err)
+	}
+	defer s.Close()
+
+	migrations, err := s.Migrations()
+	if err != nil || len(migrations) != len(migrationSteps) {
+		t.Fatalf("expected %d migrations, got: %v, error: %v", len(migrationSteps), migrations, err)
+	}
+
+	for _, migration := range migrations {
+		if migration.AppliedAt == nil {
+			t.Errorf("expected migration %d to be applied on open", migration.Version)
+		}
+	}
+
+	if err = s.CreateRecord(&Record{Content: "test"}); err != nil {
+		t.Fatalf("test record can not be created, unexpected error: %s", err)
+	}
+
+	if _, _, err = s.RollbackMigrations(0); err == nil {
+		t.Errorf("expected baseline migration not to be rolled back")
+	}
+
+	reverted, backup, err := s.RollbackMigrations(1)
+	if err != nil || len(reverted) != int(latestVersion())-1 || reverted[0].Version != latestVersion() {
+		t.Fatalf("expected migrations above the baseline to be rolled back from the latest, got: %v, error: %v", reverted, err)
+	}
+
+	if s.db.Migrator().HasIndex(&Record{}, "idx_records_due_at") {
+		t.Errorf("expected index to be dropped by the rollback")
+	}
+
+	if _, err = os.Stat(backup); err != nil {
+		t.Errorf("expected backup to be made before the rollback, error: %s", err)
+	}
+
+	applied, _, err := s.Migrate()
+	if err != nil || len(applied) != len(reverted) || applied[0].Version != 2 {
+		t.Fatalf("expected migrations to be applied again, got: %v, error: %v", applied, err)
+	}
+
+	if count, _ := s.CountRecords(Filter{}); count != 1 {
+		t.Errorf("expected records to be kept by migrations, got %d", count)
+	}
+
+	if applied, _, err = s.Migrate(); err != nil || len(applied) != 0 {
+		t.Errorf("expected schema to be up to date, got: %v, error: %v", applied, err)
+	}
+
+	// migrations of a newer version are listed after the known ones in the order of versions however they are stored
+	for _, version := range []uint{latestVersion() + 3, latestVersion() + 1, latestVersion() + 2} {
+		if err = s.db.Create(&schemaMigration{Version: version, Description: "future", AppliedAt: time.Now()}).Error; err != nil {
+			t.Fatalf("test migration can not be recorded, unexpected error: %s", err)
+		}
+	}
+
+	if migrations, err = s.Migrations(); err != nil || len(migrations) != len(migrationSteps)+3 {
+		t.Fatalf("expected known and unknown migrations, got: %v, error: %v", migrations, err)
+	}
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version <= migrations[i-1].Version {
+			t.Errorf("expected migrations in the order of versions, got %d after %d", migrations[i].Version, migrations[i-1].Version)
+		}
+	}
+
+	if _, _, err = s.RollbackMigrations(1); err == nil || !strings.Contains(err.Error(), fmt.Sprint(latestVersion()+3)) {
+		t.Errorf("expected the latest unknown migration to prevent the rollback, got: %v", err)
+	}
+
+	if _, err = NewFileLocalStorage(s.dbPath, Options{}); err == nil {
+		t.Errorf("expected database with a newer schema not to be opened")
+	}
+}
+
+// TestMigrateLegacyDatabase checks that a database created before migrations keeps its records and gets missing columns
+func TestMigrateLegacyDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), testDbName)
+
+	db, err := openDb(dbPath, Options{SkipMigrations: true})
+	if err != nil {
+		t.Fatalf("legacy database can not be created, unexpected error: %s", err)
+	}
+
+	for _, statement := range []string{
+		"CREATE TABLE `records` (`id` integer,`created_at` datetime,`content` text,`done` numeric,PRIMARY KEY (`id`))",
+		"INSERT INTO `records` (`created_at`, `content`, `done`) VALUES (CURRENT_TIMESTAMP, 'legacy record', false)",
+	} {
+		if err = db.Exec(statement).Error; err != nil {
+			t.Fatalf("legacy database can not be filled, unexpected error: %s", err)
+		}
+	}
+
+	if sqlDB, err := db.DB(); err == nil {
+		_ = sqlDB.Close()
+	}
+
+	s, err := NewFileLocalStorage(dbPath, Options{})
+	if err != nil {
+		t.Fatalf("legacy database can not be opened, unexpected error: %s", err)
+	}
+	defer s.Close()
+
+	records, err := s.GetRecords(Filter{})
+	if err != nil || len(records) != 1 || records[0].Content != "legacy record" || records[0].Priority != PriorityNone {
+		t.Errorf("expected legacy record to be kept, got: %v, error: %v", records, err)
+	}
+
+	record := Record{Content: "new record", Priority: PriorityHigh, Recurrence: "FREQ=DAILY", Tags: []Tag{{Name: "tag"}}}
+	if err = s.CreateRecord(&record); err != nil {
+		t.Errorf("record can not be created in the migrated database, unexpected error: %s", err)
+	}
+
+	if err = s.MoveRecord(record.ID, "list"); err != nil {
+		t.Errorf("record can not be moved in the migrated database, unexpected error: %s", err)
+	}
+
+	backups, err := filepath.Glob(filepath.Join(filepath.Dir(dbPath), backupDir, testDbName+".*"))
+	if err != nil || len(backups) != 1 {
+		t.Errorf("expected a backup before the migration, got: %v, error: %v", backups, err)
+	}
+}
+
+// TestBackups checks that backups are made before destructive changes and on schedule, restored in place of
+// the live database and pruned
+func TestBackups(t *testing.T) {
+	s, err := createTestStorage(t)
+	if err != nil {
+		t.Fatalf("test storage can not be created, unexpected error: %s", err)
+	}
+	defer s.Close()
+
+	for _, content := range []string{"first", "second"} {
+		if err = s.CreateRecord(&Record{Content: content}); err != nil {
+			t.Fatalf("test record can not be created, unexpected error: %s", err)
+		}
+	}
+
+	if _, err = s.ImportRecords([]Record{{Content: "imported"}}, true); err != nil {
+		t.Fatalf("records can not be imported, unexpected error: %s", err)
+	}
+
+	backups, err := s.Backups()
+	if err != nil || len(backups) != 1 || backups[0].Reason != "before-import" || backups[0].Size == 0 {
+		t.Fatalf("expected a backup before the import, got: %v, error: %v", backups, err)
+	}
+
+	other, err := NewFileLocalStorage(s.Path(), Options{})
+	if err != nil {
+		t.Fatalf("database can not be opened by another connection, unexpected error: %s", err)
+	}
+	defer other.Close()
+
+	if count, _ := other.CountRecords(Filter{}); count != 1 {
+		t.Fatalf("expected another connection to see the imported record, got %d records", count)
+	}
+
+	previous, err := s.RestoreBackup(backups[0].Name)
+	if err != nil || previous.Reason != "before-restore" {
+		t.Fatalf("backup can not be restored, got: %v, error: %v", previous, err)
+	}
+
+	if records, _ := s.GetRecords(Filter{Order: OrderOldest}); len(records) != 2 || records[0].Content != "first" {
+		t.Errorf("expected records of the backup to be restored, got: %v", records)
+	}
+
+	if records, _ := other.GetRecords(Filter{Order: OrderOldest}); len(records) != 2 || records[0].Content != "first" {
+		t.Errorf("expected another connection to see the restored records without reopening, got: %v", records)
+	}
+
+	if err = other.CreateRecord(&Record{Content: "third"}); err != nil {
+		t.Fatalf("record can not be created by another connection, unexpected error: %s", err)
+	}
+
+	if count, _ := s.CountRecords(Filter{}); count != 3 {
+		t.Errorf("expected the restored database to stay shared by connections, got %d records", count)
+	}
+
+	if _, err = s.RestoreBackup("missing"); err == nil {
+		t.Errorf("expected unknown backup not to be restored")
+	}
+
+	if made, err := s.BackupIfDue(time.Hour); err != nil || made {
+		t.Errorf("expected no scheduled backup after a recent one, got: %v, error: %v", made, err)
+	}
+
+	s.options.BackupLimit = 2
+	if made, err := s.BackupIfDue(0); err != nil || !made {
+		t.Errorf("expected scheduled backup to be made, got: %v, error: %v", made, err)
+	}
+
+	if backups, err = s.Backups(); err != nil || len(backups) != 2 || backups[0].Reason != "scheduled" {
+		t.Errorf("expected the latest 2 backups to be kept, got: %v, error: %v", backups, err)
+	}
+}
+
+// TestPBKDF2 checks the key derivation against the test vector of RFC 7914 and a longer key
+func TestPBKDF2(t *testing.T) {
+	cases := []struct {
+		password, salt string
+		iterations     int
+		keyLen         int
+		expected       string
+	}{
+		{"passwd", "salt", 1, 64, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, 40, "348c89dbcbd32b2f32d814b8116e84cf2b17347ebc1800181c4e2a1fb8dd53e1c635518c7dac47e9"},
+	}
+
+	for _, c := range cases {
+		if key := fmt.Sprintf("%x", pbkdf2([]byte(c.password), []byte(c.salt), c.iterations, c.keyLen)); key != c.expected {
+			t.Errorf("expected key %s for password %s, got: %s", c.expected, c.password, key)
+		}
+	}
+}
+
+// TestEncryptedStorage checks that content, tags and lists are stored encrypted and are read, filtered and
+// searched decrypted, and that the database can be encrypted and decrypted back
+func TestEncryptedStorage(t *testing.T) {
+	s, err := createTestStorage(t)
+	if err != nil {
+		t.Fatalf("test storage can not be created, unexpected error: %s", err)
+	}
+	defer s.Close()
+
+	if err = s.CreateRecord(&Record{Content: "plain record", Tags: []Tag{{Name: "old"}}}); err != nil {
+		t.Fatalf("test record can not be created, unexpected error: %s", err)
+	}
+
+	params, err := NewEncryptionParams()
+	if err != nil {
+		t.Fatalf("encryption parameters can not be generated, unexpected error: %s", err)
+	}
+	params.Iterations = 1000
+	key := DeriveKey([]byte("secret"), params)
+
+	if params, err = s.EncryptData(key, params); err != nil {
+		t.Fatalf("database can not be encrypted, unexpected error: %s", err)
+	}
+
+	if _, err = s.EncryptData(key, params); err == nil {
+		t.Errorf("expected encrypted database not to be encrypted again")
+	}
+
+	stored, err := s.Encryption()
+	if err != nil || stored == nil || stored.Check != params.Check {
+		t.Fatalf("expected encryption parameters to be kept, got: %v, error: %v", stored, err)
+	}
+
+	if _, err = NewEncryptedStorage(s, DeriveKey([]byte("wrong"), *stored), *stored); err != ErrWrongKey {
+		t.Errorf("expected wrong key to be rejected, got: %v", err)
+	}
+
+	e, err := NewEncryptedStorage(s, key, *stored)
+	if err != nil {
+		t.Fatalf("encrypted storage can not be created, unexpected error: %s", err)
+	}
+
+	record := Record{Content: "call ACME support", Tags: []Tag{{Name: "+Work"}}, List: &List{Name: "Customers"}}
+	if err = e.CreateRecord(&record); err != nil {
+		t.Fatalf("record can not be created, unexpected error: %s", err)
+	}
+
+	var raw []string
+	s.db.Raw("SELECT content FROM records UNION ALL SELECT name FROM tags UNION ALL SELECT name FROM lists").Scan(&raw)
+	for _, value := range raw {
+		if !strings.HasPrefix(value, sealedPrefix) {
+			t.Errorf("expected only encrypted values in the database, got: %s", value)
+		}
+	}
+
+	records, err := e.GetRecords(Filter{Tag: "work", List: "customers"})
+	if err != nil || len(records) != 1 || records[0].Content != "call ACME support" || records[0].Tags[0].Name != "work" || records[0].List.Name != "customers" {
+		t.Errorf("expected decrypted record matching the tag and the list, got: %v, error: %v", records, err)
+	}
+
+	if err = e.TagRecord(record.ID, "urgent"); err != nil {
+		t.Errorf("record can not be tagged, unexpected error: %s", err)
+	}
+
+	if tags, err := e.GetTags(); err != nil || len(tags) != 3 || tags[0].Name != "old" {
+		t.Errorf("expected decrypted tags ordered by count and name, got: %v, error: %v", tags, err)
+	}
+
+	if results, err := e.SearchRecords("acme"); err != nil || len(results) != 1 || !strings.Contains(results[0].Snippet, HighlightStart+"ACME"+HighlightEnd) {
+		t.Errorf("expected record to be found by decrypted content, got: %v, error: %v", results, err)
+	}
+
+	if imported, err := e.ImportRecords([]Record{record}, false); err != nil || imported != 0 {
+		t.Errorf("expected duplicate to be skipped by the import, got: %d, error: %v", imported, err)
+	}
+
+	if err = s.DecryptData(DeriveKey([]byte("wrong"), *stored)); err != ErrWrongKey {
+		t.Errorf("expected wrong key not to decrypt the database, got: %v", err)
+	}
+
+	if err = s.DecryptData(key); err != nil {
+		t.Fatalf("database can not be decrypted, unexpected error: %s", err)
+	}
+
+	if stored, err = s.Encryption(); err != nil || stored != nil {
+		t.Errorf("expected encryption parameters to be dropped, got: %v, error: %v", stored, err)
+	}
+
+	if records, err = s.GetRecords(Filter{Tag: "work"}); err != nil || len(records) != 1 || records[0].Content != "call ACME support" {
+		t.Errorf("expected plain records after decryption, got: %v, error: %v", records, err)
+	}
+}
+
+// TestEncryptedCleanUp checks that the database cleaned up through the encrypted storage stays encrypted
+func TestEncryptedCleanUp(t *testing.T) {
+	s, err := createTestStorage(t)
+	if err != nil {
+		t.Fatalf("test storage can not be created, unexpected error: %s", err)
+	}
+	defer s.Close()
+
+	params, err := NewEncryptionParams()
+	if err != nil {
+		t.Fatalf("encryption parameters can not be generated, unexpected error: %s", err)
+	}
+	params.Iterations = 1000
+	key := DeriveKey([]byte("secret"), params)
+
+	if params, err = s.EncryptData(key, params); err != nil {
+		t.Fatalf("database can not be encrypted, unexpected error: %s", err)
+	}
+
+	e, err := NewEncryptedStorage(s, key, params)
+	if err != nil {
+		t.Fatalf("encrypted storage can not be created, unexpected error: %s", err)
+	}
+
+	if err = e.CreateRecord(&Record{Content: "customer acme"}); err != nil {
+		t.Fatalf("record can not be created, unexpected error: %s", err)
+	}
+
+	if err = e.CleanUp(); err != nil {
+		t.Fatalf("database can not be cleaned up, unexpected error: %s", err)
+	}
+
+	reopened, err := NewFileLocalStorage(s.Path(), Options{})
+	if err != nil {
+		t.Fatalf("cleaned up database can not be opened, unexpected error: %s", err)
+	}
+	defer reopened.Close()
+
+	if stored, err := reopened.Encryption(); err != nil || stored == nil || stored.Check != params.Check {
+		t.Fatalf("expected encryption parameters to be kept by the clean up, got: %v, error: %v", stored, err)
+	}
+
+	if err = e.CreateRecord(&Record{Content: "customer acme"}); err != nil {
+		t.Fatalf("record can not be created, unexpected error: %s", err)
+	}
+
+	var raw []string
+	s.db.Raw("SELECT content FROM records UNION ALL SELECT images FROM journal_entries").Scan(&raw)
+	for _, value := range raw {
+		if strings.Contains(value, "acme") {
+			t.Errorf("expected no plain values in the cleaned up database, got: %s", value)
+		}
+	}
+}
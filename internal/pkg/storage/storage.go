@@ -1,22 +1,344 @@
 package storage
 
-import "time"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
 
-// Record defines record format representation
+// Kinds of storage errors, errors returned by storages match them with errors.Is
+var (
+	ErrNotFound     = errors.New("not found")            // the record or another requested object does not exist
+	ErrEmpty        = errors.New("there are no records") // the operation needs records, but the storage has none
+	ErrInvalidInput = errors.New("invalid input")        // the arguments are rejected before the storage is changed
+)
+
+// storageError defines an error of one of the kinds with its own message
+type storageError struct {
+	kind    error
+	message string
+}
+
+func (e *storageError) Error() string {
+	return e.message
+}
+
+func (e *storageError) Unwrap() error {
+	return e.kind
+}
+
+// newError returns an error of the kind with the formatted message
+func newError(kind error, format string, args ...interface{}) error {
+	return &storageError{kind: kind, message: fmt.Sprintf(format, args...)}
+}
+
+// notFound returns the error about the missing record
+func notFound(id uint) error {
+	return newError(ErrNotFound, "record with ID %d does not exist", id)
+}
+
+// Status defines record completion status used to select records
+type Status int
+
+const (
+	StatusAny     Status = iota // both pending and completed records
+	StatusPending               // records that are not completed yet
+	StatusDone                  // completed records only
+)
+
+// Order defines sorting of selected records
+type Order int
+
+const (
+	OrderNewest   Order = iota // the most recently created records first
+	OrderDue                   // records with the closest due date first, records without due date last
+	OrderPriority              // the most important records first, then the most recently created ones
+	OrderOldest                // records in the order of their creation
+)
+
+// Priority defines record importance level
+type Priority int
+
+const (
+	PriorityNone Priority = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+)
+
+var priorityToName = map[Priority]string{
+	PriorityNone:   "none",
+	PriorityLow:    "low",
+	PriorityMedium: "medium",
+	PriorityHigh:   "high",
+}
+
+// ParsePriority converts priority level name (or its first letter) into a priority
+func ParsePriority(name string) (Priority, error) {
+	name = strings.ToLower(name)
+	for priority, priorityName := range priorityToName {
+		if name == priorityName || name == priorityName[:1] {
+			return priority, nil
+		}
+	}
+
+	return PriorityNone, newError(ErrInvalidInput, "priority '%s' is unknown, expected one of: high, medium, low, none", name)
+}
+
+// String returns priority level name
+func (p Priority) String() string {
+	if name, ok := priorityToName[p]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Priority(%d)", int(p))
+}
+
+// MarshalJSON encodes priority as its level name
+func (p Priority) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// UnmarshalJSON decodes priority from its level name or number
+func (p *Priority) UnmarshalJSON(data []byte) error {
+	var level int
+	if err := json.Unmarshal(data, &level); err == nil {
+		*p = Priority(level)
+		return nil
+	}
+
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return fmt.Errorf("priority must be a level name or number, error: %w", err)
+	}
+
+	priority, err := ParsePriority(name)
+	if err != nil {
+		return err
+	}
+	*p = priority
+
+	return nil
+}
+
+// Record defines record format representation, its columns are created by migrations:
+// a new field needs a new step in migrations.go
 type Record struct {
-	ID        uint `gorm:"primarykey"`
-	CreatedAt time.Time
-	Content   string
+	ID          uint       `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Content     string     `json:"content"`
+	Done        bool       `json:"done"`
+	UpdatedAt   *time.Time `gorm:"autoUpdateTime:false" json:"updated_at"` // set when record content or attributes are edited
+	CompletedAt *time.Time `json:"completed_at"`
+	DueAt       *time.Time `json:"due_at"`
+	Priority    Priority   `gorm:"not null;default:0" json:"priority"`
+	Tags        []Tag      `gorm:"many2many:record_tags;" json:"tags"`
+	ListID      *uint      `gorm:"index" json:"-"`
+	List        *List      `json:"list"`                   // nil if the record does not belong to any list
+	Recurrence  string     `json:"recurrence"`             // RRULE of a recurring record, e.g. "FREQ=WEEKLY;BYDAY=MO"
+	ParentID    *uint      `gorm:"index" json:"parent_id"` // nil for top-level records, set for subtasks
+	NextID      *uint      `json:"next_id"`                // the next occurrence created on completion of a recurring record
+}
+
+// copyRecord returns a copy of the record which attributes can be changed without changing the original
+func copyRecord(record Record) Record {
+	record.Tags = append([]Tag(nil), record.Tags...)
+	if record.List != nil {
+		list := *record.List
+		record.List = &list
+	}
+	record.UpdatedAt = copyTime(record.UpdatedAt)
+	record.CompletedAt = copyTime(record.CompletedAt)
+	record.DueAt = copyTime(record.DueAt)
+	if record.ListID != nil {
+		listID := *record.ListID
+		record.ListID = &listID
+	}
+	if record.ParentID != nil {
+		parentID := *record.ParentID
+		record.ParentID = &parentID
+	}
+	if record.NextID != nil {
+		nextID := *record.NextID
+		record.NextID = &nextID
+	}
+
+	return record
+}
+
+// mergeIDs returns the distinct IDs of both slices in ascending order
+func mergeIDs(ids, more []uint) []uint {
+	seen := make(map[uint]bool, len(ids)+len(more))
+	merged := make([]uint, 0, len(ids)+len(more))
+	for _, id := range append(append([]uint(nil), ids...), more...) {
+		if !seen[id] {
+			seen[id] = true
+			merged = append(merged, id)
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i] < merged[j] })
+
+	return merged
+}
+
+// copyTime returns a pointer to a copy of the time, nil for nil
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	copied := *t
+	return &copied
+}
+
+// Tag defines a label which groups records by context
+type Tag struct {
+	ID   uint   `gorm:"primarykey"`
+	Name string `gorm:"uniqueIndex;not null"`
+}
+
+// NormalizeTag converts tag name into its canonical form: lower case without the leading "+"
+func NormalizeTag(name string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "+"))
+}
+
+// MarshalJSON encodes tag as its name
+func (t Tag) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Name)
+}
+
+// UnmarshalJSON decodes tag from its name or an object with the name
+func (t *Tag) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &t.Name); err == nil {
+		return nil
+	}
+
+	var object struct{ Name string }
+	if err := json.Unmarshal(data, &object); err != nil {
+		return fmt.Errorf("tag must be a name or an object with the name, error: %w", err)
+	}
+	t.Name = object.Name
+
+	return nil
+}
+
+// List defines a named list (project) records are grouped into
+type List struct {
+	ID   uint   `gorm:"primarykey"`
+	Name string `gorm:"uniqueIndex;not null"`
+}
+
+// NormalizeList converts list name into its canonical form: lower case without surrounding spaces
+func NormalizeList(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// MarshalJSON encodes list as its name
+func (l List) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.Name)
+}
+
+// UnmarshalJSON decodes list from its name or an object with the name
+func (l *List) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &l.Name); err == nil {
+		return nil
+	}
+
+	var object struct{ Name string }
+	if err := json.Unmarshal(data, &object); err != nil {
+		return fmt.Errorf("list must be a name or an object with the name, error: %w", err)
+	}
+	l.Name = object.Name
+
+	return nil
+}
+
+// ListCount defines a list with the number of its records, records without a list are counted under the empty name
+type ListCount struct {
+	Name  string `json:"name"`
+	Count uint   `json:"count"`
+}
+
+// TagCount defines a tag with the number of records labeled by it
+type TagCount struct {
+	Name  string `json:"name"`
+	Count uint   `json:"count"`
+}
+
+// Progress defines the number of completed and all subtasks of a record
+type Progress struct {
+	Done  uint `json:"done"`
+	Total uint `json:"total"`
+}
+
+// SearchResult defines a record matching a search query with a fragment of its content,
+// where matched terms are enclosed in HighlightStart and HighlightEnd markers
+type SearchResult struct {
+	Record  Record `json:"record"`
+	Snippet string `json:"snippet"`
+}
+
+// Options defines how a storage is opened, zero value opens it as usual
+type Options struct {
+	// SkipMigrations leaves pending schema migrations of the database unapplied, so that the schema can be inspected
+	// and rolled back with the migration methods
+	SkipMigrations bool
+	// BackupLimit defines the number of the latest backups kept, older backups are deleted when a new one is made;
+	// zero keeps the default number
+	BackupLimit int
+}
+
+// backupLimit returns the number of the latest backups kept
+func (o Options) backupLimit() int {
+	if o.BackupLimit <= 0 {
+		return defaultBackupLimit
+	}
+
+	return o.BackupLimit
+}
+
+// Filter defines criteria to select records, zero value selects all records
+type Filter struct {
+	Status        Status
+	IDs           []uint    // when set, selects only records with the IDs
+	DueBefore     time.Time // when set, selects only records due before the moment
+	CreatedBefore time.Time // when set, selects only records created before the moment
+	Tag           string    // when set, selects only records labeled by the tag
+	List          string    // when set, selects only records of the list
+	Order         Order
 }
 
 // Storage defines common interface for records management
 type Storage interface {
-	CreateRecord(content string) error
-	GetRecordByID(id uint) (string, error)
-	GetRecords() ([]Record, error)
-	CountRecords() (uint, error)
+	CreateRecord(record *Record) error
+	GetRecordByID(id uint) (Record, error)
+	GetRecords(filter Filter) ([]Record, error)
+	CountRecords(filter Filter) (uint, error)
+	UpdateRecord(record *Record) error
+	SaveRecord(record *Record) error
+	MarkRecordDone(id uint, done bool) error
+	SetRecordPriority(id uint, priority Priority) error
+	TagRecord(id uint, tag string) error
+	UntagRecord(id uint, tag string) error
+	GetTags() ([]TagCount, error)
+	MoveRecord(id uint, list string) error
+	GetLists(filter Filter) ([]ListCount, error)
+	GetProgress(ids []uint) (map[uint]Progress, error)
+	SearchRecords(query string) ([]SearchResult, error)
+	ImportRecords(records []Record, replace bool) (uint, error)
 	DeleteRecordByID(id uint) error
+	DeleteRecords(filter Filter) (uint, error)
 	DeleteLastRecord() error
+	Undo() (string, error)
+	Redo() (string, error)
+	Migrations() ([]Migration, error)
+	Migrate() ([]Migration, string, error)
+	RollbackMigrations(version uint) ([]Migration, string, error)
+	Backups() ([]Backup, error)
+	RestoreBackup(name string) (Backup, error)
 	Close() error
 	CleanUp() error
 }
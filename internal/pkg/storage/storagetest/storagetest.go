@@ -0,0 +1,969 @@
+// Package storagetest checks that implementations of storage.Storage behave like the SQLite storage,
+// so that alternative backends and wrappers over them are validated identically
+package storagetest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/manmolecular/go-later/internal/pkg/storage"
+)
+
+// Opener returns an empty storage for a test, the storage is closed by the suite
+type Opener func(t *testing.T) storage.Storage
+
+// cases defines behavior every storage must follow
+var cases = []struct {
+	name  string
+	check func(t *testing.T, s storage.Storage)
+}{
+	{"records", testRecords},
+	{"status", testStatus},
+	{"save", testSave},
+	{"tags", testTags},
+	{"lists", testLists},
+	{"order", testOrder},
+	{"search", testSearch},
+	{"import", testImport},
+	{"undo redo", testUndoRedo},
+	{"bulk delete", testBulkDelete},
+	{"missing records", testMissingRecords},
+	{"empty storage", testEmptyStorage},
+	{"unicode content", testUnicodeContent},
+	{"large content", testLargeContent},
+	{"concurrent writers", testConcurrentWriters},
+	{"migrations", testMigrations},
+	{"backups", testBackups},
+	{"clean up", testCleanUp},
+}
+
+// Run runs the suite against storages returned by the opener, each case gets a new empty storage
+func Run(t *testing.T, open Opener) {
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			s := open(t)
+			defer func() {
+				if err := s.Close(); err != nil {
+					t.Errorf("storage can not be closed, unexpected error: %s", err)
+				}
+			}()
+
+			c.check(t, s)
+		})
+	}
+}
+
+// mustCreate creates records with the given contents and returns their IDs
+func mustCreate(t *testing.T, s storage.Storage, records ...storage.Record) []uint {
+	t.Helper()
+
+	ids := make([]uint, 0, len(records))
+	for i := range records {
+		if err := s.CreateRecord(&records[i]); err != nil {
+			t.Fatalf("record %q can not be created, unexpected error: %s", records[i].Content, err)
+		}
+		ids = append(ids, records[i].ID)
+	}
+
+	return ids
+}
+
+// recordIDs returns IDs of the records in their order
+func recordIDs(t *testing.T, s storage.Storage, filter storage.Filter) []uint {
+	t.Helper()
+
+	records, err := s.GetRecords(filter)
+	if err != nil {
+		t.Fatalf("records can not be retrieved, unexpected error: %s", err)
+	}
+
+	ids := make([]uint, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+
+	return ids
+}
+
+// testRecords checks creation, retrieval, update, priority and deletion of records
+func testRecords(t *testing.T, s storage.Storage) {
+	dueAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	record := storage.Record{Content: "buy milk", DueAt: &dueAt, Priority: storage.PriorityHigh}
+	if err := s.CreateRecord(&record); err != nil {
+		t.Fatalf("record can not be created, unexpected error: %s", err)
+	}
+
+	if record.ID == 0 || record.CreatedAt.IsZero() {
+		t.Fatalf("ID and creation time expected to be set, got: %d, %s", record.ID, record.CreatedAt)
+	}
+
+	stored, err := s.GetRecordByID(record.ID)
+	if err != nil {
+		t.Fatalf("record can not be retrieved, unexpected error: %s", err)
+	}
+
+	if stored.Content != "buy milk" || stored.Priority != storage.PriorityHigh || stored.DueAt == nil || !stored.DueAt.Equal(dueAt) {
+		t.Errorf("stored record differs from the created one, got: %+v", stored)
+	}
+
+	stored.Content = "buy oat milk"
+	stored.DueAt = nil
+	if err = s.UpdateRecord(&stored); err != nil {
+		t.Fatalf("record can not be updated, unexpected error: %s", err)
+	}
+
+	if updated, _ := s.GetRecordByID(record.ID); updated.Content != "buy oat milk" || updated.DueAt != nil || updated.UpdatedAt == nil {
+		t.Errorf("record expected to be updated, got: %+v", updated)
+	}
+
+	if err = s.UpdateRecord(&storage.Record{ID: record.ID + 100, Content: "missing"}); err == nil {
+		t.Errorf("missing record can not be updated, error expected")
+	}
+
+	if err = s.SetRecordPriority(record.ID, storage.PriorityLow); err != nil {
+		t.Fatalf("record priority can not be set, unexpected error: %s", err)
+	}
+
+	if prioritized, _ := s.GetRecordByID(record.ID); prioritized.Priority != storage.PriorityLow {
+		t.Errorf("low priority expected, got: %s", prioritized.Priority)
+	}
+
+	if err = s.CreateRecord(&storage.Record{Content: "orphan", ParentID: &[]uint{record.ID + 100}[0]}); !errors.Is(err, storage.ErrInvalidInput) {
+		t.Errorf("subtask of a missing record can not be created, invalid input error expected, got: %v", err)
+	}
+
+	invalid := storage.Record{Content: "broken", Recurrence: "garbage"}
+	if err = s.CreateRecord(&invalid); !errors.Is(err, storage.ErrInvalidInput) {
+		t.Errorf("record with an invalid recurrence can not be created, invalid input error expected, got: %v", err)
+	}
+
+	if _, err = s.ImportRecords([]storage.Record{invalid}, false); !errors.Is(err, storage.ErrInvalidInput) {
+		t.Errorf("record with an invalid recurrence can not be imported, invalid input error expected, got: %v", err)
+	}
+
+	stored.Recurrence = "garbage"
+	if err = s.UpdateRecord(&stored); !errors.Is(err, storage.ErrInvalidInput) {
+		t.Errorf("record can not be updated with an invalid recurrence, invalid input error expected, got: %v", err)
+	}
+
+	ids := mustCreate(t, s, storage.Record{Content: "second"}, storage.Record{Content: "third"})
+	if err = s.DeleteLastRecord(); err != nil {
+		t.Fatalf("last record can not be deleted, unexpected error: %s", err)
+	}
+
+	if got := recordIDs(t, s, storage.Filter{Order: storage.OrderOldest}); !reflect.DeepEqual(got, []uint{record.ID, ids[0]}) {
+		t.Errorf("only the latest record expected to be deleted, got: %v", got)
+	}
+
+	if err = s.DeleteRecordByID(record.ID); err != nil {
+		t.Fatalf("record can not be deleted, unexpected error: %s", err)
+	}
+
+	if _, err = s.GetRecordByID(record.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("deleted record can not be retrieved, not found error expected, got: %v", err)
+	}
+
+	if count, _ := s.CountRecords(storage.Filter{}); count != 1 {
+		t.Errorf("exactly 1 record expected, got: %d", count)
+	}
+}
+
+// testStatus checks completion of records with their subtasks, progress and recurring records
+func testStatus(t *testing.T, s storage.Storage) {
+	dueAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	ids := mustCreate(t, s, storage.Record{Content: "parent"}, storage.Record{Content: "weekly", DueAt: &dueAt, Recurrence: "FREQ=WEEKLY"})
+	subtasks := mustCreate(t, s, storage.Record{Content: "first step", ParentID: &ids[0]}, storage.Record{Content: "second step", ParentID: &ids[0]})
+	mustCreate(t, s, storage.Record{Content: "nested step", ParentID: &subtasks[1]})
+
+	if err := s.MarkRecordDone(subtasks[0], true); err != nil {
+		t.Fatalf("subtask can not be completed, unexpected error: %s", err)
+	}
+
+	progress, err := s.GetProgress(ids)
+	if err != nil {
+		t.Fatalf("progress can not be retrieved, unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(progress, map[uint]storage.Progress{ids[0]: {Done: 1, Total: 2}}) {
+		t.Errorf("1 of 2 direct subtasks expected to be done, got: %v", progress)
+	}
+
+	if err = s.MarkRecordDone(ids[0], true); err != nil {
+		t.Fatalf("record can not be completed, unexpected error: %s", err)
+	}
+
+	if count, _ := s.CountRecords(storage.Filter{Status: storage.StatusPending}); count != 1 {
+		t.Errorf("only the recurring record expected to be pending, got: %d", count)
+	}
+
+	if err = s.MarkRecordDone(ids[1], true); err != nil {
+		t.Fatalf("recurring record can not be completed, unexpected error: %s", err)
+	}
+
+	pending, err := s.GetRecords(storage.Filter{Status: storage.StatusPending})
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("the next occurrence expected to be pending, got: %v, error: %v", pending, err)
+	}
+
+	if next := pending[0]; next.Content != "weekly" || next.DueAt == nil || !next.DueAt.After(time.Now()) {
+		t.Errorf("the next occurrence expected to be due in the future, got: %+v", next)
+	}
+
+	if err = s.MarkRecordDone(ids[1], false); err != nil {
+		t.Fatalf("recurring record can not be reopened, unexpected error: %s", err)
+	}
+
+	if err = s.MarkRecordDone(ids[1], true); err != nil {
+		t.Fatalf("recurring record can not be completed again, unexpected error: %s", err)
+	}
+
+	if got := recordIDs(t, s, storage.Filter{Status: storage.StatusPending}); !reflect.DeepEqual(got, []uint{pending[0].ID}) {
+		t.Errorf("only the first next occurrence %d expected to be pending after completing again, got: %v", pending[0].ID, got)
+	}
+
+	if err = s.MarkRecordDone(ids[0], false); err != nil {
+		t.Fatalf("record can not be reopened, unexpected error: %s", err)
+	}
+
+	reopened, _ := s.GetRecordByID(ids[0])
+	if reopened.Done || reopened.CompletedAt != nil {
+		t.Errorf("record expected to be pending, got: %+v", reopened)
+	}
+
+	if count, _ := s.CountRecords(storage.Filter{Status: storage.StatusDone}); count != 4 {
+		t.Errorf("subtasks and the recurring record expected to stay done, got: %d", count)
+	}
+
+	if err = s.MarkRecordDone(ids[0]+100, true); err == nil {
+		t.Errorf("missing record can not be completed, error expected")
+	}
+
+	if err = s.DeleteRecordByID(ids[0]); err != nil {
+		t.Fatalf("record can not be deleted, unexpected error: %s", err)
+	}
+
+	if count, _ := s.CountRecords(storage.Filter{}); count != 2 {
+		t.Errorf("subtasks expected to be deleted with the parent, got %d records", count)
+	}
+}
+
+// testSave checks that changes of several record attributes are saved and undone as one operation, and that
+// invalid changes leave the record intact
+func testSave(t *testing.T, s storage.Storage) {
+	ids := mustCreate(t, s, storage.Record{Content: "parent", Tags: []storage.Tag{{Name: "home"}}})
+	subtasks := mustCreate(t, s, storage.Record{Content: "subtask", ParentID: &ids[0]})
+
+	record, err := s.GetRecordByID(ids[0])
+	if err != nil {
+		t.Fatalf("record can not be retrieved, unexpected error: %s", err)
+	}
+
+	record.Content, record.Priority, record.Done = "changed", storage.PriorityHigh, true
+	record.Tags, record.List = []storage.Tag{{Name: "work"}}, &storage.List{Name: "chores"}
+	if err = s.SaveRecord(&record); err != nil {
+		t.Fatalf("record can not be saved, unexpected error: %s", err)
+	}
+
+	saved, err := s.GetRecordByID(ids[0])
+	if err != nil {
+		t.Fatalf("saved record can not be retrieved, unexpected error: %s", err)
+	}
+
+	if saved.Content != "changed" || saved.Priority != storage.PriorityHigh || !saved.Done || len(saved.Tags) != 1 ||
+		saved.Tags[0].Name != "work" || saved.List == nil || saved.List.Name != "chores" {
+		t.Errorf("all the changed attributes expected to be saved, got: %+v", saved)
+	}
+
+	if count, _ := s.CountRecords(storage.Filter{Status: storage.StatusPending}); count != 0 {
+		t.Errorf("subtask expected to be completed with the saved record, got %d pending records", count)
+	}
+
+	description, err := s.Undo()
+	if expected := fmt.Sprintf("update records %d, %d", ids[0], subtasks[0]); err != nil || description != expected {
+		t.Fatalf("save expected to be undone at once as %q, got: %q, error: %v", expected, description, err)
+	}
+
+	restored, err := s.GetRecordByID(ids[0])
+	if err != nil {
+		t.Fatalf("restored record can not be retrieved, unexpected error: %s", err)
+	}
+
+	if restored.Content != "parent" || restored.Done || len(restored.Tags) != 1 || restored.Tags[0].Name != "home" || restored.List != nil {
+		t.Errorf("all the attributes expected to be restored, got: %+v", restored)
+	}
+
+	restored.Content, restored.Recurrence = "invalid", "garbage"
+	if err = s.SaveRecord(&restored); !errors.Is(err, storage.ErrInvalidInput) {
+		t.Errorf("record with an invalid recurrence can not be saved, invalid input error expected, got: %v", err)
+	}
+
+	if err = s.SaveRecord(&storage.Record{ID: ids[0] + 100, Content: "missing"}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("missing record can not be saved, not found error expected, got: %v", err)
+	}
+
+	if kept, _ := s.GetRecordByID(ids[0]); kept.Content != "parent" {
+		t.Errorf("failed saves expected to leave the record intact, got: %+v", kept)
+	}
+}
+
+// testTags checks tagging of records with normalized tag names and counting of tags
+func testTags(t *testing.T, s storage.Storage) {
+	ids := mustCreate(t, s,
+		storage.Record{Content: "first", Tags: []storage.Tag{{Name: "+Home"}, {Name: "errand"}}},
+		storage.Record{Content: "second", Tags: []storage.Tag{{Name: "home"}}},
+		storage.Record{Content: "third"},
+	)
+
+	if err := s.CreateRecord(&storage.Record{Content: "invalid", Tags: []storage.Tag{{Name: "+"}}}); !errors.Is(err, storage.ErrInvalidInput) {
+		t.Errorf("record with an empty tag can not be created, invalid input error expected, got: %v", err)
+	}
+
+	if err := s.TagRecord(ids[2], "Work"); err != nil {
+		t.Fatalf("record can not be tagged, unexpected error: %s", err)
+	}
+
+	if err := s.TagRecord(ids[2]+100, "work"); err == nil {
+		t.Errorf("missing record can not be tagged, error expected")
+	}
+
+	if err := s.UntagRecord(ids[0], "errand"); err != nil {
+		t.Fatalf("record can not be untagged, unexpected error: %s", err)
+	}
+
+	if err := s.UntagRecord(ids[0], "errand"); err == nil {
+		t.Errorf("record can not be untagged twice, error expected")
+	}
+
+	tags, err := s.GetTags()
+	if err != nil {
+		t.Fatalf("tags can not be retrieved, unexpected error: %s", err)
+	}
+
+	expected := []storage.TagCount{{Name: "home", Count: 2}, {Name: "work", Count: 1}}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("tags expected: %v, got: %v", expected, tags)
+	}
+
+	if got := recordIDs(t, s, storage.Filter{Tag: "+HOME", Order: storage.OrderOldest}); !reflect.DeepEqual(got, ids[:2]) {
+		t.Errorf("records tagged with home expected: %v, got: %v", ids[:2], got)
+	}
+
+	if record, _ := s.GetRecordByID(ids[2]); len(record.Tags) != 1 || record.Tags[0].Name != "work" {
+		t.Errorf("record expected to be tagged with work, got: %v", record.Tags)
+	}
+}
+
+// testLists checks moving records between lists and counting records of lists
+func testLists(t *testing.T, s storage.Storage) {
+	ids := mustCreate(t, s,
+		storage.Record{Content: "first", List: &storage.List{Name: " Home "}},
+		storage.Record{Content: "second", List: &storage.List{Name: "work"}},
+		storage.Record{Content: "third"},
+	)
+
+	if record, _ := s.GetRecordByID(ids[0]); record.List == nil || record.List.Name != "home" {
+		t.Errorf("record expected to be in the home list, got: %v", record.List)
+	}
+
+	if err := s.MoveRecord(ids[1], "Home"); err != nil {
+		t.Fatalf("record can not be moved, unexpected error: %s", err)
+	}
+
+	if err := s.MoveRecord(ids[0], ""); err != nil {
+		t.Fatalf("record can not be removed from its list, unexpected error: %s", err)
+	}
+
+	if err := s.MoveRecord(ids[0]+100, "home"); err == nil {
+		t.Errorf("missing record can not be moved, error expected")
+	}
+
+	lists, err := s.GetLists(storage.Filter{})
+	if err != nil {
+		t.Fatalf("lists can not be retrieved, unexpected error: %s", err)
+	}
+
+	expected := []storage.ListCount{{Count: 2}, {Name: "home", Count: 1}, {Name: "work"}}
+	if !reflect.DeepEqual(lists, expected) {
+		t.Errorf("lists expected: %v, got: %v", expected, lists)
+	}
+
+	if got := recordIDs(t, s, storage.Filter{List: "HOME"}); !reflect.DeepEqual(got, ids[1:2]) {
+		t.Errorf("records of the home list expected: %v, got: %v", ids[1:2], got)
+	}
+
+	if err = s.MarkRecordDone(ids[2], true); err != nil {
+		t.Fatalf("record can not be completed, unexpected error: %s", err)
+	}
+
+	lists, _ = s.GetLists(storage.Filter{Status: storage.StatusPending})
+	expected = []storage.ListCount{{Count: 1}, {Name: "home", Count: 1}, {Name: "work"}}
+	if !reflect.DeepEqual(lists, expected) {
+		t.Errorf("lists of pending records expected: %v, got: %v", expected, lists)
+	}
+}
+
+// testOrder checks sort orders and selection by the due date
+func testOrder(t *testing.T, s storage.Storage) {
+	now := time.Now().Truncate(time.Second)
+	soon, later := now.Add(time.Hour), now.Add(2*time.Hour)
+	ids := mustCreate(t, s,
+		storage.Record{Content: "later", DueAt: &later, Priority: storage.PriorityLow},
+		storage.Record{Content: "undated", Priority: storage.PriorityHigh},
+		storage.Record{Content: "soon", DueAt: &soon},
+		storage.Record{Content: "also soon", DueAt: &soon, Priority: storage.PriorityHigh},
+	)
+
+	orders := map[storage.Order][]uint{
+		storage.OrderNewest:   {ids[3], ids[2], ids[1], ids[0]},
+		storage.OrderOldest:   {ids[0], ids[1], ids[2], ids[3]},
+		storage.OrderDue:      {ids[3], ids[2], ids[0], ids[1]},
+		storage.OrderPriority: {ids[3], ids[1], ids[0], ids[2]},
+	}
+	for order, expected := range orders {
+		if got := recordIDs(t, s, storage.Filter{Order: order}); !reflect.DeepEqual(got, expected) {
+			t.Errorf("order %d expected: %v, got: %v", order, expected, got)
+		}
+	}
+
+	if got := recordIDs(t, s, storage.Filter{DueBefore: later, Order: storage.OrderOldest}); !reflect.DeepEqual(got, ids[2:]) {
+		t.Errorf("records due before the moment expected: %v, got: %v", ids[2:], got)
+	}
+}
+
+// testSearch checks that search matches records containing all the terms and highlights them
+func testSearch(t *testing.T, s storage.Storage) {
+	ids := mustCreate(t, s, storage.Record{Content: "Buy milk and bread"}, storage.Record{Content: "call mom"})
+
+	results, err := s.SearchRecords("milk bread")
+	if err != nil {
+		t.Fatalf("records can not be searched, unexpected error: %s", err)
+	}
+
+	if len(results) != 1 || results[0].Record.ID != ids[0] {
+		t.Fatalf("exactly the first record expected to match, got: %v", results)
+	}
+
+	if !strings.Contains(results[0].Snippet, storage.HighlightStart+"milk"+storage.HighlightEnd) {
+		t.Errorf("matched term expected to be highlighted, got: %q", results[0].Snippet)
+	}
+
+	if results, _ = s.SearchRecords("milk mom"); len(results) != 0 {
+		t.Errorf("records containing all the terms expected only, got: %v", results)
+	}
+}
+
+// testImport checks import with skipped duplicates, relinked subtasks and the replace mode
+func testImport(t *testing.T, s storage.Storage) {
+	createdAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	mustCreate(t, s, storage.Record{Content: "existing", CreatedAt: createdAt})
+
+	parentID := uint(10)
+	records := []storage.Record{
+		{ID: 11, Content: "subtask", CreatedAt: createdAt, ParentID: &parentID, Tags: []storage.Tag{{Name: "work"}}},
+		{ID: 10, Content: "parent", CreatedAt: createdAt, Done: true, List: &storage.List{Name: "home"}},
+		{ID: 12, Content: "existing", CreatedAt: createdAt},
+	}
+
+	imported, err := s.ImportRecords(records, false)
+	if err != nil {
+		t.Fatalf("records can not be imported, unexpected error: %s", err)
+	}
+
+	if imported != 2 {
+		t.Errorf("the duplicate expected to be skipped, got %d imported records", imported)
+	}
+
+	stored, err := s.GetRecords(storage.Filter{Order: storage.OrderOldest})
+	if err != nil || len(stored) != 3 {
+		t.Fatalf("exactly 3 records expected, got: %v, error: %v", stored, err)
+	}
+
+	subtask, parent := stored[1], stored[2]
+	if subtask.ParentID == nil || *subtask.ParentID != parent.ID {
+		t.Errorf("subtask expected to be linked to the imported parent %d, got: %v", parent.ID, subtask.ParentID)
+	}
+
+	if !parent.Done || parent.List == nil || parent.List.Name != "home" || !parent.CreatedAt.Equal(createdAt) {
+		t.Errorf("imported record attributes expected to be kept, got: %+v", parent)
+	}
+
+	if imported, err = s.ImportRecords(records[1:2], true); err != nil || imported != 1 {
+		t.Fatalf("records can not be imported in replace mode, got: %d, error: %v", imported, err)
+	}
+
+	if count, _ := s.CountRecords(storage.Filter{}); count != 1 {
+		t.Errorf("existing records expected to be replaced, got %d records", count)
+	}
+
+	// the parent imported after its subtask is the latest record, so it is deleted together with the subtask
+	if imported, err = s.ImportRecords(records[:2], true); err != nil || imported != 2 {
+		t.Fatalf("records can not be imported in replace mode, got: %d, error: %v", imported, err)
+	}
+
+	if err = s.DeleteLastRecord(); err != nil {
+		t.Fatalf("last record can not be deleted, unexpected error: %s", err)
+	}
+
+	if count, _ := s.CountRecords(storage.Filter{}); count != 0 {
+		t.Errorf("subtask expected to be deleted with the latest record, got %d records", count)
+	}
+}
+
+// testUndoRedo checks that operations are reverted and applied again with their descriptions
+func testUndoRedo(t *testing.T, s storage.Storage) {
+	if _, err := s.Redo(); err == nil {
+		t.Errorf("nothing can be redone in the new storage, error expected")
+	}
+
+	ids := mustCreate(t, s, storage.Record{Content: "parent", Tags: []storage.Tag{{Name: "home"}}, List: &storage.List{Name: "chores"}})
+	mustCreate(t, s, storage.Record{Content: "subtask", ParentID: &ids[0]})
+
+	if err := s.DeleteRecordByID(ids[0]); err != nil {
+		t.Fatalf("record can not be deleted, unexpected error: %s", err)
+	}
+
+	description, err := s.Undo()
+	if err != nil {
+		t.Fatalf("delete can not be undone, unexpected error: %s", err)
+	}
+
+	if expected := fmt.Sprintf("delete records %d, %d", ids[0], ids[0]+1); description != expected {
+		t.Errorf("description expected: %q, got: %q", expected, description)
+	}
+
+	restored, err := s.GetRecordByID(ids[0])
+	if err != nil {
+		t.Fatalf("deleted record expected to be restored, unexpected error: %s", err)
+	}
+
+	if len(restored.Tags) != 1 || restored.Tags[0].Name != "home" || restored.List == nil || restored.List.Name != "chores" {
+		t.Errorf("restored record expected to keep its tags and list, got: %+v", restored)
+	}
+
+	if count, _ := s.CountRecords(storage.Filter{}); count != 2 {
+		t.Errorf("subtask expected to be restored with the parent, got %d records", count)
+	}
+
+	if description, err = s.Redo(); err != nil || description != fmt.Sprintf("delete records %d, %d", ids[0], ids[0]+1) {
+		t.Fatalf("delete can not be redone, got: %q, error: %v", description, err)
+	}
+
+	if count, _ := s.CountRecords(storage.Filter{}); count != 0 {
+		t.Errorf("records expected to be deleted again, got %d records", count)
+	}
+
+	for _, expected := range []string{"delete records 1, 2", "create record 2", "create record 1"} {
+		if description, err = s.Undo(); err != nil || description != expected {
+			t.Errorf("undo of %q expected, got: %q, error: %v", expected, description, err)
+		}
+	}
+
+	if _, err = s.Undo(); err == nil {
+		t.Errorf("nothing can be undone in the storage with the exhausted journal, error expected")
+	}
+
+	if description, err = s.Redo(); err != nil || description != "create record 1" {
+		t.Fatalf("create can not be redone, got: %q, error: %v", description, err)
+	}
+
+	mustCreate(t, s, storage.Record{Content: "new"})
+	if _, err = s.Redo(); err == nil {
+		t.Errorf("reverted operations expected to be discarded by a new one, error expected")
+	}
+}
+
+// testBulkDelete checks that records selected by IDs and filters are deleted with their subtasks as one change
+func testBulkDelete(t *testing.T, s storage.Storage) {
+	old := time.Now().AddDate(0, 0, -60).Truncate(time.Second)
+	done := []storage.Tag{{Name: "done"}}
+	ids := mustCreate(t, s,
+		storage.Record{Content: "old tagged", Tags: done, CreatedAt: old},
+		storage.Record{Content: "new tagged", Tags: done},
+		storage.Record{Content: "old untagged", CreatedAt: old},
+		storage.Record{Content: "parent"},
+	)
+	subtasks := mustCreate(t, s, storage.Record{Content: "subtask", ParentID: &ids[3]})
+
+	if deleted, err := s.DeleteRecords(storage.Filter{Tag: "missing"}); err != nil || deleted != 0 {
+		t.Errorf("nothing expected to be deleted by the filter matching no records, got: %d, error: %v", deleted, err)
+	}
+
+	if description, err := s.Undo(); err != nil || description != fmt.Sprintf("create record %d", subtasks[0]) {
+		t.Errorf("deletion of no records expected not to be journaled, got: %q, error: %v", description, err)
+	}
+
+	if _, err := s.Redo(); err != nil {
+		t.Fatalf("create can not be redone, unexpected error: %s", err)
+	}
+
+	deleted, err := s.DeleteRecords(storage.Filter{Tag: "done", CreatedBefore: time.Now().AddDate(0, 0, -30)})
+	if err != nil || deleted != 1 {
+		t.Fatalf("exactly 1 old tagged record expected to be deleted, got: %d, error: %v", deleted, err)
+	}
+
+	if got := recordIDs(t, s, storage.Filter{Order: storage.OrderOldest}); !reflect.DeepEqual(got, append(ids[1:], subtasks...)) {
+		t.Errorf("records %v expected to be left, got: %v", append(ids[1:], subtasks...), got)
+	}
+
+	if deleted, err = s.DeleteRecords(storage.Filter{IDs: []uint{ids[2], ids[3], 1000}}); err != nil || deleted != 3 {
+		t.Fatalf("2 records and the subtask expected to be deleted, got: %d, error: %v", deleted, err)
+	}
+
+	if got := recordIDs(t, s, storage.Filter{}); !reflect.DeepEqual(got, ids[1:2]) {
+		t.Errorf("records %v expected to be left, got: %v", ids[1:2], got)
+	}
+
+	description, err := s.Undo()
+	if expected := fmt.Sprintf("delete records %d, %d, %d", ids[2], ids[3], subtasks[0]); err != nil || description != expected {
+		t.Fatalf("bulk delete expected to be undone at once as %q, got: %q, error: %v", expected, description, err)
+	}
+
+	if count, _ := s.CountRecords(storage.Filter{}); count != 4 {
+		t.Errorf("all the deleted records expected to be restored, got %d records", count)
+	}
+
+	if deleted, err = s.DeleteRecords(storage.Filter{}); err != nil || deleted != 4 {
+		t.Errorf("zero filter expected to delete all the records, got: %d, error: %v", deleted, err)
+	}
+}
+
+// testMissingRecords checks that operations with missing records fail and leave the storage intact
+func testMissingRecords(t *testing.T, s storage.Storage) {
+	ids := mustCreate(t, s, storage.Record{Content: "existing", Tags: []storage.Tag{{Name: "home"}}})
+	missing := ids[0] + 100
+
+	if _, err := s.GetRecordByID(missing); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("missing record can not be retrieved, not found error expected, got: %v", err)
+	}
+
+	failures := map[string]error{
+		"update":     s.UpdateRecord(&storage.Record{ID: missing, Content: "missing"}),
+		"complete":   s.MarkRecordDone(missing, true),
+		"reopen":     s.MarkRecordDone(missing, false),
+		"prioritize": s.SetRecordPriority(missing, storage.PriorityHigh),
+		"tag":        s.TagRecord(missing, "work"),
+		"untag":      s.UntagRecord(missing, "home"),
+		"move":       s.MoveRecord(missing, "work"),
+	}
+	for action, err := range failures {
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("%s of a missing record expected to fail with the not found error, got: %v", action, err)
+		}
+	}
+
+	if description, err := s.Undo(); err != nil || description != fmt.Sprintf("create record %d", ids[0]) {
+		t.Errorf("failed operations expected to stay out of the journal, got: %q, error: %v", description, err)
+	}
+
+	if _, err := s.Redo(); err != nil {
+		t.Fatalf("record can not be created again, unexpected error: %s", err)
+	}
+
+	if err := s.DeleteRecordByID(missing); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("missing record can not be deleted, not found error expected, got: %v", err)
+	}
+	if got := recordIDs(t, s, storage.Filter{}); !reflect.DeepEqual(got, ids) {
+		t.Errorf("existing records expected to be kept, got: %v", got)
+	}
+
+	progress, err := s.GetProgress([]uint{missing})
+	if err != nil || len(progress) != 0 {
+		t.Errorf("no progress expected for a missing record, got: %v, error: %v", progress, err)
+	}
+
+	if tags, _ := s.GetTags(); !reflect.DeepEqual(tags, []storage.TagCount{{Name: "home", Count: 1}}) {
+		t.Errorf("failed operations expected to leave tags intact, got: %v", tags)
+	}
+
+	if lists, _ := s.GetLists(storage.Filter{}); !reflect.DeepEqual(lists, []storage.ListCount{{Count: 1}}) {
+		t.Errorf("failed operations expected to leave no lists behind, got: %v", lists)
+	}
+}
+
+// testEmptyStorage checks reading from and deleting in the empty storage
+func testEmptyStorage(t *testing.T, s storage.Storage) {
+	if records, err := s.GetRecords(storage.Filter{}); err != nil || len(records) != 0 {
+		t.Errorf("no records expected, got: %v, error: %v", records, err)
+	}
+
+	if count, err := s.CountRecords(storage.Filter{}); err != nil || count != 0 {
+		t.Errorf("zero records expected, got: %d, error: %v", count, err)
+	}
+
+	if tags, err := s.GetTags(); err != nil || len(tags) != 0 {
+		t.Errorf("no tags expected, got: %v, error: %v", tags, err)
+	}
+
+	if lists, err := s.GetLists(storage.Filter{}); err != nil || len(lists) != 0 {
+		t.Errorf("no lists expected, got: %v, error: %v", lists, err)
+	}
+
+	if progress, err := s.GetProgress(nil); err != nil || len(progress) != 0 {
+		t.Errorf("no progress expected, got: %v, error: %v", progress, err)
+	}
+
+	if err := s.DeleteLastRecord(); !errors.Is(err, storage.ErrEmpty) {
+		t.Errorf("last record can not be deleted from the empty storage, empty error expected, got: %v", err)
+	}
+	if count, _ := s.CountRecords(storage.Filter{}); count != 0 {
+		t.Errorf("storage expected to stay empty, got %d records", count)
+	}
+
+	if imported, err := s.ImportRecords(nil, false); err != nil || imported != 0 {
+		t.Errorf("nothing expected to be imported, got: %d, error: %v", imported, err)
+	}
+}
+
+// testUnicodeContent checks that non-ASCII content, tags and lists are kept, selected and searched
+func testUnicodeContent(t *testing.T, s storage.Storage) {
+	content := "Купить молоко 🥛 и 日本語のノート"
+	ids := mustCreate(t, s, storage.Record{
+		Content: content,
+		Tags:    []storage.Tag{{Name: "+Покупки"}},
+		List:    &storage.List{Name: "Дом"},
+	})
+
+	record, err := s.GetRecordByID(ids[0])
+	if err != nil {
+		t.Fatalf("record can not be retrieved, unexpected error: %s", err)
+	}
+
+	if record.Content != content {
+		t.Errorf("content expected: %q, got: %q", content, record.Content)
+	}
+
+	if len(record.Tags) != 1 || record.Tags[0].Name != "покупки" || record.List == nil || record.List.Name != "дом" {
+		t.Errorf("tag and list names expected to be normalized, got: %v, %v", record.Tags, record.List)
+	}
+
+	if got := recordIDs(t, s, storage.Filter{Tag: "ПОКУПКИ", List: "ДОМ"}); !reflect.DeepEqual(got, ids) {
+		t.Errorf("record expected to be selected by its tag and list in any case, got: %v", got)
+	}
+
+	results, err := s.SearchRecords("молоко")
+	if err != nil || len(results) != 1 || results[0].Record.ID != ids[0] {
+		t.Fatalf("record expected to be found, got: %v, error: %v", results, err)
+	}
+
+	if !strings.Contains(results[0].Snippet, storage.HighlightStart+"молоко"+storage.HighlightEnd) {
+		t.Errorf("matched term expected to be highlighted, got: %q", results[0].Snippet)
+	}
+}
+
+// testLargeContent checks that content of megabytes is kept as it is
+func testLargeContent(t *testing.T, s storage.Storage) {
+	content := strings.Repeat("large content of a task ", 1<<16)
+	ids := mustCreate(t, s, storage.Record{Content: content})
+
+	record, err := s.GetRecordByID(ids[0])
+	if err != nil {
+		t.Fatalf("record can not be retrieved, unexpected error: %s", err)
+	}
+
+	if record.Content != content {
+		t.Errorf("content of %d bytes expected to be kept, got %d bytes", len(content), len(record.Content))
+	}
+
+	record.Content = content + "updated"
+	if err = s.UpdateRecord(&record); err != nil {
+		t.Fatalf("record can not be updated, unexpected error: %s", err)
+	}
+
+	if updated, _ := s.GetRecordByID(ids[0]); updated.Content != record.Content {
+		t.Errorf("updated content of %d bytes expected, got %d bytes", len(record.Content), len(updated.Content))
+	}
+}
+
+// testConcurrentWriters checks that records created and completed from several goroutines are all kept
+func testConcurrentWriters(t *testing.T, s storage.Storage) {
+	const writers, recordsPerWriter = 8, 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*recordsPerWriter)
+	for writer := 0; writer < writers; writer++ {
+		wg.Add(1)
+		go func(writer int) {
+			defer wg.Done()
+			for i := 0; i < recordsPerWriter; i++ {
+				record := storage.Record{Content: fmt.Sprintf("writer %d record %d", writer, i)}
+				if err := s.CreateRecord(&record); err != nil {
+					errs <- err
+					continue
+				}
+				if i%2 == 0 {
+					if err := s.MarkRecordDone(record.ID, true); err != nil {
+						errs <- err
+					}
+				}
+			}
+		}(writer)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("concurrent write failed, unexpected error: %s", err)
+	}
+
+	records, err := s.GetRecords(storage.Filter{})
+	if err != nil {
+		t.Fatalf("records can not be retrieved, unexpected error: %s", err)
+	}
+
+	seen := make(map[uint]bool, len(records))
+	for _, record := range records {
+		seen[record.ID] = true
+	}
+
+	if len(records) != writers*recordsPerWriter || len(seen) != len(records) {
+		t.Errorf("%d records with unique IDs expected, got %d records with %d IDs", writers*recordsPerWriter, len(records), len(seen))
+	}
+
+	if count, _ := s.CountRecords(storage.Filter{Status: storage.StatusDone}); count != writers*recordsPerWriter/2 {
+		t.Errorf("%d completed records expected, got: %d", writers*recordsPerWriter/2, count)
+	}
+}
+
+// testMigrations checks that the opened storage has all its migrations applied and that the latest one is rolled back
+// and applied again keeping the records; storages without a schema report no migrations
+func testMigrations(t *testing.T, s storage.Storage) {
+	ids := mustCreate(t, s, storage.Record{Content: "kept", Tags: []storage.Tag{{Name: "home"}}})
+
+	migrations, err := s.Migrations()
+	if err != nil {
+		t.Fatalf("migrations can not be listed, unexpected error: %s", err)
+	}
+
+	for i, migration := range migrations {
+		if migration.AppliedAt == nil {
+			t.Errorf("migration %d expected to be applied on open", migration.Version)
+		}
+		if i > 0 && migration.Version <= migrations[i-1].Version {
+			t.Errorf("migrations expected in the order of versions, got %d after %d", migration.Version, migrations[i-1].Version)
+		}
+	}
+
+	if applied, _, err := s.Migrate(); err != nil || len(applied) != 0 {
+		t.Errorf("no migrations expected to be pending, got: %v, error: %v", applied, err)
+	}
+
+	var latest uint
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+
+	if reverted, _, err := s.RollbackMigrations(latest); err != nil || len(reverted) != 0 {
+		t.Errorf("nothing expected to be rolled back to the latest version, got: %v, error: %v", reverted, err)
+	}
+
+	if latest > 0 {
+		reverted, backup, err := s.RollbackMigrations(latest - 1)
+		if err != nil || len(reverted) != 1 || reverted[0].Version != latest || backup == "" {
+			t.Fatalf("migration %d expected to be rolled back after a backup, got: %v, backup: %q, error: %v", latest, reverted, backup, err)
+		}
+
+		applied, _, err := s.Migrate()
+		if err != nil || len(applied) != 1 || applied[0].Version != latest || applied[0].AppliedAt == nil {
+			t.Fatalf("migration %d expected to be applied again, got: %v, error: %v", latest, applied, err)
+		}
+	}
+
+	record, err := s.GetRecordByID(ids[0])
+	if err != nil || record.Content != "kept" || len(record.Tags) != 1 {
+		t.Errorf("record expected to be kept by migrations, got: %+v, error: %v", record, err)
+	}
+}
+
+// testBackups checks that backups made before destructive changes restore the records, the latest backups first;
+// storages without backups report none
+func testBackups(t *testing.T, s storage.Storage) {
+	if _, err := s.RestoreBackup("missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("missing backup can not be restored, not found error expected, got: %v", err)
+	}
+
+	mustCreate(t, s, storage.Record{Content: "first"}, storage.Record{Content: "second"})
+	if _, err := s.ImportRecords(nil, true); err != nil {
+		t.Fatalf("records can not be replaced, unexpected error: %s", err)
+	}
+
+	backups, err := s.Backups()
+	if err != nil {
+		t.Fatalf("backups can not be listed, unexpected error: %s", err)
+	}
+
+	for i := 1; i < len(backups); i++ {
+		if backups[i].CreatedAt.After(backups[i-1].CreatedAt) {
+			t.Errorf("backups expected to be listed the latest first, got: %v", backups)
+		}
+	}
+
+	if len(backups) == 0 {
+		return
+	}
+
+	if backups[0].Reason != "before-import" {
+		t.Fatalf("backup before import expected to be the latest one, got: %+v", backups[0])
+	}
+
+	previous, err := s.RestoreBackup(backups[0].Name)
+	if err != nil || previous.Reason != "before-restore" {
+		t.Fatalf("backup can not be restored after backing up the replaced state, got: %+v, error: %v", previous, err)
+	}
+
+	if count, _ := s.CountRecords(storage.Filter{}); count != 2 {
+		t.Errorf("records expected to be restored from the backup, got %d records", count)
+	}
+
+	mustCreate(t, s, storage.Record{Content: "after restore"})
+	if count, _ := s.CountRecords(storage.Filter{}); count != 3 {
+		t.Errorf("restored storage expected to take new records, got %d records", count)
+	}
+
+	// backups made within the same moment may be listed in any order
+	backups, err = s.Backups()
+	listed := false
+	for _, backup := range backups {
+		listed = listed || backup.Name == previous.Name
+	}
+	if err != nil || !listed {
+		t.Errorf("backup of the replaced state expected to be listed, got: %v, error: %v", backups, err)
+	}
+}
+
+// testCleanUp checks that the cleaned up storage is left empty and usable, and that undo either restores all
+// the cleaned up records or fails for storages which do not keep them
+func testCleanUp(t *testing.T, s storage.Storage) {
+	mustCreate(t, s, storage.Record{Content: "first", Tags: []storage.Tag{{Name: "home"}}, List: &storage.List{Name: "chores"}}, storage.Record{Content: "second"})
+
+	if err := s.CleanUp(); err != nil {
+		t.Fatalf("storage can not be cleaned up, unexpected error: %s", err)
+	}
+
+	if count, err := s.CountRecords(storage.Filter{Status: storage.StatusAny}); err != nil || count != 0 {
+		t.Errorf("no records expected after clean up, got: %d, error: %v", count, err)
+	}
+
+	if tags, _ := s.GetTags(); len(tags) != 0 {
+		t.Errorf("no tags expected after clean up, got: %v", tags)
+	}
+
+	if _, err := s.Undo(); err == nil {
+		if count, _ := s.CountRecords(storage.Filter{}); count != 2 {
+			t.Errorf("undone clean up expected to restore all the records, got %d records", count)
+		}
+		if err = s.CleanUp(); err != nil {
+			t.Fatalf("restored storage can not be cleaned up, unexpected error: %s", err)
+		}
+	}
+
+	mustCreate(t, s, storage.Record{Content: "new"})
+	if count, _ := s.CountRecords(storage.Filter{}); count != 1 {
+		t.Errorf("cleaned up storage expected to take new records, got %d records", count)
+	}
+}
@@ -0,0 +1,125 @@
+package transfer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/manmolecular/go-later/internal/pkg/storage"
+)
+
+const (
+	markdownTitle        = "# later"
+	markdownPending      = "- [ ] "
+	markdownDone         = "- [x] "
+	markdownCommentStart = "<!-- "
+	markdownCommentEnd   = " -->"
+)
+
+// encodeMarkdown writes records as a checklist, tags are appended to the content as +tag tokens
+// and the other attributes are kept in a trailing HTML comment, e.g.:
+// - [ ] buy milk +home <!-- created_at=2026-10-17T10:00:00Z priority=high -->
+func encodeMarkdown(w io.Writer, records []storage.Record) error {
+	if _, err := fmt.Fprintf(w, "%s\n\n", markdownTitle); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		box := markdownPending
+		if record.Done {
+			box = markdownDone
+		}
+
+		content := strings.ReplaceAll(record.Content, "\n", " ")
+		for _, tag := range record.Tags {
+			content += " +" + tag.Name
+		}
+
+		attributes := []string{"created_at=" + record.CreatedAt.Format(time.RFC3339Nano)}
+		if record.Priority != storage.PriorityNone {
+			attributes = append(attributes, "priority="+record.Priority.String())
+		}
+		if record.List != nil && !strings.ContainsAny(record.List.Name, " =") {
+			attributes = append(attributes, "list="+record.List.Name)
+		}
+		if record.Recurrence != "" {
+			attributes = append(attributes, "recurrence="+record.Recurrence)
+		}
+		for _, attribute := range []struct {
+			name  string
+			value *time.Time
+		}{
+			{name: "due_at", value: record.DueAt},
+			{name: "completed_at", value: record.CompletedAt},
+			{name: "updated_at", value: record.UpdatedAt},
+		} {
+			if attribute.value != nil {
+				attributes = append(attributes, attribute.name+"="+formatTime(attribute.value))
+			}
+		}
+
+		_, err := fmt.Fprintf(w, "%s%s %s%s%s\n", box, content, markdownCommentStart, strings.Join(attributes, " "), markdownCommentEnd)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeMarkdown reads records from checklist items, other lines are ignored; items written by hand
+// without the attributes comment are imported as well
+func decodeMarkdown(r io.Reader) ([]storage.Record, error) {
+	var records []storage.Record
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+
+		fields := map[string]string{}
+		switch {
+		case strings.HasPrefix(text, markdownPending):
+			fields["done"] = "false"
+		case strings.HasPrefix(text, markdownDone), strings.HasPrefix(text, "- [X] "):
+			fields["done"] = "true"
+		default:
+			continue
+		}
+		text = text[len(markdownPending):]
+
+		if start := strings.LastIndex(text, markdownCommentStart); start >= 0 && strings.HasSuffix(text, markdownCommentEnd) {
+			comment := strings.TrimSuffix(text[start+len(markdownCommentStart):], markdownCommentEnd)
+			for _, attribute := range strings.Fields(comment) {
+				if name, value, ok := strings.Cut(attribute, "="); ok {
+					fields[name] = value
+				}
+			}
+			text = text[:start]
+		}
+
+		var words, tags []string
+		for _, word := range strings.Fields(text) {
+			if len(word) > 1 && strings.HasPrefix(word, "+") {
+				tags = append(tags, word)
+				continue
+			}
+			words = append(words, word)
+		}
+		fields["content"] = strings.Join(words, " ")
+		fields["tags"] = strings.Join(tags, " ")
+
+		record, err := parseFields(func(name string) string { return fields[name] })
+		if err != nil {
+			return nil, fmt.Errorf("markdown line %d is invalid, error: %w", line, err)
+		}
+		records = append(records, record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("can not read markdown, error: %w", err)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,282 @@
+package transfer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/manmolecular/go-later/internal/pkg/storage"
+)
+
+// syncStateSuffix defines the suffix of the hidden file next to the todo.txt file with the state of the last sync
+const syncStateSuffix = ".later-sync"
+
+// SyncReport defines changes made by a todo.txt synchronization
+type SyncReport struct {
+	Created uint `json:"created"` // records created from tasks added to the file
+	Updated uint `json:"updated"` // records updated from tasks changed in the file
+	Deleted uint `json:"deleted"` // records deleted as their tasks were removed from the file
+	Written uint `json:"written"` // tasks written to the file
+}
+
+// syncState defines the state of the last sync
+type syncState struct {
+	SyncedAt time.Time `json:"synced_at"` // modification time of the file written on the last sync
+	IDs      []uint    `json:"ids"`       // IDs of records written to the file on the last sync
+}
+
+// SyncTodoTxt makes the todo.txt file and the storage consistent: tasks added to the file are created in the storage,
+// tasks removed from the file since the last sync are deleted from the storage, and the file is rewritten with all the
+// records of the storage. Changes of tasks are taken from the file only if it has been modified since the last sync;
+// when a task was changed both in the file and in the storage, the latest change wins, comparing modification time
+// of the file with the time the record was created, edited or completed
+func SyncTodoTxt(s storage.Storage, path string) (SyncReport, error) {
+	var report SyncReport
+
+	state, err := loadSyncState(path)
+	if err != nil {
+		return report, err
+	}
+
+	tasks, modifiedAt, err := readTodoTxt(path)
+	if err != nil {
+		return report, err
+	}
+
+	records, err := s.GetRecords(storage.Filter{Order: storage.OrderOldest})
+	if err != nil {
+		return report, fmt.Errorf("can not get list of records, error: %w", err)
+	}
+
+	idToRecord := make(map[uint]storage.Record, len(records))
+	for _, record := range records {
+		idToRecord[record.ID] = record
+	}
+
+	synced := make(map[uint]bool, len(state.IDs))
+	for _, id := range state.IDs {
+		synced[id] = true
+	}
+
+	fileChanged := !modifiedAt.Equal(state.SyncedAt)
+	listed := make(map[uint]bool, len(tasks))
+	for _, task := range tasks {
+		record, ok := idToRecord[task.ID]
+		switch {
+		case ok:
+			listed[task.ID] = true
+			if !fileChanged || syncKey(task, record) == syncKey(record, record) || changedAt(record).After(modifiedAt) {
+				continue
+			}
+			if err = applyTask(s, task, record); err != nil {
+				return report, err
+			}
+			report.Updated++
+		case task.ID != 0 && synced[task.ID]:
+			// the record was deleted from the storage after the last sync
+		default:
+			task.ID = 0
+			if err = s.CreateRecord(&task); err != nil {
+				return report, fmt.Errorf("task '%s' can not be created, error: %w", task.Content, err)
+			}
+			report.Created++
+		}
+	}
+
+	for _, record := range records {
+		if listed[record.ID] || !synced[record.ID] {
+			continue
+		}
+		// subtasks removed together with their parent are already deleted with it
+		if err = s.DeleteRecordByID(record.ID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return report, fmt.Errorf("record %d can not be deleted, error: %w", record.ID, err)
+		}
+		report.Deleted++
+	}
+
+	if records, err = s.GetRecords(storage.Filter{Order: storage.OrderOldest}); err != nil {
+		return report, fmt.Errorf("can not get list of records, error: %w", err)
+	}
+
+	if state, err = writeTodoTxt(path, records); err != nil {
+		return report, err
+	}
+	report.Written = uint(len(records))
+
+	return report, saveSyncState(path, state)
+}
+
+// applyTask updates the record to match the task read from the file
+func applyTask(s storage.Storage, task, record storage.Record) error {
+	dueChanged := (task.DueAt == nil) != (record.DueAt == nil) ||
+		(task.DueAt != nil && task.DueAt.Format(todoTxtDate) != record.DueAt.Local().Format(todoTxtDate))
+
+	if task.Content != strings.Join(strings.Fields(record.Content), " ") || task.Priority != record.Priority || dueChanged {
+		record.Content = task.Content
+		record.Priority = task.Priority
+		if dueChanged {
+			record.DueAt = task.DueAt
+		}
+		if err := s.UpdateRecord(&record); err != nil {
+			return fmt.Errorf("record %d can not be updated, error: %w", record.ID, err)
+		}
+	}
+
+	if task.Done != record.Done {
+		if err := s.MarkRecordDone(record.ID, task.Done); err != nil {
+			return fmt.Errorf("record %d status can not be changed, error: %w", record.ID, err)
+		}
+	}
+
+	current := make(map[string]bool, len(record.Tags))
+	for _, tag := range record.Tags {
+		current[tag.Name] = true
+	}
+
+	for _, tag := range task.Tags {
+		if current[tag.Name] {
+			delete(current, tag.Name)
+			continue
+		}
+		if err := s.TagRecord(record.ID, tag.Name); err != nil {
+			return fmt.Errorf("record %d can not be tagged, error: %w", record.ID, err)
+		}
+	}
+
+	for tag := range current {
+		if err := s.UntagRecord(record.ID, tag); err != nil {
+			return fmt.Errorf("record %d can not be untagged, error: %w", record.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// syncKey returns a task line comparable regardless of tags order and of attributes the file does not keep;
+// the creation and completion dates are taken from the reference record, as they are not synchronized
+func syncKey(record, reference storage.Record) string {
+	record.CreatedAt = reference.CreatedAt
+	record.CompletedAt = reference.CompletedAt
+	record.Tags = append([]storage.Tag(nil), record.Tags...)
+	sort.Slice(record.Tags, func(i, j int) bool {
+		return record.Tags[i].Name < record.Tags[j].Name
+	})
+
+	return FormatTodoTxtLine(record)
+}
+
+// changedAt returns the time the record was created, edited or completed, whichever is the latest
+func changedAt(record storage.Record) time.Time {
+	latest := record.CreatedAt
+	for _, t := range []*time.Time{record.UpdatedAt, record.CompletedAt} {
+		if t != nil && t.After(latest) {
+			latest = *t
+		}
+	}
+
+	return latest
+}
+
+// readTodoTxt returns tasks of the file with its modification time, a missing file has no tasks
+func readTodoTxt(path string) ([]storage.Record, time.Time, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("todo.txt file can not be opened, error: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("todo.txt file can not be accessed, error: %w", err)
+	}
+
+	tasks, err := decodeTodoTxt(bufio.NewReader(file))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return tasks, info.ModTime(), nil
+}
+
+// writeTodoTxt replaces the file with the records and returns the state of the sync
+func writeTodoTxt(path string, records []storage.Record) (syncState, error) {
+	state := syncState{IDs: make([]uint, 0, len(records))}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return state, fmt.Errorf("todo.txt file can not be written, error: %w", err)
+	}
+	defer os.Remove(temp.Name())
+
+	if err = encodeTodoTxt(temp, records); err != nil {
+		_ = temp.Close()
+		return state, fmt.Errorf("todo.txt file can not be written, error: %w", err)
+	}
+
+	if err = temp.Close(); err != nil {
+		return state, fmt.Errorf("todo.txt file can not be written, error: %w", err)
+	}
+
+	if err = os.Rename(temp.Name(), path); err != nil {
+		return state, fmt.Errorf("todo.txt file can not be replaced, error: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return state, fmt.Errorf("todo.txt file can not be accessed, error: %w", err)
+	}
+	state.SyncedAt = info.ModTime()
+
+	for _, record := range records {
+		state.IDs = append(state.IDs, record.ID)
+	}
+
+	return state, nil
+}
+
+// syncStatePath returns the path of the sync state of the todo.txt file
+func syncStatePath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+syncStateSuffix)
+}
+
+// loadSyncState returns the state of the last sync, the state is empty if the file has not been synced yet
+func loadSyncState(path string) (syncState, error) {
+	var state syncState
+
+	data, err := os.ReadFile(syncStatePath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("sync state can not be read, error: %w", err)
+	}
+
+	if err = json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("sync state can not be decoded, error: %w", err)
+	}
+
+	return state, nil
+}
+
+// saveSyncState writes the state of the sync next to the todo.txt file
+func saveSyncState(path string, state syncState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("sync state can not be encoded, error: %w", err)
+	}
+
+	if err = os.WriteFile(syncStatePath(path), data, 0600); err != nil {
+		return fmt.Errorf("sync state can not be written, error: %w", err)
+	}
+
+	return nil
+}
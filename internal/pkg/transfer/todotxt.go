@@ -0,0 +1,199 @@
+package transfer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/manmolecular/go-later/internal/pkg/dateparse"
+	"github.com/manmolecular/go-later/internal/pkg/storage"
+)
+
+// todoTxtDate defines the format of dates in todo.txt files
+const todoTxtDate = "2006-01-02"
+
+// Keys of key:value pairs in todo.txt tasks handled by the codec, other pairs are kept in the content
+const (
+	todoTxtDue      = "due"
+	todoTxtID       = "id"
+	todoTxtPriority = "pri" // priority of completed tasks, as it is replaced by the completion mark
+)
+
+// priorityToLetter maps priority levels to todo.txt priority letters
+var priorityToLetter = map[storage.Priority]string{
+	storage.PriorityHigh:   "A",
+	storage.PriorityMedium: "B",
+	storage.PriorityLow:    "C",
+}
+
+// FormatTodoTxtLine returns a record as a todo.txt task, tags starting with "@" are written as contexts
+// and the others as projects; the record ID is kept in the id:N pair to match the task on sync
+func FormatTodoTxtLine(record storage.Record) string {
+	var words []string
+	if record.Done {
+		words = append(words, "x")
+		if record.CompletedAt != nil {
+			words = append(words, record.CompletedAt.Local().Format(todoTxtDate))
+		}
+	} else if letter, ok := priorityToLetter[record.Priority]; ok {
+		words = append(words, "("+letter+")")
+	}
+
+	if !record.CreatedAt.IsZero() {
+		words = append(words, record.CreatedAt.Local().Format(todoTxtDate))
+	}
+
+	words = append(words, strings.Fields(record.Content)...)
+
+	for _, tag := range record.Tags {
+		if strings.HasPrefix(tag.Name, "@") {
+			words = append(words, tag.Name)
+			continue
+		}
+		words = append(words, "+"+tag.Name)
+	}
+
+	if record.DueAt != nil {
+		words = append(words, todoTxtDue+":"+record.DueAt.Local().Format(todoTxtDate))
+	}
+
+	if letter, ok := priorityToLetter[record.Priority]; ok && record.Done {
+		words = append(words, todoTxtPriority+":"+letter)
+	}
+
+	if record.ID != 0 {
+		words = append(words, todoTxtID+":"+strconv.Itoa(int(record.ID)))
+	}
+
+	return strings.Join(words, " ")
+}
+
+// ParseTodoTxtLine returns a record from a todo.txt task, dates are resolved in the location;
+// priorities below (C) are treated as low, the ID is taken from the id:N pair if it is present
+func ParseTodoTxtLine(line string, loc *time.Location) (storage.Record, error) {
+	var record storage.Record
+
+	words := strings.Fields(line)
+	if len(words) > 0 && words[0] == "x" {
+		record.Done = true
+		words = words[1:]
+		if completedAt, ok := parseTodoTxtDate(words, loc); ok {
+			record.CompletedAt = &completedAt
+			words = words[1:]
+		}
+	}
+
+	if len(words) > 0 && len(words[0]) == 3 && words[0][0] == '(' && words[0][2] == ')' {
+		priority, ok := parseTodoTxtPriority(words[0][1:2])
+		if ok {
+			record.Priority = priority
+			words = words[1:]
+		}
+	}
+
+	if createdAt, ok := parseTodoTxtDate(words, loc); ok {
+		record.CreatedAt = createdAt
+		words = words[1:]
+	}
+
+	var content []string
+	for _, word := range words {
+		switch {
+		case len(word) > 1 && (word[0] == '+' || word[0] == '@'):
+			record.Tags = append(record.Tags, storage.Tag{Name: storage.NormalizeTag(word)})
+			continue
+		case strings.HasPrefix(word, todoTxtDue+":"):
+			dueAt, err := time.ParseInLocation(todoTxtDate, strings.TrimPrefix(word, todoTxtDue+":"), loc)
+			if err != nil {
+				return record, fmt.Errorf("due date is invalid, error: %w", err)
+			}
+			dueAt = dateparse.EndOfDay(dueAt)
+			record.DueAt = &dueAt
+			continue
+		case strings.HasPrefix(word, todoTxtID+":"):
+			id, err := strconv.Atoi(strings.TrimPrefix(word, todoTxtID+":"))
+			if err != nil || id <= 0 {
+				return record, fmt.Errorf("task ID '%s' is invalid", word)
+			}
+			record.ID = uint(id)
+			continue
+		case strings.HasPrefix(word, todoTxtPriority+":"):
+			if priority, ok := parseTodoTxtPriority(strings.TrimPrefix(word, todoTxtPriority+":")); ok {
+				record.Priority = priority
+				continue
+			}
+		}
+		content = append(content, word)
+	}
+
+	record.Content = strings.Join(content, " ")
+	if record.Content == "" {
+		return record, fmt.Errorf("task '%s' has no content", line)
+	}
+
+	return record, nil
+}
+
+// encodeTodoTxt writes records as todo.txt tasks, one per line
+func encodeTodoTxt(w io.Writer, records []storage.Record) error {
+	for _, record := range records {
+		if _, err := fmt.Fprintln(w, FormatTodoTxtLine(record)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeTodoTxt reads records from todo.txt tasks, empty lines are skipped
+func decodeTodoTxt(r io.Reader) ([]storage.Record, error) {
+	var records []storage.Record
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		record, err := ParseTodoTxtLine(scanner.Text(), time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("todo.txt line %d is invalid, error: %w", line, err)
+		}
+		records = append(records, record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("can not read todo.txt, error: %w", err)
+	}
+
+	return records, nil
+}
+
+// parseTodoTxtDate returns the date if the first word is a todo.txt date
+func parseTodoTxtDate(words []string, loc *time.Location) (time.Time, bool) {
+	if len(words) == 0 {
+		return time.Time{}, false
+	}
+
+	date, err := time.ParseInLocation(todoTxtDate, words[0], loc)
+
+	return date, err == nil
+}
+
+// parseTodoTxtPriority returns the priority level of a todo.txt priority letter
+func parseTodoTxtPriority(letter string) (storage.Priority, bool) {
+	if len(letter) != 1 || letter[0] < 'A' || letter[0] > 'Z' {
+		return storage.PriorityNone, false
+	}
+
+	for priority, priorityLetter := range priorityToLetter {
+		if letter == priorityLetter {
+			return priority, true
+		}
+	}
+
+	return storage.PriorityLow, true
+}
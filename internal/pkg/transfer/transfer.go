@@ -0,0 +1,307 @@
+package transfer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/manmolecular/go-later/internal/pkg/recurrence"
+	"github.com/manmolecular/go-later/internal/pkg/storage"
+)
+
+const (
+	FormatJSON     = "json"    // a document with records and export metadata
+	FormatCSV      = "csv"     // comma-separated values with a header
+	FormatMarkdown = "md"      // a checklist with record attributes kept in HTML comments
+	FormatTodoTxt  = "todotxt" // todo.txt tasks, see https://github.com/todotxt/todo.txt
+)
+
+// Version defines the version of exported documents, it is increased on incompatible changes
+const Version = 1
+
+// extToFormat maps file extensions to formats
+var extToFormat = map[string]string{
+	".json":     FormatJSON,
+	".csv":      FormatCSV,
+	".md":       FormatMarkdown,
+	".markdown": FormatMarkdown,
+	".txt":      FormatTodoTxt,
+}
+
+// csvHeader defines columns of records in csv format
+var csvHeader = []string{"id", "created_at", "content", "done", "priority", "due_at", "completed_at", "updated_at", "tags", "list", "recurrence", "parent_id"}
+
+// Document defines exported records with metadata
+type Document struct {
+	Version    int              `json:"version"`
+	ExportedAt time.Time        `json:"exported_at"`
+	Records    []storage.Record `json:"records"`
+}
+
+// FormatByPath returns the format matching the file extension
+func FormatByPath(path string) (string, error) {
+	format, ok := extToFormat[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return "", fmt.Errorf("format of '%s' can not be detected by its extension", path)
+	}
+
+	return format, nil
+}
+
+// Encode writes records in the format
+func Encode(w io.Writer, format string, records []storage.Record) error {
+	switch format {
+	case FormatJSON:
+		return encodeJSON(w, records)
+	case FormatCSV:
+		return encodeCSV(w, records)
+	case FormatMarkdown:
+		return encodeMarkdown(w, records)
+	case FormatTodoTxt:
+		return encodeTodoTxt(w, records)
+	}
+
+	return fmt.Errorf("format '%s' is unknown", format)
+}
+
+// Decode reads records in the format
+func Decode(r io.Reader, format string) ([]storage.Record, error) {
+	switch format {
+	case FormatJSON:
+		return decodeJSON(r)
+	case FormatCSV:
+		return decodeCSV(r)
+	case FormatMarkdown:
+		return decodeMarkdown(r)
+	case FormatTodoTxt:
+		return decodeTodoTxt(r)
+	}
+
+	return nil, fmt.Errorf("format '%s' is unknown", format)
+}
+
+// encodeJSON writes records as a document with metadata
+func encodeJSON(w io.Writer, records []storage.Record) error {
+	if records == nil {
+		records = []storage.Record{}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(Document{Version: Version, ExportedAt: time.Now(), Records: records})
+}
+
+// decodeJSON reads records from a document or from a plain list, e.g. produced by "later --output json list"
+func decodeJSON(r io.Reader) ([]storage.Record, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("can not read data, error: %w", err)
+	}
+
+	var records []storage.Record
+	if err = json.Unmarshal(data, &records); err == nil {
+		return records, nil
+	}
+
+	var document Document
+	if err = json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("can not decode json, error: %w", err)
+	}
+
+	if document.Version > Version {
+		return nil, fmt.Errorf("document version %d is not supported", document.Version)
+	}
+
+	return document.Records, nil
+}
+
+// encodeCSV writes records as comma-separated values with a header
+func encodeCSV(w io.Writer, records []storage.Record) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		tags := make([]string, 0, len(record.Tags))
+		for _, tag := range record.Tags {
+			tags = append(tags, tag.Name)
+		}
+
+		row := []string{
+			strconv.Itoa(int(record.ID)),
+			record.CreatedAt.Format(time.RFC3339Nano),
+			record.Content,
+			strconv.FormatBool(record.Done),
+			record.Priority.String(),
+			formatTime(record.DueAt),
+			formatTime(record.CompletedAt),
+			formatTime(record.UpdatedAt),
+			strings.Join(tags, " "),
+			"",
+			record.Recurrence,
+			"",
+		}
+		if record.List != nil {
+			row[9] = record.List.Name
+		}
+		if record.ParentID != nil {
+			row[11] = strconv.Itoa(int(*record.ParentID))
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// decodeCSV reads records from comma-separated values, columns are matched by the header names
+func decodeCSV(r io.Reader) ([]storage.Record, error) {
+	reader := csv.NewReader(r)
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("can not read csv, error: %w", err)
+	}
+
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string]int, len(rows[0]))
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	if _, ok := columns["content"]; !ok {
+		return nil, errors.New("csv header has no content column")
+	}
+
+	records := make([]storage.Record, 0, len(rows)-1)
+	for line, row := range rows[1:] {
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+
+		record, err := parseFields(field)
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d is invalid, error: %w", line+2, err)
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// parseFields returns a record from the named fields shared by csv and markdown formats
+func parseFields(field func(name string) string) (storage.Record, error) {
+	record := storage.Record{Content: field("content")}
+	if record.Content == "" {
+		return record, errors.New("content is empty")
+	}
+
+	var err error
+	if record.ID, err = parseID(field("id")); err != nil {
+		return record, fmt.Errorf("id is invalid, error: %w", err)
+	}
+
+	parentID, err := parseID(field("parent_id"))
+	if err != nil {
+		return record, fmt.Errorf("parent_id is invalid, error: %w", err)
+	}
+	if parentID != 0 {
+		record.ParentID = &parentID
+	}
+
+	if value := field("created_at"); value != "" {
+		if record.CreatedAt, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			return record, fmt.Errorf("creation time is invalid, error: %w", err)
+		}
+	}
+
+	if value := field("done"); value != "" {
+		if record.Done, err = strconv.ParseBool(value); err != nil {
+			return record, fmt.Errorf("completion status is invalid, error: %w", err)
+		}
+	}
+
+	if value := field("priority"); value != "" {
+		if record.Priority, err = storage.ParsePriority(value); err != nil {
+			return record, err
+		}
+	}
+
+	for name, target := range map[string]**time.Time{
+		"due_at":       &record.DueAt,
+		"completed_at": &record.CompletedAt,
+		"updated_at":   &record.UpdatedAt,
+	} {
+		if *target, err = parseTime(field(name)); err != nil {
+			return record, fmt.Errorf("%s is invalid, error: %w", name, err)
+		}
+	}
+
+	for _, tag := range strings.Fields(strings.ReplaceAll(field("tags"), ",", " ")) {
+		record.Tags = append(record.Tags, storage.Tag{Name: tag})
+	}
+
+	if list := field("list"); list != "" {
+		record.List = &storage.List{Name: list}
+	}
+
+	if value := field("recurrence"); value != "" {
+		rule, err := recurrence.Parse(value)
+		if err != nil {
+			return record, fmt.Errorf("recurrence is invalid, error: %w", err)
+		}
+		record.Recurrence = rule.String()
+	}
+
+	return record, nil
+}
+
+// parseID returns the ID or zero if the value is empty
+func parseID(value string) (uint, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseUint(value, 10, 0)
+
+	return uint(id), err
+}
+
+// formatTime returns the time in RFC 3339 format or an empty string if the time is not set
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339Nano)
+}
+
+// parseTime returns the time parsed from RFC 3339 format or nil if the value is empty
+func parseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,189 @@
+package transfer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/manmolecular/go-later/internal/pkg/storage"
+)
+
+// TestEncodeDecode checks that records survive a round trip through every format
+func TestEncodeDecode(t *testing.T) {
+	createdAt := time.Date(2026, time.October, 14, 10, 30, 0, 123, time.UTC)
+	dueAt := time.Date(2026, time.October, 16, 17, 0, 0, 0, time.UTC)
+	parentID := uint(1)
+	records := []storage.Record{
+		{ID: 1, CreatedAt: createdAt, Content: "buy milk, eggs", Priority: storage.PriorityHigh, DueAt: &dueAt, Tags: []storage.Tag{{Name: "home"}}, Recurrence: "FREQ=WEEKLY;BYDAY=MO"},
+		{ID: 2, CreatedAt: createdAt.Add(time.Hour), Content: "write \"report\"", Done: true, CompletedAt: &dueAt, ParentID: &parentID},
+	}
+
+	for _, format := range []string{FormatJSON, FormatCSV, FormatMarkdown} {
+		var buffer bytes.Buffer
+		if err := Encode(&buffer, format, records); err != nil {
+			t.Fatalf("records can not be encoded to %s, unexpected error: %s", format, err)
+		}
+
+		decoded, err := Decode(&buffer, format)
+		if err != nil {
+			t.Fatalf("records can not be decoded from %s, unexpected error: %s", format, err)
+		}
+
+		if len(decoded) != len(records) {
+			t.Fatalf("expected %d records decoded from %s, got: %v", len(records), format, decoded)
+		}
+
+		for i, record := range decoded {
+			expected := records[i]
+			if record.Content != expected.Content || !record.CreatedAt.Equal(expected.CreatedAt) ||
+				record.Done != expected.Done || record.Priority != expected.Priority || len(record.Tags) != len(expected.Tags) ||
+				record.Recurrence != expected.Recurrence {
+				t.Errorf("expected record %v decoded from %s, got: %v", expected, format, record)
+			}
+
+			if format != FormatMarkdown && (record.ID != expected.ID || (record.ParentID == nil) != (expected.ParentID == nil)) {
+				t.Errorf("expected record %d with parent %v decoded from %s, got: %v", expected.ID, expected.ParentID, format, record)
+			}
+
+			if (record.DueAt == nil) != (expected.DueAt == nil) || (record.DueAt != nil && !record.DueAt.Equal(*expected.DueAt)) {
+				t.Errorf("expected due date %v decoded from %s, got: %v", expected.DueAt, format, record.DueAt)
+			}
+		}
+	}
+}
+
+// TestDecode checks that plain lists and hand-written checklists can be imported
+func TestDecode(t *testing.T) {
+	list := `[{"id": 3, "content": "plain list", "priority": "low", "tags": ["work"]}]`
+	records, err := Decode(strings.NewReader(list), FormatJSON)
+	if err != nil || len(records) != 1 || records[0].Priority != storage.PriorityLow || records[0].Tags[0].Name != "work" {
+		t.Errorf("expected a record decoded from a plain list, got: %v, error: %v", records, err)
+	}
+
+	checklist := "# tasks\n\n- [ ] call mom +family\n- [x] pay bills\nnot an item\n"
+	records, err = Decode(strings.NewReader(checklist), FormatMarkdown)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("expected 2 records decoded from a checklist, got: %v, error: %v", records, err)
+	}
+
+	if records[0].Content != "call mom" || len(records[0].Tags) != 1 || records[0].Done || !records[1].Done {
+		t.Errorf("expected checklist items with tags and completion status, got: %v", records)
+	}
+
+	if _, err = Decode(strings.NewReader("id,done\n1,true\n"), FormatCSV); err == nil {
+		t.Errorf("error expected when csv has no content column")
+	}
+
+	if _, err = FormatByPath("tasks.xml"); err == nil {
+		t.Errorf("error expected for an unknown file extension")
+	}
+}
+
+// TestTodoTxtLine checks that todo.txt tasks are parsed into records and formatted back
+func TestTodoTxtLine(t *testing.T) {
+	line := "(A) 2026-10-14 call mom +Family @phone due:2026-10-16 note:keep id:3"
+	record, err := ParseTodoTxtLine(line, time.UTC)
+	if err != nil {
+		t.Fatalf("task can not be parsed, unexpected error: %s", err)
+	}
+
+	if record.ID != 3 || record.Priority != storage.PriorityHigh || record.Content != "call mom note:keep" || len(record.Tags) != 2 {
+		t.Errorf("expected task attributes to be parsed, got: %v", record)
+	}
+
+	if record.CreatedAt.Format(todoTxtDate) != "2026-10-14" || record.DueAt == nil || record.DueAt.Format(todoTxtDate) != "2026-10-16" {
+		t.Errorf("expected task dates to be parsed, got: %v", record)
+	}
+
+	expected := "(A) 2026-10-14 call mom note:keep +family @phone due:2026-10-16 id:3"
+	if formatted := FormatTodoTxtLine(record); formatted != expected {
+		t.Errorf("expected task to be formatted as '%s', got: '%s'", expected, formatted)
+	}
+
+	record, err = ParseTodoTxtLine("x 2026-10-15 2026-10-14 pay bills pri:B", time.UTC)
+	if err != nil || !record.Done || record.CompletedAt == nil || record.Priority != storage.PriorityMedium {
+		t.Errorf("expected completed task with priority, got: %v, error: %v", record, err)
+	}
+
+	if _, err = ParseTodoTxtLine("(B) +work", time.UTC); err == nil {
+		t.Errorf("error expected for a task without content")
+	}
+}
+
+// TestSyncTodoTxt checks that changes made in the file and in the storage are synchronized both ways
+func TestSyncTodoTxt(t *testing.T) {
+	s, err := storage.NewCustomLocalStorage(t.TempDir(), "db", "test.db", storage.Options{})
+	if err != nil {
+		t.Fatalf("test storage can not be created, unexpected error: %s", err)
+	}
+
+	defer func() {
+		if err = s.Close(); err != nil {
+			t.Errorf("test storage can not be closed, unexpected error: %s", err)
+		}
+	}()
+
+	for _, content := range []string{"kept_record", "deleted_record"} {
+		if err = s.CreateRecord(&storage.Record{Content: content}); err != nil {
+			t.Fatalf("test record can not be created, unexpected error: %s", err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "todo.txt")
+	if err = os.WriteFile(path, []byte("(A) new_task +test\n"), 0600); err != nil {
+		t.Fatalf("test file can not be written, unexpected error: %s", err)
+	}
+
+	report, err := SyncTodoTxt(s, path)
+	if err != nil {
+		t.Fatalf("file can not be synced, unexpected error: %s", err)
+	}
+
+	if report.Created != 1 || report.Written != 3 {
+		t.Errorf("expected 1 created record and 3 written tasks, got: %v", report)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("synced file can not be read, unexpected error: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[2], "new_task +test id:3") {
+		t.Fatalf("expected 3 tasks in the synced file, got: %v", lines)
+	}
+
+	lines = []string{"x " + strings.Replace(lines[0], "kept_record", "edited_record", 1), lines[2]}
+	if err = os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatalf("test file can not be written, unexpected error: %s", err)
+	}
+
+	modifiedAt := time.Now().Add(time.Minute)
+	if err = os.Chtimes(path, modifiedAt, modifiedAt); err != nil {
+		t.Fatalf("test file time can not be changed, unexpected error: %s", err)
+	}
+
+	if report, err = SyncTodoTxt(s, path); err != nil {
+		t.Fatalf("file can not be synced, unexpected error: %s", err)
+	}
+
+	if report.Updated != 1 || report.Deleted != 1 || report.Written != 2 {
+		t.Errorf("expected 1 updated and 1 deleted record, got: %v", report)
+	}
+
+	record, err := s.GetRecordByID(1)
+	if err != nil || record.Content != "edited_record" || !record.Done {
+		t.Errorf("expected record to be edited and completed from the file, got: %v, error: %v", record, err)
+	}
+
+	if err = s.DeleteRecordByID(3); err != nil {
+		t.Fatalf("test record can not be deleted, unexpected error: %s", err)
+	}
+
+	if report, err = SyncTodoTxt(s, path); err != nil || report.Created != 0 || report.Written != 1 {
+		t.Errorf("expected record deleted from the storage to be removed from the file, got: %v, error: %v", report, err)
+	}
+}
@@ -0,0 +1,700 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/manmolecular/go-later/internal/pkg/dateparse"
+	"github.com/manmolecular/go-later/internal/pkg/storage"
+)
+
+// mode defines what the keys are currently used for
+type mode int
+
+const (
+	modeBrowse  mode = iota // moving across records and applying actions to the selected one
+	modeAdd                 // typing content of a new record
+	modeSubtask             // typing content of a new subtask of the selected record
+	modeEdit                // editing content of the selected record
+	modeSearch              // typing the text filter, applied while typing
+	modeTag                 // typing the tag filter
+	modeDelete              // confirming deletion of the selected record
+	modeHelp                // showing the list of keys
+)
+
+// modeToPrompt maps input modes to prompts shown before the typed text
+var modeToPrompt = map[mode]string{
+	modeAdd:     "add: ",
+	modeSubtask: "add subtask: ",
+	modeEdit:    "edit: ",
+	modeSearch:  "/",
+	modeTag:     "tag: +",
+}
+
+// priorityToMarker maps priority levels to markers shown before records content
+var priorityToMarker = map[storage.Priority]string{
+	storage.PriorityHigh:   "!!! ",
+	storage.PriorityMedium: "!! ",
+	storage.PriorityLow:    "! ",
+}
+
+// nextPriority maps priority levels to the next level in the cycle
+var nextPriority = map[storage.Priority]storage.Priority{
+	storage.PriorityNone:   storage.PriorityLow,
+	storage.PriorityLow:    storage.PriorityMedium,
+	storage.PriorityMedium: storage.PriorityHigh,
+	storage.PriorityHigh:   storage.PriorityNone,
+}
+
+const (
+	styleReverse = "\x1b[7m"
+	styleDim     = "\x1b[2m"
+	styleReset   = "\x1b[0m"
+	clearLine    = "\x1b[K"
+	hints        = "j/k move  a add  A subtask  e edit  x done  p priority  d delete  / search  t tag  tab all  u undo  ? help  q quit"
+)
+
+// helpLines describes the keys shown in the help mode
+var helpLines = []string{
+	"j, down / k, up    move the selection",
+	"g, home / G, end   go to the first / last task",
+	"pgdn / pgup        scroll by a page",
+	"a                  add a task",
+	"A                  add a subtask of the selected task",
+	"e, enter           edit content of the selected task",
+	"x, space           complete or reopen the selected task",
+	"p                  change priority of the selected task",
+	"d                  delete the selected task with its subtasks",
+	"/                  filter tasks by text",
+	"t                  filter tasks by tag",
+	"c, esc             clear filters",
+	"tab                show all or pending tasks only",
+	"u / U              undo / redo the latest change",
+	"r                  reload tasks",
+	"q, ctrl+c          quit",
+}
+
+// Options defines what records are shown
+type Options struct {
+	List  string        // list records are shown from and added to, empty for all lists
+	Order storage.Order // order of records
+}
+
+// row defines a record shown on the screen with its depth in the hierarchy of subtasks
+type row struct {
+	record   storage.Record
+	depth    int
+	progress *storage.Progress
+}
+
+// App defines the state of the interactive interface over the storage
+type App struct {
+	storage storage.Storage
+	options Options
+	now     func() time.Time
+
+	rows    []row
+	cursor  int // index of the selected row
+	offset  int // index of the first row on the screen
+	width   int
+	height  int
+	showAll bool   // completed records are shown as well
+	search  string // text filter, records are matched by content and tags
+	tag     string // tag filter
+
+	mode    mode
+	input   []rune
+	message string // result of the latest action shown in the status line
+}
+
+// NewApp creates the interface over the storage
+func NewApp(s storage.Storage, options Options) *App {
+	return &App{storage: s, options: options, now: time.Now, width: 80, height: 24}
+}
+
+// Resize sets the size of the screen in columns and rows
+func (a *App) Resize(width, height int) {
+	if width > 0 && height > 0 {
+		a.width, a.height = width, height
+	}
+	a.scroll()
+}
+
+// Reload reads records from the storage applying filters, the selection stays on the same record if it is still shown
+func (a *App) Reload() error {
+	selected := uint(0)
+	if record, ok := a.selected(); ok {
+		selected = record.ID
+	}
+
+	status := storage.StatusPending
+	if a.showAll {
+		status = storage.StatusAny
+	}
+
+	records, err := a.storage.GetRecords(storage.Filter{Status: status, Tag: a.tag, List: a.options.List, Order: a.options.Order})
+	if err != nil {
+		return fmt.Errorf("records can not be loaded, error: %s", err)
+	}
+
+	records = filterByText(records, a.search)
+
+	ids := make([]uint, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+
+	progress, err := a.storage.GetProgress(ids)
+	if err != nil {
+		return fmt.Errorf("progress of subtasks can not be loaded, error: %s", err)
+	}
+
+	a.rows = buildRows(records, progress)
+	for i, row := range a.rows {
+		if row.record.ID == selected {
+			a.cursor = i
+		}
+	}
+	a.scroll()
+
+	return nil
+}
+
+// HandleKey applies the key press and reports whether the interface should be closed
+func (a *App) HandleKey(key Key) bool {
+	if key.Code == KeyCtrlC {
+		return true
+	}
+
+	switch a.mode {
+	case modeBrowse:
+		return a.browse(key)
+	case modeHelp:
+		a.mode = modeBrowse
+	case modeDelete:
+		a.mode = modeBrowse
+		if key.Code == KeyRune && (key.Rune == 'y' || key.Rune == 'Y') {
+			a.deleteSelected()
+		} else {
+			a.message = "deletion is cancelled"
+		}
+	default:
+		a.edit(key)
+	}
+
+	return false
+}
+
+// browse handles keys moving the selection and applying actions to the selected record
+func (a *App) browse(key Key) bool {
+	a.message = ""
+
+	switch key.Code {
+	case KeyUp:
+		a.move(-1)
+	case KeyDown:
+		a.move(1)
+	case KeyPageUp:
+		a.move(-a.pageSize())
+	case KeyPageDown:
+		a.move(a.pageSize())
+	case KeyHome:
+		a.move(-len(a.rows))
+	case KeyEnd:
+		a.move(len(a.rows))
+	case KeyEnter:
+		a.startEdit()
+	case KeyEscape:
+		a.clearFilters()
+	case KeyTab:
+		a.showAll = !a.showAll
+		a.reload()
+	case KeyRune:
+		switch key.Rune {
+		case 'q':
+			return true
+		case 'j':
+			a.move(1)
+		case 'k':
+			a.move(-1)
+		case 'g':
+			a.move(-len(a.rows))
+		case 'G':
+			a.move(len(a.rows))
+		case 'a':
+			a.startInput(modeAdd, "")
+		case 'A':
+			if _, ok := a.selected(); ok {
+				a.startInput(modeSubtask, "")
+			}
+		case 'e':
+			a.startEdit()
+		case 'x', ' ':
+			a.toggleSelected()
+		case 'p':
+			a.prioritizeSelected()
+		case 'd':
+			if record, ok := a.selected(); ok {
+				a.mode = modeDelete
+				a.message = fmt.Sprintf("delete task %d and its subtasks? (y/n)", record.ID)
+			}
+		case '/':
+			a.startInput(modeSearch, a.search)
+		case 't':
+			a.startInput(modeTag, a.tag)
+		case 'c':
+			a.clearFilters()
+		case 'u':
+			a.apply(a.storage.Undo, "undone")
+		case 'U':
+			a.apply(a.storage.Redo, "redone")
+		case 'r':
+			a.reload()
+		case '?':
+			a.mode = modeHelp
+		}
+	}
+
+	return false
+}
+
+// edit handles keys typing the input line
+func (a *App) edit(key Key) {
+	switch key.Code {
+	case KeyEscape:
+		if a.mode == modeSearch {
+			a.search = ""
+			a.reload()
+		}
+		a.mode, a.input = modeBrowse, nil
+		return
+	case KeyEnter:
+		a.submit()
+		return
+	case KeyBackspace:
+		if len(a.input) > 0 {
+			a.input = a.input[:len(a.input)-1]
+		}
+	case KeyCtrlU:
+		a.input = nil
+	case KeyRune:
+		a.input = append(a.input, key.Rune)
+	default:
+		return
+	}
+
+	if a.mode == modeSearch {
+		a.search = string(a.input)
+		a.reload()
+	}
+}
+
+// submit applies the typed input according to the mode
+func (a *App) submit() {
+	text := strings.TrimSpace(string(a.input))
+	current := a.mode
+	a.mode, a.input = modeBrowse, nil
+
+	switch current {
+	case modeAdd, modeSubtask:
+		record := parseRecord(text)
+		if record.Content == "" {
+			a.message = "no content to add"
+			return
+		}
+		if a.options.List != "" {
+			record.List = &storage.List{Name: a.options.List}
+		}
+		if parent, ok := a.selected(); ok && current == modeSubtask {
+			record.ParentID = &parent.ID
+			if record.List == nil {
+				record.List = parent.List
+			}
+		}
+		if err := a.storage.CreateRecord(&record); err != nil {
+			a.message = fmt.Sprintf("task can not be added, error: %s", err)
+			return
+		}
+		a.reload()
+		a.selectID(record.ID)
+		a.message = fmt.Sprintf("task %d is added", record.ID)
+	case modeEdit:
+		record, ok := a.selected()
+		if !ok {
+			return
+		}
+		if text == "" {
+			a.message = "content can not be empty"
+			return
+		}
+		record.Content = text
+		if err := a.storage.UpdateRecord(&record); err != nil {
+			a.message = fmt.Sprintf("task can not be edited, error: %s", err)
+			return
+		}
+		a.reload()
+		a.message = fmt.Sprintf("task %d is edited", record.ID)
+	case modeSearch:
+		a.search = text
+		a.reload()
+	case modeTag:
+		a.tag = storage.NormalizeTag(text)
+		a.reload()
+	}
+}
+
+// Render writes the screen: the header, the visible rows, the status line and the key hints
+func (a *App) Render(w io.Writer) {
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+
+	a.writeLine(&b, styleReverse, a.header())
+
+	lines := a.pageSize()
+	if a.mode == modeHelp {
+		for i := 0; i < lines; i++ {
+			text := ""
+			if i < len(helpLines) {
+				text = "  " + helpLines[i]
+			}
+			a.writeLine(&b, "", text)
+		}
+	} else {
+		for i := a.offset; i < a.offset+lines; i++ {
+			if i >= len(a.rows) {
+				text := ""
+				if i == 0 {
+					text = "  no tasks, press a to add one"
+				}
+				a.writeLine(&b, "", text)
+				continue
+			}
+
+			style := ""
+			if i == a.cursor {
+				style = styleReverse
+			} else if a.rows[i].record.Done {
+				style = styleDim
+			}
+			a.writeLine(&b, style, a.formatRow(a.rows[i]))
+		}
+	}
+
+	if prompt, ok := modeToPrompt[a.mode]; ok {
+		a.writeLine(&b, "", prompt+string(a.input)+"_")
+	} else {
+		a.writeLine(&b, "", a.message)
+	}
+
+	b.WriteString(styleDim + truncate(hints, a.width) + styleReset + clearLine)
+	_, _ = io.WriteString(w, b.String())
+}
+
+// header returns the title line with the active filters and the number of shown records
+func (a *App) header() string {
+	parts := []string{"later"}
+	if a.options.List != "" {
+		parts = append(parts, "list: "+a.options.List)
+	}
+
+	if a.showAll {
+		parts = append(parts, "all tasks")
+	} else {
+		parts = append(parts, "pending tasks")
+	}
+
+	if a.search != "" {
+		parts = append(parts, fmt.Sprintf("search: %q", a.search))
+	}
+
+	if a.tag != "" {
+		parts = append(parts, "tag: +"+a.tag)
+	}
+
+	return fmt.Sprintf(" %s (%d)", strings.Join(parts, " | "), len(a.rows))
+}
+
+// formatRow returns a record line indented by its depth in the hierarchy of subtasks
+func (a *App) formatRow(r row) string {
+	box := "[ ]"
+	if r.record.Done {
+		box = "[x]"
+	}
+
+	line := fmt.Sprintf(" %s%s %d. %s%s", strings.Repeat("  ", r.depth), box, r.record.ID, priorityToMarker[r.record.Priority], r.record.Content)
+	for _, tag := range r.record.Tags {
+		if strings.HasPrefix(tag.Name, "@") {
+			line += " " + tag.Name
+			continue
+		}
+		line += " +" + tag.Name
+	}
+
+	if r.progress != nil {
+		line += fmt.Sprintf(" [%d/%d]", r.progress.Done, r.progress.Total)
+	}
+
+	if r.record.DueAt != nil {
+		due := "due: " + dateparse.Format(*r.record.DueAt)
+		if !r.record.Done && r.record.DueAt.Before(a.now()) {
+			due = "overdue: " + dateparse.Format(*r.record.DueAt)
+		}
+		line += " (" + due + ")"
+	}
+
+	return line
+}
+
+// writeLine writes a screen line cut to the width, the style is applied to the whole line
+func (a *App) writeLine(b *strings.Builder, style, text string) {
+	text = truncate(text, a.width)
+	if style != "" {
+		text = style + text + strings.Repeat(" ", a.width-utf8.RuneCountInString(text)) + styleReset
+	}
+	b.WriteString(text + clearLine + "\r\n")
+}
+
+// pageSize returns the number of rows fitting on the screen between the header and the status lines
+func (a *App) pageSize() int {
+	if a.height <= 4 {
+		return 1
+	}
+
+	return a.height - 3
+}
+
+// move shifts the selection by the number of rows, keeping it within the list
+func (a *App) move(delta int) {
+	a.cursor += delta
+	if a.cursor >= len(a.rows) {
+		a.cursor = len(a.rows) - 1
+	}
+	if a.cursor < 0 {
+		a.cursor = 0
+	}
+	a.scroll()
+}
+
+// scroll keeps the selected row on the screen
+func (a *App) scroll() {
+	if a.cursor >= len(a.rows) {
+		a.cursor = len(a.rows) - 1
+	}
+	if a.cursor < 0 {
+		a.cursor = 0
+	}
+
+	lines := a.pageSize()
+	if a.cursor < a.offset {
+		a.offset = a.cursor
+	}
+	if a.cursor >= a.offset+lines {
+		a.offset = a.cursor - lines + 1
+	}
+	if maxOffset := len(a.rows) - lines; a.offset > maxOffset {
+		a.offset = maxOffset
+	}
+	if a.offset < 0 {
+		a.offset = 0
+	}
+}
+
+// selected returns the record under the selection
+func (a *App) selected() (storage.Record, bool) {
+	if a.cursor < 0 || a.cursor >= len(a.rows) {
+		return storage.Record{}, false
+	}
+
+	return a.rows[a.cursor].record, true
+}
+
+// selectID moves the selection to the record with the ID if it is shown
+func (a *App) selectID(id uint) {
+	for i, row := range a.rows {
+		if row.record.ID == id {
+			a.cursor = i
+			a.scroll()
+			return
+		}
+	}
+}
+
+// startInput switches to the input mode with the initial text
+func (a *App) startInput(m mode, text string) {
+	a.mode, a.input, a.message = m, []rune(text), ""
+}
+
+// startEdit switches to editing of the selected record content
+func (a *App) startEdit() {
+	if record, ok := a.selected(); ok {
+		a.startInput(modeEdit, record.Content)
+	}
+}
+
+// clearFilters resets the text and tag filters
+func (a *App) clearFilters() {
+	a.search, a.tag = "", ""
+	a.reload()
+}
+
+// toggleSelected completes the selected record or reopens it if it is completed
+func (a *App) toggleSelected() {
+	record, ok := a.selected()
+	if !ok {
+		return
+	}
+
+	if err := a.storage.MarkRecordDone(record.ID, !record.Done); err != nil {
+		a.message = fmt.Sprintf("task status can not be changed, error: %s", err)
+		return
+	}
+
+	a.reload()
+	if record.Done {
+		a.message = fmt.Sprintf("task %d is reopened", record.ID)
+		return
+	}
+	a.message = fmt.Sprintf("task %d is completed", record.ID)
+}
+
+// prioritizeSelected raises priority of the selected record, the highest priority is followed by none
+func (a *App) prioritizeSelected() {
+	record, ok := a.selected()
+	if !ok {
+		return
+	}
+
+	priority := nextPriority[record.Priority]
+	if err := a.storage.SetRecordPriority(record.ID, priority); err != nil {
+		a.message = fmt.Sprintf("task priority can not be changed, error: %s", err)
+		return
+	}
+
+	a.reload()
+	a.selectID(record.ID)
+	a.message = fmt.Sprintf("task %d priority is %s", record.ID, priority)
+}
+
+// deleteSelected deletes the selected record with its subtasks
+func (a *App) deleteSelected() {
+	record, ok := a.selected()
+	if !ok {
+		return
+	}
+
+	if err := a.storage.DeleteRecordByID(record.ID); err != nil {
+		a.message = fmt.Sprintf("task can not be deleted, error: %s", err)
+		return
+	}
+
+	a.reload()
+	a.message = fmt.Sprintf("task %d is deleted, press u to undo", record.ID)
+}
+
+// apply runs undo or redo and reports its outcome
+func (a *App) apply(operation func() (string, error), done string) {
+	description, err := operation()
+	if err != nil {
+		a.message = err.Error()
+		return
+	}
+
+	a.reload()
+	a.message = fmt.Sprintf("%s: %s", done, description)
+}
+
+// reload reads records from the storage, reporting errors in the status line
+func (a *App) reload() {
+	if err := a.Reload(); err != nil {
+		a.message = err.Error()
+	}
+}
+
+// parseRecord returns a record from the typed text, +tag tokens label the record
+func parseRecord(text string) storage.Record {
+	var record storage.Record
+	var words []string
+	for _, word := range strings.Fields(text) {
+		if len(word) > 1 && strings.HasPrefix(word, "+") {
+			record.Tags = append(record.Tags, storage.Tag{Name: word})
+			continue
+		}
+		words = append(words, word)
+	}
+	record.Content = strings.Join(words, " ")
+
+	return record
+}
+
+// filterByText returns records which content or tags contain the text, ignoring case
+func filterByText(records []storage.Record, text string) []storage.Record {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "" {
+		return records
+	}
+
+	filtered := make([]storage.Record, 0, len(records))
+	for _, record := range records {
+		matched := strings.Contains(strings.ToLower(record.Content), text)
+		for _, tag := range record.Tags {
+			matched = matched || strings.Contains(tag.Name, strings.TrimPrefix(text, "+"))
+		}
+		if matched {
+			filtered = append(filtered, record)
+		}
+	}
+
+	return filtered
+}
+
+// buildRows arranges records into a tree, subtasks follow their parents; subtasks of parents
+// which are not shown are placed at the top level
+func buildRows(records []storage.Record, progress map[uint]storage.Progress) []row {
+	shown := make(map[uint]bool, len(records))
+	for _, record := range records {
+		shown[record.ID] = true
+	}
+
+	var roots []storage.Record
+	subtasks := make(map[uint][]storage.Record)
+	for _, record := range records {
+		if record.ParentID != nil && shown[*record.ParentID] {
+			subtasks[*record.ParentID] = append(subtasks[*record.ParentID], record)
+			continue
+		}
+		roots = append(roots, record)
+	}
+
+	rows := make([]row, 0, len(records))
+	var add func(records []storage.Record, depth int)
+	add = func(records []storage.Record, depth int) {
+		for _, record := range records {
+			r := row{record: record, depth: depth}
+			if p, ok := progress[record.ID]; ok {
+				r.progress = &p
+			}
+			rows = append(rows, r)
+			add(subtasks[record.ID], depth+1)
+		}
+	}
+	add(roots, 0)
+
+	return rows
+}
+
+// truncate cuts the text to the number of characters
+func truncate(text string, width int) string {
+	if utf8.RuneCountInString(text) <= width {
+		return text
+	}
+
+	runes := []rune(text)
+	if width < 1 {
+		return ""
+	}
+
+	return string(runes[:width-1]) + "…"
+}
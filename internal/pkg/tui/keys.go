@@ -0,0 +1,98 @@
+package tui
+
+import "unicode/utf8"
+
+// KeyCode defines a key pressed in the terminal
+type KeyCode int
+
+const (
+	KeyRune KeyCode = iota // printable character, kept in Key.Rune
+	KeyEnter
+	KeyBackspace
+	KeyEscape
+	KeyTab
+	KeyUp
+	KeyDown
+	KeyPageUp
+	KeyPageDown
+	KeyHome
+	KeyEnd
+	KeyCtrlC
+	KeyCtrlU
+)
+
+// Key defines a single key press
+type Key struct {
+	Code KeyCode
+	Rune rune
+}
+
+// escapeSequences maps sequences sent by terminals after ESC to keys
+var escapeSequences = map[string]KeyCode{
+	"[A":  KeyUp,
+	"[B":  KeyDown,
+	"OA":  KeyUp,
+	"OB":  KeyDown,
+	"[5~": KeyPageUp,
+	"[6~": KeyPageDown,
+	"[H":  KeyHome,
+	"[F":  KeyEnd,
+	"OH":  KeyHome,
+	"OF":  KeyEnd,
+	"[1~": KeyHome,
+	"[4~": KeyEnd,
+}
+
+// parseKeys splits bytes read from the terminal in raw mode into key presses; unknown escape sequences are skipped
+func parseKeys(data []byte) []Key {
+	var keys []Key
+	for len(data) > 0 {
+		switch b := data[0]; {
+		case b == 0x1b:
+			if len(data) == 1 {
+				return append(keys, Key{Code: KeyEscape})
+			}
+			size := escapeSize(data[1:])
+			if code, ok := escapeSequences[string(data[1:1+size])]; ok {
+				keys = append(keys, Key{Code: code})
+			}
+			data = data[1+size:]
+			continue
+		case b == '\r' || b == '\n':
+			keys = append(keys, Key{Code: KeyEnter})
+		case b == 0x7f || b == 0x08:
+			keys = append(keys, Key{Code: KeyBackspace})
+		case b == '\t':
+			keys = append(keys, Key{Code: KeyTab})
+		case b == 0x03:
+			keys = append(keys, Key{Code: KeyCtrlC})
+		case b == 0x15:
+			keys = append(keys, Key{Code: KeyCtrlU})
+		case b < 0x20:
+			// other control characters are ignored
+		default:
+			r, size := utf8.DecodeRune(data)
+			keys = append(keys, Key{Code: KeyRune, Rune: r})
+			data = data[size:]
+			continue
+		}
+		data = data[1:]
+	}
+
+	return keys
+}
+
+// escapeSize returns the length of the escape sequence following ESC: "[" or "O" with parameters and the final letter
+func escapeSize(data []byte) int {
+	if data[0] != '[' && data[0] != 'O' {
+		return 0
+	}
+
+	for i := 1; i < len(data); i++ {
+		if data[i] >= 0x40 && data[i] <= 0x7e {
+			return i + 1
+		}
+	}
+
+	return len(data)
+}
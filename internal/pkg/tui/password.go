@@ -0,0 +1,49 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrInterrupted is returned when reading is interrupted with Ctrl+C or Escape
+var ErrInterrupted = errors.New("input is interrupted")
+
+// ReadPassword prints the prompt to the output and reads a line from the terminal without echo
+func ReadPassword(in *os.File, out io.Writer, prompt string) ([]byte, error) {
+	t, err := makeRaw(in)
+	if err != nil {
+		return nil, fmt.Errorf("terminal can not be switched into the raw mode, error: %s", err)
+	}
+	defer t.restore()
+
+	_, _ = fmt.Fprint(out, prompt)
+	defer fmt.Fprint(out, "\r\n")
+
+	var password []rune
+	buf := make([]byte, 256)
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range parseKeys(buf[:n]) {
+			switch key.Code {
+			case KeyEnter:
+				return []byte(string(password)), nil
+			case KeyCtrlC, KeyEscape:
+				return nil, ErrInterrupted
+			case KeyBackspace:
+				if len(password) > 0 {
+					password = password[:len(password)-1]
+				}
+			case KeyCtrlU:
+				password = password[:0]
+			case KeyRune:
+				password = append(password, key.Rune)
+			}
+		}
+	}
+}
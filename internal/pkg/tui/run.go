@@ -0,0 +1,105 @@
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/manmolecular/go-later/internal/pkg/storage"
+)
+
+const (
+	refreshInterval = 2 * time.Second // records changed outside of the interface are reloaded with this interval
+	enterScreen     = "\x1b[?1049h\x1b[?25l"
+	leaveScreen     = "\x1b[?25h\x1b[?1049l"
+)
+
+// Run shows the interface in the terminal until it is closed, keys are read from the input
+// and the screen is written to the output
+func Run(s storage.Storage, in, out *os.File, options Options) error {
+	term, err := makeRaw(in)
+	if err != nil {
+		return fmt.Errorf("terminal can not be switched into raw mode, error: %s", err)
+	}
+
+	defer func() {
+		_, _ = io.WriteString(out, leaveScreen)
+		_ = term.restore()
+	}()
+
+	if _, err = io.WriteString(out, enterScreen); err != nil {
+		return fmt.Errorf("screen can not be written, error: %s", err)
+	}
+
+	app := NewApp(s, options)
+	if width, height, err := term.size(); err == nil {
+		app.Resize(width, height)
+	}
+
+	if err = app.Reload(); err != nil {
+		return err
+	}
+
+	// the reader is left blocked on the input when the interface is closed, it stops after the next read
+	done := make(chan struct{})
+	defer close(done)
+
+	keys := make(chan []Key)
+	readErrors := make(chan error, 1)
+	go readKeys(in, keys, readErrors, done)
+
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+	defer signal.Stop(resize)
+
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	screen := bufio.NewWriter(out)
+	for {
+		app.Render(screen)
+		if err = screen.Flush(); err != nil {
+			return fmt.Errorf("screen can not be written, error: %s", err)
+		}
+
+		select {
+		case pressed := <-keys:
+			for _, key := range pressed {
+				if app.HandleKey(key) {
+					return nil
+				}
+			}
+		case err = <-readErrors:
+			return fmt.Errorf("keys can not be read, error: %s", err)
+		case <-resize:
+			if width, height, err := term.size(); err == nil {
+				app.Resize(width, height)
+			}
+		case <-ticker.C:
+			if app.mode == modeBrowse {
+				app.reload()
+			}
+		}
+	}
+}
+
+// readKeys sends keys read from the input to the channel until reading fails or the done channel is closed
+func readKeys(in io.Reader, keys chan<- []Key, errs chan<- error, done <-chan struct{}) {
+	buffer := make([]byte, 256)
+	for {
+		n, err := in.Read(buffer)
+		if err != nil {
+			errs <- err
+			return
+		}
+
+		select {
+		case keys <- parseKeys(buffer[:n]):
+		case <-done:
+			return
+		}
+	}
+}
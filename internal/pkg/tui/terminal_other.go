@@ -0,0 +1,27 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package tui
+
+import (
+	"errors"
+	"os"
+)
+
+// terminal is not supported on the platform
+type terminal struct{}
+
+// makeRaw returns an error, as the raw mode is not supported on the platform
+func makeRaw(*os.File) (*terminal, error) {
+	return nil, errors.New("interactive terminal is not supported on this platform")
+}
+
+func (t *terminal) restore() error {
+	return nil
+}
+
+func (t *terminal) size() (int, int, error) {
+	return 0, 0, errors.New("terminal size is not available on this platform")
+}
+
+// notifyResize does nothing, as terminal size changes are not reported on the platform
+func notifyResize(chan<- os.Signal) {}
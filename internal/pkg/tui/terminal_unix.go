@@ -0,0 +1,71 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package tui
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// terminal keeps the state of the terminal to restore it after the raw mode
+type terminal struct {
+	fd    uintptr
+	state syscall.Termios
+}
+
+// makeRaw switches the terminal into the raw mode: input is read key by key without echo and signals,
+// output is written as is
+func makeRaw(file *os.File) (*terminal, error) {
+	t := &terminal{fd: file.Fd()}
+	if err := ioctl(t.fd, ioctlGetTermios, unsafe.Pointer(&t.state)); err != nil {
+		return nil, err
+	}
+
+	raw := t.state
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	if err := ioctl(t.fd, ioctlSetTermios, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// restore brings the terminal back to the state it had before the raw mode
+func (t *terminal) restore() error {
+	return ioctl(t.fd, ioctlSetTermios, unsafe.Pointer(&t.state))
+}
+
+// size returns the number of columns and rows of the terminal
+func (t *terminal) size() (int, int, error) {
+	var size struct {
+		rows, cols, xPixels, yPixels uint16
+	}
+	if err := ioctl(t.fd, syscall.TIOCGWINSZ, unsafe.Pointer(&size)); err != nil {
+		return 0, 0, err
+	}
+
+	return int(size.cols), int(size.rows), nil
+}
+
+// notifyResize relays changes of the terminal size to the channel
+func notifyResize(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGWINCH)
+}
+
+// ioctl performs the terminal control request
+func ioctl(fd, request uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg)); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
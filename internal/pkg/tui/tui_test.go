@@ -0,0 +1,209 @@
+package tui
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/manmolecular/go-later/internal/pkg/storage"
+)
+
+// createTestApp returns the interface over a temporary storage
+func createTestApp(t *testing.T) (*App, storage.Storage) {
+	s, err := storage.NewCustomLocalStorage(t.TempDir(), "db", "test.db", storage.Options{})
+	if err != nil {
+		t.Fatalf("test storage can not be created, unexpected error: %s", err)
+	}
+
+	t.Cleanup(func() {
+		if err := s.Close(); err != nil {
+			t.Errorf("test storage can not be closed, unexpected error: %s", err)
+		}
+	})
+
+	app := NewApp(s, Options{Order: storage.OrderOldest})
+	if err = app.Reload(); err != nil {
+		t.Fatalf("records can not be loaded, unexpected error: %s", err)
+	}
+
+	return app, s
+}
+
+// typeText presses keys of the text
+func typeText(app *App, text string) {
+	for _, key := range parseKeys([]byte(text)) {
+		app.HandleKey(key)
+	}
+}
+
+// TestParseKeys checks that bytes read from the terminal are split into keys
+func TestParseKeys(t *testing.T) {
+	keys := parseKeys([]byte("aé\r\x7f\x1b[A\x1b[6~\x1b[Z\t\x03"))
+	expected := []Key{
+		{Code: KeyRune, Rune: 'a'},
+		{Code: KeyRune, Rune: 'é'},
+		{Code: KeyEnter},
+		{Code: KeyBackspace},
+		{Code: KeyUp},
+		{Code: KeyPageDown},
+		{Code: KeyTab},
+		{Code: KeyCtrlC},
+	}
+
+	if len(keys) != len(expected) {
+		t.Fatalf("expected keys %v, got: %v", expected, keys)
+	}
+
+	for i := range expected {
+		if keys[i] != expected[i] {
+			t.Errorf("expected keys %v, got: %v", expected, keys)
+		}
+	}
+
+	if keys = parseKeys([]byte{0x1b}); len(keys) != 1 || keys[0].Code != KeyEscape {
+		t.Errorf("expected a single escape key, got: %v", keys)
+	}
+}
+
+// TestReadKeys checks that keys are read until the interface is closed and the reader does not block afterwards
+func TestReadKeys(t *testing.T) {
+	reader, writer := io.Pipe()
+	defer reader.Close()
+
+	keys := make(chan []Key)
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		readKeys(reader, keys, errs, done)
+		close(stopped)
+	}()
+
+	go func() { _, _ = writer.Write([]byte("a")) }()
+	if pressed := <-keys; len(pressed) != 1 || pressed[0].Rune != 'a' {
+		t.Errorf("expected key 'a' to be read, got: %v", pressed)
+	}
+
+	close(done)
+	go func() { _, _ = writer.Write([]byte("b")) }()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("expected reader to stop after the interface is closed")
+	}
+}
+
+// TestApp checks adding, editing, completing and deleting records with keys
+func TestApp(t *testing.T) {
+	app, s := createTestApp(t)
+
+	typeText(app, "abuy milk +home\r")
+	typeText(app, "awrite report\r")
+	typeText(app, "Aoutline\r")
+
+	records, err := s.GetRecords(storage.Filter{Order: storage.OrderOldest})
+	if err != nil || len(records) != 3 {
+		t.Fatalf("expected 3 records added, got: %v, error: %v", records, err)
+	}
+
+	if len(records[0].Tags) != 1 || records[2].ParentID == nil || *records[2].ParentID != records[1].ID {
+		t.Errorf("expected tagged record and subtask, got: %v", records)
+	}
+
+	if record, ok := app.selected(); !ok || record.ID != records[2].ID || app.rows[app.cursor].depth != 1 {
+		t.Errorf("expected added subtask to be selected, got: %v", app.rows)
+	}
+
+	typeText(app, "gepx")
+	app.HandleKey(Key{Code: KeyCtrlU})
+	typeText(app, "buy oat milk\r")
+
+	record, err := s.GetRecordByID(records[0].ID)
+	if err != nil || record.Content != "buy oat milk" || record.Priority != storage.PriorityNone {
+		t.Errorf("expected record content to be edited, got: %v, error: %v", record, err)
+	}
+
+	app.HandleKey(Key{Code: KeyEscape})
+	typeText(app, "p ")
+	if record, _ = s.GetRecordByID(records[0].ID); !record.Done || record.Priority != storage.PriorityLow {
+		t.Errorf("expected record to be prioritized and completed, got: %v", record)
+	}
+
+	if len(app.rows) != 2 || app.rows[0].progress == nil || app.rows[0].progress.Total != 1 {
+		t.Errorf("expected pending records with progress of subtasks, got: %v", app.rows)
+	}
+
+	typeText(app, "dn")
+	if count, _ := s.CountRecords(storage.Filter{}); count != 3 {
+		t.Errorf("expected deletion to be cancelled, got %d records", count)
+	}
+
+	typeText(app, "gdy")
+	if count, _ := s.CountRecords(storage.Filter{}); count != 1 {
+		t.Errorf("expected record to be deleted with its subtask, got %d records", count)
+	}
+
+	typeText(app, "u")
+	if count, _ := s.CountRecords(storage.Filter{}); count != 3 || !strings.HasPrefix(app.message, "undone") {
+		t.Errorf("expected deletion to be undone, got %d records, message: %s", count, app.message)
+	}
+
+	if !app.HandleKey(Key{Code: KeyRune, Rune: 'q'}) {
+		t.Errorf("expected q to close the interface")
+	}
+}
+
+// TestAppFilters checks filtering by text and tag, showing completed records and rendering of the screen
+func TestAppFilters(t *testing.T) {
+	app, s := createTestApp(t)
+
+	for _, record := range []storage.Record{
+		{Content: "call mom", Tags: []storage.Tag{{Name: "family"}}},
+		{Content: "pay bills"},
+		{Content: "call plumber", Done: true},
+	} {
+		record := record
+		if err := s.CreateRecord(&record); err != nil {
+			t.Fatalf("test record can not be created, unexpected error: %s", err)
+		}
+	}
+
+	typeText(app, "r/CALL")
+	if len(app.rows) != 1 || app.rows[0].record.Content != "call mom" {
+		t.Errorf("expected pending records matching the text, got: %v", app.rows)
+	}
+
+	app.HandleKey(Key{Code: KeyEnter})
+	app.HandleKey(Key{Code: KeyTab})
+	if len(app.rows) != 2 {
+		t.Errorf("expected all records matching the text, got: %v", app.rows)
+	}
+
+	typeText(app, "ctfamily\r")
+	if len(app.rows) != 1 || app.tag != "family" {
+		t.Errorf("expected records labeled by the tag, got: %v", app.rows)
+	}
+
+	app.Resize(40, 6)
+
+	var screen strings.Builder
+	app.Render(&screen)
+	output := screen.String()
+
+	if !strings.Contains(output, "tag: +family") || !strings.Contains(output, "1. call mom +family") {
+		t.Errorf("expected header with the filter and the record on the screen, got: %q", output)
+	}
+
+	if lines := strings.Count(output, "\r\n"); lines != 5 {
+		t.Errorf("expected 6 lines on the screen, got %d: %q", lines+1, output)
+	}
+
+	typeText(app, "?")
+	screen.Reset()
+	app.Render(&screen)
+	if !strings.Contains(screen.String(), "move the selection") {
+		t.Errorf("expected keys to be described in the help mode, got: %q", screen.String())
+	}
+}